@@ -9,13 +9,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"os"
 	"runtime"
+	"sync"
 	"time"
 
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth/signers"
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/endpoints"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/kms"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ram"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/vpc"
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 	"github.com/hashicorp/packer-plugin-alicloud/version"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 	"github.com/mitchellh/go-homedir"
@@ -56,13 +63,22 @@ type AlicloudAccessConfig struct {
 	// This option is useful if you use a cloud provider whose API is
 	// compatible with aliyun ECS. Specify another endpoint with this option.
 	CustomEndpointEcs string `mapstructure:"custom_endpoint_ecs" required:"false"`
+	// The maximum number of requests per second sent to the Alicloud APIs,
+	// shared by all the clients of the plugin process. This is useful to keep
+	// many concurrent builds in the same account under its API rate limit.
+	// The default value is 0, which does not limit the rate.
+	ApiRateLimit float64 `mapstructure:"api_rate_limit" required:"false"`
 
 	client    *ClientWrapper
 	vpcClient *VPCClientWrapper
+	ramClient *ram.Client
+	kmsClient *kms.Client
+	signer    auth.Signer
 }
 
 const Packer = "HashiCorp-Packer"
 const DefaultRequestReadTimeout = 10 * time.Second
+const DefaultRequestConnectTimeout = 5 * time.Second
 
 // Client for AlicloudClient
 func (c *AlicloudAccessConfig) Client() (*ClientWrapper, error) {
@@ -121,7 +137,11 @@ func (c *AlicloudAccessConfig) Client() (*ClientWrapper, error) {
 
 	client.AppendUserAgent(Packer, version.PluginVersion.FormattedVersion())
 	client.SetReadTimeout(DefaultRequestReadTimeout)
+	if c.ApiRateLimit > 0 {
+		client.SetTransport(newRateLimitedTransport(c.ApiRateLimit))
+	}
 	c.client = &ClientWrapper{client}
+	c.signer = client.GetSigner()
 
 	return c.client, nil
 }
@@ -154,11 +174,131 @@ func (c *AlicloudAccessConfig) VPCClient() (*VPCClientWrapper, error) {
 
 	client.AppendUserAgent(Packer, version.PluginVersion.FormattedVersion())
 	client.SetReadTimeout(DefaultRequestReadTimeout)
+	if c.ApiRateLimit > 0 {
+		client.SetTransport(newRateLimitedTransport(c.ApiRateLimit))
+	}
 	c.vpcClient = &VPCClientWrapper{client}
 
 	return c.vpcClient, nil
 }
 
+// RAMClient for AliRAMClient
+func (c *AlicloudAccessConfig) RAMClient() (*ram.Client, error) {
+	if c.ramClient != nil {
+		return c.ramClient, nil
+	}
+
+	_, err := c.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	var client *ram.Client
+	if c.AlicloudRamRole != "" {
+		client, err = ram.NewClientWithEcsRamRole(c.AlicloudRegion, c.AlicloudRamRole)
+	} else if c.AlicloudRamRoleArn != "" && c.AlicloudRamSessionName != "" {
+		client, err = ram.NewClientWithRamRoleArn(
+			c.AlicloudRegion, c.AlicloudAccessKey,
+			c.AlicloudSecretKey, c.AlicloudRamRoleArn, c.AlicloudRamSessionName)
+	} else {
+		client, err = ram.NewClientWithStsToken(c.AlicloudRegion, c.AlicloudAccessKey, c.AlicloudSecretKey, c.SecurityToken)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	client.AppendUserAgent(Packer, version.PluginVersion.FormattedVersion())
+	client.SetReadTimeout(DefaultRequestReadTimeout)
+	if c.ApiRateLimit > 0 {
+		client.SetTransport(newRateLimitedTransport(c.ApiRateLimit))
+	}
+	c.ramClient = client
+
+	return c.ramClient, nil
+}
+
+// KMSClient returns a client of KMS. Its requests go to the region of the
+// build unless they specify their own region.
+func (c *AlicloudAccessConfig) KMSClient() (*kms.Client, error) {
+	if c.kmsClient != nil {
+		return c.kmsClient, nil
+	}
+
+	_, err := c.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	var client *kms.Client
+	if c.AlicloudRamRole != "" {
+		client, err = kms.NewClientWithEcsRamRole(c.AlicloudRegion, c.AlicloudRamRole)
+	} else if c.AlicloudRamRoleArn != "" && c.AlicloudRamSessionName != "" {
+		client, err = kms.NewClientWithRamRoleArn(
+			c.AlicloudRegion, c.AlicloudAccessKey,
+			c.AlicloudSecretKey, c.AlicloudRamRoleArn, c.AlicloudRamSessionName)
+	} else {
+		client, err = kms.NewClientWithStsToken(c.AlicloudRegion, c.AlicloudAccessKey, c.AlicloudSecretKey, c.SecurityToken)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	client.AppendUserAgent(Packer, version.PluginVersion.FormattedVersion())
+	client.SetReadTimeout(DefaultRequestReadTimeout)
+	if c.ApiRateLimit > 0 {
+		client.SetTransport(newRateLimitedTransport(c.ApiRateLimit))
+	}
+	c.kmsClient = client
+
+	return c.kmsClient, nil
+}
+
+// OSSClient returns a client of the OSS endpoint signing its requests with
+// the credentials of Client, so that the STS token of a RAM role is
+// refreshed the same way.
+func (c *AlicloudAccessConfig) OSSClient(endpoint string) (*oss.Client, error) {
+	_, err := c.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	provider := &signerCredentialsProvider{
+		signer: c.signer,
+		static: &signers.SessionCredential{
+			AccessKeyId:     c.AlicloudAccessKey,
+			AccessKeySecret: c.AlicloudSecretKey,
+			StsToken:        c.SecurityToken,
+		},
+	}
+	if _, err := provider.credential(); err != nil {
+		return nil, fmt.Errorf("Failed to get OSS credentials: %s", err)
+	}
+
+	return oss.New(endpoint, "", "",
+		oss.SetCredentialsProvider(provider),
+		oss.UserAgent(fmt.Sprintf("%s/%s", Packer, version.PluginVersion.FormattedVersion())))
+}
+
+// AssumeRole returns a copy of the access config assuming the RAM role, e.g.
+// of another account, with the access key of c.
+func (c *AlicloudAccessConfig) AssumeRole(roleArn string, sessionName string) *AlicloudAccessConfig {
+	return &AlicloudAccessConfig{
+		AlicloudAccessKey:             c.AlicloudAccessKey,
+		AlicloudSecretKey:             c.AlicloudSecretKey,
+		AlicloudRegion:                c.AlicloudRegion,
+		AlicloudRamRoleArn:            roleArn,
+		AlicloudRamSessionName:        sessionName,
+		AlicloudSkipValidation:        c.AlicloudSkipValidation,
+		AlicloudSkipImageValidation:   c.AlicloudSkipImageValidation,
+		AlicloudProfile:               c.AlicloudProfile,
+		AlicloudSharedCredentialsFile: c.AlicloudSharedCredentialsFile,
+		CustomEndpointEcs:             c.CustomEndpointEcs,
+		ApiRateLimit:                  c.ApiRateLimit,
+	}
+}
+
 func (c *AlicloudAccessConfig) Prepare(ctx *interpolate.Context) []error {
 	var errs []error
 	if err := c.Config(); err != nil {
@@ -173,6 +313,10 @@ func (c *AlicloudAccessConfig) Prepare(ctx *interpolate.Context) []error {
 		errs = append(errs, fmt.Errorf("region option or ALICLOUD_REGION must be provided in template file or environment variables."))
 	}
 
+	if c.ApiRateLimit < 0 {
+		errs = append(errs, fmt.Errorf("api_rate_limit must not be negative."))
+	}
+
 	if len(errs) > 0 {
 		return errs
 	}
@@ -298,3 +442,62 @@ func getConfigFromProfile(c *AlicloudAccessConfig, ProfileKey string) (interface
 	}
 	return providerConfig[ProfileKey], nil
 }
+
+// signerCredentialsProvider provides the OSS client with the credentials of
+// an ECS client signer.
+type signerCredentialsProvider struct {
+	signer auth.Signer
+	static *signers.SessionCredential
+
+	lock sync.Mutex
+	last *signers.SessionCredential
+}
+
+// credential returns the current credentials of the signer, refreshing the
+// session credentials of a RAM role when they are about to expire.
+func (p *signerCredentialsProvider) credential() (*signers.SessionCredential, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var session interface {
+		GetAccessKeyId() (string, error)
+		GetSessionCredential() *signers.SessionCredential
+	}
+	switch signer := p.signer.(type) {
+	case *signers.EcsRamRoleSigner:
+		session = signer
+	case *signers.RamRoleArnSigner:
+		session = signer
+	default:
+		return p.static, nil
+	}
+
+	if _, err := session.GetAccessKeyId(); err != nil {
+		return nil, err
+	}
+	p.last = session.GetSessionCredential()
+	return p.last, nil
+}
+
+func (p *signerCredentialsProvider) GetCredentials() oss.Credentials {
+	credential, err := p.credential()
+	if err != nil {
+		// OSS 的接口无法返回错误，继续使用上一次的凭证，由请求报告鉴权失败
+		log.Printf("[WARN] Failed to refresh OSS credentials: %s", err)
+		p.lock.Lock()
+		credential = p.last
+		p.lock.Unlock()
+		if credential == nil {
+			credential = &signers.SessionCredential{}
+		}
+	}
+	return &ossCredentials{*credential}
+}
+
+type ossCredentials struct {
+	signers.SessionCredential
+}
+
+func (c *ossCredentials) GetAccessKeyID() string     { return c.AccessKeyId }
+func (c *ossCredentials) GetAccessKeySecret() string { return c.AccessKeySecret }
+func (c *ossCredentials) GetSecurityToken() string   { return c.StsToken }
@@ -67,3 +67,67 @@ func TestAlicloudAccessConfigPrepareRegion(t *testing.T) {
 
 	c.AlicloudSkipValidation = false
 }
+
+func TestAlicloudAccessConfigPrepareApiRateLimit(t *testing.T) {
+	c := testAlicloudAccessConfig()
+	c.AlicloudRegion = "cn-beijing"
+
+	c.ApiRateLimit = -1
+	if err := c.Prepare(nil); err == nil {
+		t.Fatalf("should have err")
+	}
+
+	c.ApiRateLimit = 2.5
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+
+	if _, err := c.Client(); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+}
+
+func TestAlicloudAccessConfigOSSClient(t *testing.T) {
+	c := testAlicloudAccessConfig()
+	c.AlicloudRegion = "cn-beijing"
+	c.SecurityToken = "token"
+
+	client, err := c.OSSClient("https://oss-cn-beijing.aliyuncs.com")
+	if err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+
+	credentials := client.Config.GetCredentials()
+	if credentials.GetAccessKeyID() != "ak" || credentials.GetAccessKeySecret() != "acs" || credentials.GetSecurityToken() != "token" {
+		t.Fatalf("bad: OSS client should use the credentials of the ECS client, actual %#v", credentials)
+	}
+}
+
+func TestAlicloudAccessConfigAssumeRole(t *testing.T) {
+	c := testAlicloudAccessConfig()
+	c.AlicloudRegion = "cn-beijing"
+	client, err := c.Client()
+	if err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+
+	assumed := c.AssumeRole("acs:ram::123456:role/promote", "packer")
+	if assumed.AlicloudRamRoleArn != "acs:ram::123456:role/promote" || assumed.AlicloudRamSessionName != "packer" {
+		t.Fatalf("bad: the role should be assumed, actual %s (%s)", assumed.AlicloudRamRoleArn, assumed.AlicloudRamSessionName)
+	}
+	if assumed.AlicloudAccessKey != "ak" || assumed.AlicloudRegion != "cn-beijing" {
+		t.Fatalf("bad: the access key and region should be kept, actual %s (%s)", assumed.AlicloudAccessKey, assumed.AlicloudRegion)
+	}
+
+	// 扮演角色的配置不能复用原账号的客户端
+	assumedClient, err := assumed.Client()
+	if err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+	if assumedClient == client {
+		t.Fatalf("bad: the assumed role should have its own client")
+	}
+	if c.AlicloudRamRoleArn != "" {
+		t.Fatalf("bad: the original config should not change, actual %s", c.AlicloudRamRoleArn)
+	}
+}
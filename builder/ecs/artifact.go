@@ -11,8 +11,12 @@ import (
 
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
 )
 
+// The provider name of alicloud images in the HCP Packer registry
+const RegistryProviderName = "alicloud"
+
 type Artifact struct {
 	// A map of regions to alicloud image IDs.
 	AlicloudImages map[string]string
@@ -20,6 +24,22 @@ type Artifact struct {
 	// BuilderId is the unique ID for the builder that created this alicloud image
 	BuilderIdValue string
 
+	// The ID of the image the build started from.
+	SourceImageId string
+
+	// The image family the images were published to, if any.
+	ImageFamily string
+
+	// The instance type of the instance the image was created from.
+	InstanceType string
+
+	// Key/value pair tags applied to the images.
+	Tags map[string]string
+
+	// StateData should store data such as GeneratedData
+	// to be shared with post-processors
+	StateData map[string]interface{}
+
 	// Alcloud connection for performing API stuff.
 	Client *ClientWrapper
 }
@@ -58,8 +78,10 @@ func (a *Artifact) State(name string) interface{} {
 	switch name {
 	case "atlas.artifact.metadata":
 		return a.stateAtlasMetadata()
+	case registryimage.ArtifactStateURI:
+		return a.stateHCPPackerRegistryMetadata()
 	default:
-		return nil
+		return a.StateData[name]
 	}
 }
 
@@ -187,3 +209,41 @@ func (a *Artifact) stateAtlasMetadata() interface{} {
 
 	return metadata
 }
+
+func (a *Artifact) stateHCPPackerRegistryMetadata() interface{} {
+	labels := make(map[string]interface{}, len(a.Tags)+2)
+	for key, value := range a.Tags {
+		labels[key] = value
+	}
+	if a.ImageFamily != "" {
+		labels["image_family"] = a.ImageFamily
+	}
+	if a.InstanceType != "" {
+		labels["instance_type"] = a.InstanceType
+	}
+
+	images, err := registryimage.FromMappedData(a.AlicloudImages, func(key, value interface{}) (*registryimage.Image, error) {
+		region, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type of key found for alicloud images")
+		}
+		imageId, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type of value found for alicloud images")
+		}
+
+		return registryimage.FromArtifact(a,
+			registryimage.WithProvider(RegistryProviderName),
+			registryimage.WithID(imageId),
+			registryimage.WithRegion(region),
+			registryimage.WithSourceID(a.SourceImageId),
+			registryimage.SetLabels(labels),
+		)
+	})
+	if err != nil {
+		log.Printf("[DEBUG] error encountered when creating a registry image %v", err)
+		return nil
+	}
+
+	return images
+}
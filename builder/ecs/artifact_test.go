@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	registryimage "github.com/hashicorp/packer-plugin-sdk/packer/registry/image"
 )
 
 func TestArtifact_Impl(t *testing.T) {
@@ -48,3 +49,38 @@ func TestArtifactState_atlasMetadata(t *testing.T) {
 		t.Fatalf("bad: %#v", actual)
 	}
 }
+
+func TestArtifactState_hcpPackerRegistryMetadata(t *testing.T) {
+	a := &Artifact{
+		AlicloudImages: map[string]string{
+			"cn-beijing": "m-foo",
+		},
+		SourceImageId: "ubuntu_22_04_x64_20G_alibase_20230101.vhd",
+		ImageFamily:   "web-server",
+		InstanceType:  "ecs.g6.large",
+		Tags: map[string]string{
+			"env": "dev",
+		},
+	}
+
+	actual, ok := a.State(registryimage.ArtifactStateURI).([]*registryimage.Image)
+	if !ok {
+		t.Fatalf("bad: %#v", a.State(registryimage.ArtifactStateURI))
+	}
+	expected := []*registryimage.Image{
+		{
+			ImageID:        "m-foo",
+			ProviderName:   "alicloud",
+			ProviderRegion: "cn-beijing",
+			SourceImageID:  "ubuntu_22_04_x64_20G_alibase_20230101.vhd",
+			Labels: map[string]string{
+				"env":           "dev",
+				"image_family":  "web-server",
+				"instance_type": "ecs.g6.large",
+			},
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
@@ -1,7 +1,7 @@
 // Copyright (c) HashiCorp, Inc.
 // SPDX-License-Identifier: MPL-2.0
 
-//go:generate packer-sdc mapstructure-to-hcl2 -type Config,AlicloudDiskDevice
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,AlicloudDiskDevice,AlicloudImageCopyRegion
 
 // The alicloud  contains a packersdk.Builder implementation that
 // builds ecs images for alicloud.
@@ -12,14 +12,17 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
 	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/hashicorp/packer-plugin-sdk/common"
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/hashicorp/packer-plugin-sdk/uuid"
 )
 
 // The unique ID for this builder
@@ -70,10 +73,17 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, []string, error) {
 		b.config.AlicloudImageForceDeleteSnapshots = true
 	}
 
+	if b.config.Resume && b.config.JournalFile == "" {
+		b.config.JournalFile = fmt.Sprintf("packer_%s.journal.json", b.config.PackerBuildName)
+	}
+
 	// Accumulate any errors
 	var errs *packersdk.MultiError
 	errs = packersdk.MultiErrorAppend(errs, b.config.AlicloudAccessConfig.Prepare(&b.config.ctx)...)
-	errs = packersdk.MultiErrorAppend(errs, b.config.AlicloudImageConfig.Prepare(&b.config.ctx)...)
+	// 清理模式不构建镜像，不需要镜像配置
+	if !b.config.Sweep {
+		errs = packersdk.MultiErrorAppend(errs, b.config.AlicloudImageConfig.Prepare(&b.config.ctx)...)
+	}
 	errs = packersdk.MultiErrorAppend(errs, b.config.RunConfig.Prepare(&b.config.ctx)...)
 
 	if errs != nil && len(errs.Errors) > 0 {
@@ -81,7 +91,20 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, []string, error) {
 	}
 
 	packersdk.LogSecretFilter.Set(b.config.AlicloudAccessKey, b.config.AlicloudSecretKey)
-	return nil, nil, nil
+
+	generatedData := []string{
+		"SourceImage",
+		"SourceImageName",
+		"SourceImageOSName",
+		"SourceImageOSType",
+		"SourceImageArchitecture",
+		"ZoneId",
+		"VSwitchId",
+		"InstanceId",
+		"InstanceType",
+	}
+
+	return generatedData, nil, nil
 }
 
 func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook) (packersdk.Artifact, error) {
@@ -101,6 +124,26 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 	state.Put("hook", hook)
 	state.Put("ui", ui)
 	state.Put("networktype", b.chooseNetworkType())
+	state.Put("build_uuid", uuid.TimeOrderedUUID())
+	generatedData := &packerbuilderdata.GeneratedData{State: state}
+
+	if b.config.Sweep {
+		return b.run(ctx, ui, state, []multistep.Step{
+			&stepSweepResources{
+				OlderThan: b.config.SweepOlderThan,
+				DryRun:    b.config.DryRun,
+			},
+		})
+	}
+
+	var journal *buildJournal
+	if b.config.Resume && !b.config.DryRun {
+		journal, err = loadBuildJournal(b.config.JournalFile)
+		if err != nil {
+			return nil, err
+		}
+		state.Put("journal", journal)
+	}
 	var steps []multistep.Step
 
 	// Build the steps
@@ -115,21 +158,55 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 	if b.config.AlicloudImageFamily != "" {
 		steps = append(steps,
 			&stepCheckAlicloudImageFamily{
-				ImageFamily: b.config.AlicloudImageFamily,
+				ImageFamily:   b.config.AlicloudImageFamily,
+				GeneratedData: generatedData,
 			})
 	} else {
 		steps = append(steps,
 			&stepCheckAlicloudSourceImage{
 				SourceECSImageId: b.config.AlicloudSourceImage,
+				GeneratedData:    generatedData,
 			})
 	}
-	steps = append(steps,
-		&stepConfigAlicloudKeyPair{
-			Debug:        b.config.PackerDebug,
-			Comm:         &b.config.Comm,
-			DebugKeyPath: fmt.Sprintf("ecs_%s.pem", b.config.PackerBuildName),
-			RegionId:     b.config.AlicloudRegion,
+	createInstance := &stepCreateAlicloudInstance{
+		IOOptimized:                 b.config.IOOptimized,
+		InstanceTypes:               b.config.candidateInstanceTypes(),
+		UserData:                    b.config.UserData,
+		UserDataFile:                b.config.UserDataFile,
+		RamRoleName:                 b.config.RamRoleName,
+		Tags:                        b.config.RunTags,
+		RegionId:                    b.config.AlicloudRegion,
+		InternetChargeType:          b.config.InternetChargeType,
+		InternetMaxBandwidthOut:     b.config.InternetMaxBandwidthOut,
+		InstanceName:                b.config.InstanceName,
+		SecurityEnhancementStrategy: b.config.SecurityEnhancementStrategy,
+		AlicloudImageFamily:         b.config.AlicloudImageFamily,
+		SpotStrategy:                b.config.SpotStrategy,
+		SpotPriceLimit:              b.config.SpotPriceLimit,
+		SpotDuration:                b.config.SpotDuration,
+		GeneratedData:               generatedData,
+	}
+
+	// 仅检查模板时，不执行创建资源的步骤
+	if b.config.DryRun {
+		steps = append(steps, &stepDryRun{
+			CreateInstance: createInstance,
 		})
+		return b.run(ctx, ui, state, steps)
+	}
+
+	// Cloud Assistant 通信器不连接实例，不需要密钥对和公网地址
+	cloudAssistant := b.config.Comm.Type == CloudAssistantCommunicator
+
+	if !cloudAssistant {
+		steps = append(steps,
+			&stepConfigAlicloudKeyPair{
+				Debug:        b.config.PackerDebug,
+				Comm:         &b.config.Comm,
+				DebugKeyPath: fmt.Sprintf("ecs_%s.pem", b.config.PackerBuildName),
+				RegionId:     b.config.AlicloudRegion,
+			})
+	}
 	if b.chooseNetworkType() == InstanceNetworkVpc {
 		steps = append(steps,
 			// 创建 VPC 或选择 VPC, 结果一定有且只有一个 VpcId
@@ -151,23 +228,13 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 			SecurityGroupId:   b.config.SecurityGroupId,
 			SecurityGroupName: b.config.SecurityGroupName,
 			RegionId:          b.config.AlicloudRegion,
+			SourceCidrs:       b.config.TemporarySecurityGroupSourceCidrs,
+			Comm:              &b.config.Comm,
+			SSHPrivateIp:      b.config.SSHPrivateIp,
 		},
 		// 遍历 subnet 列表, 尝试创建机器，直到创建成功或最终失败
-		&stepCreateAlicloudInstance{
-			IOOptimized:                 b.config.IOOptimized,
-			InstanceType:                b.config.InstanceType,
-			UserData:                    b.config.UserData,
-			UserDataFile:                b.config.UserDataFile,
-			RamRoleName:                 b.config.RamRoleName,
-			Tags:                        b.config.RunTags,
-			RegionId:                    b.config.AlicloudRegion,
-			InternetChargeType:          b.config.InternetChargeType,
-			InternetMaxBandwidthOut:     b.config.InternetMaxBandwidthOut,
-			InstanceName:                b.config.InstanceName,
-			SecurityEnhancementStrategy: b.config.SecurityEnhancementStrategy,
-			AlicloudImageFamily:         b.config.AlicloudImageFamily,
-		})
-	if b.chooseNetworkType() == InstanceNetworkVpc {
+		createInstance)
+	if !cloudAssistant && b.chooseNetworkType() == InstanceNetworkVpc {
 		steps = append(steps, &stepConfigAlicloudEIP{
 			AssociatePublicIpAddress: b.config.AssociatePublicIpAddress,
 			RegionId:                 b.config.AlicloudRegion,
@@ -175,25 +242,49 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 			InternetMaxBandwidthOut:  b.config.InternetMaxBandwidthOut,
 			SSHPrivateIp:             b.config.SSHPrivateIp,
 		})
-	} else {
+	} else if !cloudAssistant {
 		steps = append(steps, &stepConfigAlicloudPublicIP{
 			RegionId:     b.config.AlicloudRegion,
 			SSHPrivateIp: b.config.SSHPrivateIp,
 		})
 	}
-	steps = append(steps,
-		&stepAttachKeyPair{},
-		&stepRunAlicloudInstance{},
-		&communicator.StepConnect{
-			Config: &b.config.RunConfig.Comm,
-			Host: SSHHost(
-				client,
-				b.config.SSHPrivateIp),
-			SSHConfig: b.config.RunConfig.Comm.SSHConfigFunc(),
-		},
+
+	var provisionSteps []multistep.Step
+	if cloudAssistant {
+		provisionSteps = append(provisionSteps,
+			&stepRunAlicloudInstance{},
+			&communicator.StepConnect{
+				Config: &b.config.RunConfig.Comm,
+				Host:   cloudAssistantHost,
+				CustomConnect: map[string]multistep.Step{
+					CloudAssistantCommunicator: &stepConnectCloudAssistant{
+						RegionId:       b.config.AlicloudRegion,
+						CommandTimeout: b.config.CloudAssistantCommandTimeout,
+					},
+				},
+			})
+	} else {
+		provisionSteps = append(provisionSteps,
+			&stepAttachKeyPair{},
+			&stepRunAlicloudInstance{},
+			&communicator.StepConnect{
+				Config: &b.config.RunConfig.Comm,
+				Host: SSHHost(
+					client,
+					b.config.SSHPrivateIp),
+				SSHConfig: b.config.RunConfig.Comm.SSHConfigFunc(),
+			})
+	}
+	provisionSteps = append(provisionSteps,
 		&commonsteps.StepProvision{},
 		&commonsteps.StepCleanupTempKeys{
 			Comm: &b.config.RunConfig.Comm,
+		})
+	// 恢复构建时，已完成配置的实例不再重复启动和配置
+	steps = append(steps, skipIfCompleted(journalStageProvision, provisionSteps...)...)
+	steps = append(steps,
+		&stepCompleteStage{
+			Stage: journalStageProvision,
 		},
 		&stepStopAlicloudInstance{
 			ForceStop:   b.config.ForceStopInstance,
@@ -203,8 +294,7 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 			AlicloudImageForceDeleteSnapshots: b.config.AlicloudImageForceDeleteSnapshots,
 			AlicloudImageForceDelete:          b.config.AlicloudImageForceDelete,
 			AlicloudImageName:                 b.config.AlicloudImageName,
-			AlicloudImageDestinationRegions:   b.config.AlicloudImageConfig.AlicloudImageDestinationRegions,
-			AlicloudImageDestinationNames:     b.config.AlicloudImageConfig.AlicloudImageDestinationNames,
+			AlicloudImageCopyRegions:          b.config.AlicloudImageCopyRegions,
 		})
 
 	if b.config.AlicloudImageIgnoreDataDisks {
@@ -220,13 +310,14 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 				WaitSnapshotReadyTimeout:     b.getSnapshotReadyTimeout(),
 			},
 			&stepCreateTags{
-				Tags: b.config.AlicloudImageTags,
+				Tags: b.config.regionImageTags(b.config.AlicloudRegion),
 			},
 			&stepRegionCopyAlicloudImage{
-				AlicloudImageDestinationRegions: b.config.AlicloudImageDestinationRegions,
-				AlicloudImageDestinationNames:   b.config.AlicloudImageDestinationNames,
-				RegionId:                        b.config.AlicloudRegion,
-				WaitCopyingImageReadyTimeout:    b.getCopyingImageReadyTimeout(),
+				AlicloudImageCopyRegions:     b.config.AlicloudImageCopyRegions,
+				RegionId:                     b.config.AlicloudRegion,
+				WaitCopyingImageReadyTimeout: b.getCopyingImageReadyTimeout(),
+				WaitForCopiedImages:          b.config.WaitForCopiedImages,
+				Concurrency:                  b.config.ImageCopyConcurrency,
 			},
 			&stepShareAlicloudImage{
 				AlicloudImageShareAccounts:   b.config.AlicloudImageShareAccounts,
@@ -234,6 +325,13 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 				RegionId:                     b.config.AlicloudRegion,
 			})
 	}
+	return b.run(ctx, ui, state, steps)
+}
+
+func (b *Builder) run(ctx context.Context, ui packersdk.Ui, state multistep.StateBag, steps []multistep.Step) (packersdk.Artifact, error) {
+	client := state.Get("client").(*ClientWrapper)
+	journal := getJournal(state)
+
 	// Run!
 	b.runner = commonsteps.NewRunner(steps, b.config.PackerConfig, ui)
 	b.runner.Run(ctx, state)
@@ -244,9 +342,19 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 			ui.Say("Image exists, Skipping...")
 			return nil, nil
 		}
+		if journal != nil {
+			ui.Say(fmt.Sprintf("Build journal kept in %s, run the build again to resume it", b.config.JournalFile))
+		}
 		return nil, rawErr.(error)
 	}
 
+	// A cancelled build may be resumed as well
+	if _, cancelled := state.GetOk(multistep.StateCancelled); !cancelled {
+		if err := journal.Remove(); err != nil {
+			ui.Error(fmt.Sprintf("Error removing build journal %s: %s", b.config.JournalFile, err))
+		}
+	}
+
 	// If there are no ECS images, then just return
 	if _, ok := state.GetOk("alicloudimages"); !ok {
 		return nil, nil
@@ -256,8 +364,17 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 	artifact := &Artifact{
 		AlicloudImages: state.Get("alicloudimages").(map[string]string),
 		BuilderIdValue: BuilderId,
+		ImageFamily:    b.config.TargetImageFamily,
+		Tags:           b.config.AlicloudImageTags,
+		StateData:      map[string]interface{}{"generated_data": state.Get("generated_data")},
 		Client:         client,
 	}
+	if sourceImage, ok := state.GetOk("source_image"); ok {
+		artifact.SourceImageId = sourceImage.(*ecs.Image).ImageId
+	}
+	if instanceType, ok := state.GetOk("instance_type"); ok {
+		artifact.InstanceType = instanceType.(string)
+	}
 
 	return artifact, nil
 }
@@ -271,8 +388,9 @@ func (b *Builder) chooseNetworkType() InstanceNetWork {
 }
 
 func (b *Builder) isVpcNetRequired() bool {
-	// UserData and KeyPair only works in VPC
-	return b.isVpcSpecified() || b.isUserDataNeeded() || b.isKeyPairNeeded()
+	// UserData, KeyPair and Cloud Assistant only works in VPC
+	return b.isVpcSpecified() || b.isUserDataNeeded() || b.isKeyPairNeeded() ||
+		b.config.Comm.Type == CloudAssistantCommunicator
 }
 
 func (b *Builder) isVpcSpecified() bool {
@@ -4,9 +4,17 @@
 package ecs
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/vpc"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	helperconfig "github.com/hashicorp/packer-plugin-sdk/template/config"
 )
@@ -239,3 +247,736 @@ func TestBuilderPrepare_WaitSnapshotReadyTimeout(t *testing.T) {
 		t.Fatalf("default timeout is not set properly, expect: %d, actual: %d", ALICLOUD_DEFAULT_TIMEOUT, b.getSnapshotReadyTimeout())
 	}
 }
+
+func TestBuilderPrepare_GeneratedData(t *testing.T) {
+	var b Builder
+	config := testBuilderConfig()
+
+	generatedData, warnings, err := b.Prepare(config)
+	if len(warnings) > 0 {
+		t.Fatalf("bad: %#v", warnings)
+	}
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	for _, name := range []string{"SourceImage", "SourceImageName", "ZoneId", "VSwitchId", "InstanceId"} {
+		if !ContainsInArray(generatedData, name) {
+			t.Fatalf("generated data should contain %s, actual: %v", name, generatedData)
+		}
+	}
+}
+
+// testBuilderRun runs the builder against a fake API, without a communicator
+// unless the config selects one.
+func testBuilderRun(t *testing.T, api *fakeAlicloudAPI, config map[string]interface{}) (packersdk.Artifact, error) {
+	return testBuilderRunContext(context.Background(), t, api, config)
+}
+
+func testBuilderRunContext(ctx context.Context, t *testing.T, api *fakeAlicloudAPI, config map[string]interface{}) (packersdk.Artifact, error) {
+	if _, ok := config["communicator"]; !ok {
+		config["communicator"] = "none"
+	}
+	config["source_image"] = fakeAPISourceImage
+
+	var b Builder
+	_, warnings, err := b.Prepare(config)
+	if len(warnings) > 0 {
+		t.Fatalf("bad: %#v", warnings)
+	}
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	api.Attach(t, &b.config.AlicloudAccessConfig)
+
+	return b.Run(ctx, packersdk.TestUi(t), &packersdk.MockHook{})
+}
+
+func TestBuilderRun(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	config := testBuilderConfig()
+	config["associate_public_ip_address"] = true
+	config["tags"] = map[string]string{"Project": "packer"}
+
+	artifact, err := testBuilderRun(t, api, config)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	imageId, ok := artifact.(*Artifact).AlicloudImages[fakeAPIRegion]
+	if !ok {
+		t.Fatalf("artifact should contain an image in %s, actual: %v", fakeAPIRegion, artifact.(*Artifact).AlicloudImages)
+	}
+	image, ok := api.Image(imageId)
+	if !ok || image.Image.ImageName != "foo" {
+		t.Fatalf("image %s should have been created with name foo", imageId)
+	}
+	if tags := api.Tags(imageId); tags["Project"] != "packer" {
+		t.Fatalf("image should have been tagged, actual: %v", tags)
+	}
+	if leftovers := api.Leftovers(); len(leftovers) > 0 {
+		t.Fatalf("temporary resources should have been deleted, actual: %v", leftovers)
+	}
+}
+
+func TestBuilderRun_CloudAssistant(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	config := testBuilderConfig()
+	config["communicator"] = CloudAssistantCommunicator
+
+	if _, err := testBuilderRun(t, api, config); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	if api.Called("DescribeCloudAssistantStatus") == 0 {
+		t.Fatalf("the Cloud Assistant agent should have been waited for, actions: %v", api.Actions())
+	}
+	for _, action := range []string{"CreateKeyPair", "AttachKeyPair", "AllocateEipAddress", "AllocatePublicIpAddress", "AuthorizeSecurityGroup"} {
+		if api.Called(action) > 0 {
+			t.Fatalf("%s should not have been called, actions: %v", action, api.Actions())
+		}
+	}
+	if leftovers := api.Leftovers(); len(leftovers) > 0 {
+		t.Fatalf("temporary resources should have been deleted, actual: %v", leftovers)
+	}
+}
+
+func TestBuilderRun_ImageFamily(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	config := testBuilderConfig()
+	config["image_copy_regions"] = []string{"cn-hangzhou"}
+	config["target_image_family"] = "web-server"
+	config["image_boot_mode"] = ImageBootModeUEFI
+	config["image_architecture"] = ImageArchitectureArm64
+	config["image_nvme_support"] = true
+
+	artifact, err := testBuilderRun(t, api, config)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	if family := artifact.(*Artifact).ImageFamily; family != "web-server" {
+		t.Fatalf("bad: artifact should report the target image family, actual %q", family)
+	}
+	images := artifact.(*Artifact).AlicloudImages
+	for _, regionId := range []string{fakeAPIRegion, "cn-hangzhou"} {
+		image, ok := api.Image(images[regionId])
+		if !ok {
+			t.Fatalf("an image should have been created in %s, actual: %v", regionId, images)
+		}
+		if image.Image.ImageFamily != "web-server" || image.BootMode != ImageBootModeUEFI || image.NvmeSupport != ImageNvmeSupported {
+			t.Fatalf("bad: image %s in %s should have the family and features, actual: %+v", image.Image.ImageId, regionId, image)
+		}
+	}
+	if image, _ := api.Image(images[fakeAPIRegion]); image.Image.Architecture != ImageArchitectureArm64 {
+		t.Fatalf("bad: expected architecture %s, actual %s", ImageArchitectureArm64, image.Image.Architecture)
+	}
+}
+
+func TestBuilderRun_CopyRegions(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	config := testBuilderConfig()
+	config["image_copy_region"] = []map[string]interface{}{
+		{"region": "cn-hangzhou", "name": "foo-hz"},
+		{"region": "cn-shanghai", "name": "foo-sh"},
+	}
+	config["wait_for_copied_images"] = true
+
+	artifact, err := testBuilderRun(t, api, config)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	images := artifact.(*Artifact).AlicloudImages
+	for regionId, imageName := range map[string]string{"cn-hangzhou": "foo-hz", "cn-shanghai": "foo-sh"} {
+		image, ok := api.Image(images[regionId])
+		if !ok {
+			t.Fatalf("an image should have been copied to %s, actual: %v", regionId, images)
+		}
+		if image.Image.ImageName != imageName {
+			t.Fatalf("bad: expected image name %s in %s, actual %s", imageName, regionId, image.Image.ImageName)
+		}
+	}
+}
+
+func TestBuilderRun_CopyRegionsFailed(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	api.FailedCopies = []string{"cn-shanghai"}
+	config := testBuilderConfig()
+	config["image_copy_region"] = []map[string]interface{}{
+		{"region": "cn-hangzhou"},
+		{"region": "cn-shanghai"},
+	}
+	config["wait_for_copied_images"] = true
+
+	_, err := testBuilderRun(t, api, config)
+	if err == nil || !strings.Contains(err.Error(), "cn-shanghai") {
+		t.Fatalf("should have error for cn-shanghai, actual: %v", err)
+	}
+	if api.Called("CopyImage") != 2 || api.Called("CancelCopyImage") == 0 {
+		t.Fatalf("the copies should have been cancelled, actions: %v", api.Actions())
+	}
+}
+
+func TestBuilderRun_KMSKeys(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	api.KMSKeys = map[string]map[string]string{
+		fakeAPIRegion: {"key-disk": KMSKeyStateEnabled, "key-image": KMSKeyStateEnabled},
+		"cn-hangzhou": {"key-hangzhou": KMSKeyStateEnabled},
+	}
+	config := testBuilderConfig()
+	config["system_disk_mapping"] = map[string]interface{}{"disk_encrypted": true, "disk_kms_key_id": "key-disk"}
+	config["image_disk_mappings"] = []map[string]interface{}{
+		{"disk_size": 20, "disk_category": "cloud_efficiency", "disk_encrypted": true, "disk_kms_key_id": "key-disk"},
+	}
+	config["image_encrypted"] = true
+	config["image_kms_key_id"] = "key-image"
+	config["image_copy_region"] = []map[string]interface{}{{"region": "cn-hangzhou", "kms_key_id": "key-hangzhou"}}
+
+	artifact, err := testBuilderRun(t, api, config)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	createInstance := api.Requests("CreateInstance")[0]
+	for _, name := range []string{"SystemDisk.KMSKeyId", "DataDisk.1.KMSKeyId"} {
+		if createInstance.Get(name) != "key-disk" {
+			t.Fatalf("bad: expected %s key-disk, actual %q", name, createInstance.Get(name))
+		}
+	}
+	if createInstance.Get("SystemDisk.Encrypted") != "true" {
+		t.Fatalf("bad: the system disk should be encrypted, actual %q", createInstance.Get("SystemDisk.Encrypted"))
+	}
+
+	images := artifact.(*Artifact).AlicloudImages
+	for regionId, keyId := range map[string]string{fakeAPIRegion: "key-image", "cn-hangzhou": "key-hangzhou"} {
+		image, ok := api.Image(images[regionId])
+		if !ok {
+			t.Fatalf("an image should have been created in %s, actual: %v", regionId, images)
+		}
+		if image.KMSKeyId != keyId {
+			t.Fatalf("bad: image in %s should be encrypted with %s, actual %q", regionId, keyId, image.KMSKeyId)
+		}
+	}
+}
+
+func TestBuilderRun_KMSKeyNotFound(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	api.KMSKeys = map[string]map[string]string{
+		fakeAPIRegion: {"key-image": "Disabled"},
+	}
+	config := testBuilderConfig()
+	config["image_encrypted"] = true
+	config["image_kms_key_id"] = "key-image"
+	config["image_copy_region"] = []map[string]interface{}{{"region": "cn-hangzhou", "kms_key_id": "key-hangzhou"}}
+
+	_, err := testBuilderRun(t, api, config)
+	if err == nil || !strings.Contains(err.Error(), "key-image") || !strings.Contains(err.Error(), "key-hangzhou") {
+		t.Fatalf("should have error for both keys, actual: %v", err)
+	}
+	if api.Called("CreateInstance") > 0 {
+		t.Fatalf("the keys should have been validated before creating the instance, actions: %v", api.Actions())
+	}
+}
+
+func TestBuilderRun_CleanupOnError(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	api.Failures["CreateImage"] = fakeAPIError{"QuotaExceed.Image", "The image quota is exceeded."}
+	config := testBuilderConfig()
+	config["associate_public_ip_address"] = true
+
+	if _, err := testBuilderRun(t, api, config); err == nil {
+		t.Fatal("should have error")
+	}
+
+	if api.Called("CreateInstance") != 1 {
+		t.Fatalf("an instance should have been created, actions: %v", api.Actions())
+	}
+	if leftovers := api.Leftovers(); len(leftovers) > 0 {
+		t.Fatalf("temporary resources should have been deleted, actual: %v", leftovers)
+	}
+}
+
+func TestBuilderRun_CancelWhileCreatingImage(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	api.Hooks["CreateImage"] = cancel
+
+	if _, err := testBuilderRunContext(ctx, t, api, testBuilderConfig()); err == nil {
+		t.Fatal("should have error")
+	}
+
+	if api.Called("CreateImage") != 1 || api.Called("DeleteImage") != 1 {
+		t.Fatalf("the image should have been created then deleted, actions: %v", api.Actions())
+	}
+	if api.Called("DeleteSnapshot") == 0 {
+		t.Fatalf("the snapshots of the image should have been deleted, actions: %v", api.Actions())
+	}
+	if leftovers := api.Leftovers(); len(leftovers) > 0 {
+		t.Fatalf("temporary resources should have been deleted, actual: %v", leftovers)
+	}
+}
+
+func TestBuilderRun_SpotFallback(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	api.NoSpotStock = true
+	config := testBuilderConfig()
+	config["spot_strategy"] = SpotStrategyAsPriceGo
+	config["spot_duration"] = 0
+
+	if _, err := testBuilderRun(t, api, config); err != nil {
+		t.Fatalf("should fall back to a pay-as-you-go instance: %s", err)
+	}
+
+	// A spot attempt in the temporary vswitch, then a pay-as-you-go instance.
+	if calls := api.Called("CreateInstance"); calls != 2 {
+		t.Fatalf("bad: expected 2 instance creations, actual %d", calls)
+	}
+	// spot_duration = 0 is sent, otherwise the API protects the instance for
+	// an hour.
+	if duration := api.Requests("CreateInstance")[0].Get("SpotDuration"); duration != "0" {
+		t.Fatalf("bad: expected spot duration 0, actual %q", duration)
+	}
+	if leftovers := api.Leftovers(); len(leftovers) > 0 {
+		t.Fatalf("temporary resources should have been deleted, actual: %v", leftovers)
+	}
+}
+
+func TestBuilderRun_SpotNoFallbackOnError(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	api.Failures["CreateInstance"] = fakeAPIError{"InvalidSpotPriceLimit.LowerThanPublicPrice", "The specified spot price limit is lower than the public price."}
+	config := testBuilderConfig()
+	config["spot_strategy"] = SpotStrategyWithPriceLimit
+	config["spot_price_limit"] = 0.01
+
+	if _, err := testBuilderRun(t, api, config); err == nil {
+		t.Fatal("should have error")
+	}
+
+	// Only the spot instance is tried, without falling back to pay-as-you-go.
+	if calls := api.Called("CreateInstance"); calls != 1 {
+		t.Fatalf("bad: expected 1 instance creation, actual %d", calls)
+	}
+	if leftovers := api.Leftovers(); len(leftovers) > 0 {
+		t.Fatalf("temporary resources should have been deleted, actual: %v", leftovers)
+	}
+}
+
+func TestBuilderRun_InstanceTypes(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	api.SoldOut = []string{"ecs.g6.large"}
+	config := testBuilderConfig()
+	delete(config, "instance_type")
+	config["instance_types"] = []string{"ecs.g6.large", "ecs.g5.large"}
+
+	artifact, err := testBuilderRun(t, api, config)
+	if err != nil {
+		t.Fatalf("should fall back to the next instance type: %s", err)
+	}
+	if instanceType := artifact.(*Artifact).InstanceType; instanceType != "ecs.g5.large" {
+		t.Fatalf("bad: expected instance type ecs.g5.large, actual %s", instanceType)
+	}
+	// The sold out instance type is skipped without trying to create it.
+	if calls := api.Called("CreateInstance"); calls != 1 {
+		t.Fatalf("bad: expected 1 instance creation, actual %d", calls)
+	}
+
+	api = newFakeAlicloudAPI(t)
+	api.SoldOut = []string{"ecs.g6.large", "ecs.g5.large"}
+	if _, err := testBuilderRun(t, api, config); err == nil {
+		t.Fatal("should have error when all the instance types are sold out")
+	}
+}
+
+func TestBuilderRun_Resume(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	api.Failures["CreateImage"] = fakeAPIError{"QuotaExceed.Image", "The image quota is exceeded."}
+	config := testBuilderConfig()
+	config["associate_public_ip_address"] = true
+	config["resume"] = true
+	config["journal_file"] = filepath.Join(t.TempDir(), "journal.json")
+
+	if _, err := testBuilderRun(t, api, config); err == nil {
+		t.Fatal("should have error")
+	}
+
+	// The resources are kept and recorded for the next run.
+	if leftovers := api.Leftovers(); len(leftovers) != 6 {
+		t.Fatalf("temporary resources should have been kept, actual: %v", leftovers)
+	}
+	journal, err := loadBuildJournal(config["journal_file"].(string))
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	for _, kind := range []string{journalVpc, journalVSwitch, journalSecurityGroup, journalKeyPair, journalInstance, journalEip} {
+		if journal.Resource(kind) == "" {
+			t.Fatalf("journal should record the %s, actual: %v", kind, journal.Resources)
+		}
+	}
+	if !journal.Completed(journalStageProvision) {
+		t.Fatalf("journal should record the provisioning, actual: %v", journal.CompletedStages)
+	}
+
+	delete(api.Failures, "CreateImage")
+	artifact, err := testBuilderRun(t, api, config)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	if _, ok := artifact.(*Artifact).AlicloudImages[fakeAPIRegion]; !ok {
+		t.Fatalf("artifact should contain an image in %s, actual: %v", fakeAPIRegion, artifact.(*Artifact).AlicloudImages)
+	}
+	for _, action := range []string{"CreateVpc", "CreateVSwitch", "CreateSecurityGroup", "CreateKeyPair", "CreateInstance", "AllocateEipAddress", "StartInstance"} {
+		if calls := api.Called(action); calls != 1 {
+			t.Fatalf("bad: expected 1 call to %s, actual %d", action, calls)
+		}
+	}
+	if leftovers := api.Leftovers(); len(leftovers) > 0 {
+		t.Fatalf("temporary resources should have been deleted, actual: %v", leftovers)
+	}
+	if _, err := os.Stat(config["journal_file"].(string)); !os.IsNotExist(err) {
+		t.Fatalf("journal should have been removed: %v", err)
+	}
+}
+
+func TestBuilderRun_ResumeRunningInstance(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	api.Failures["CreateImage"] = fakeAPIError{"QuotaExceed.Image", "The image quota is exceeded."}
+	config := testBuilderConfig()
+	config["resume"] = true
+	config["journal_file"] = filepath.Join(t.TempDir(), "journal.json")
+
+	if _, err := testBuilderRun(t, api, config); err == nil {
+		t.Fatal("should have error")
+	}
+
+	journal, err := loadBuildJournal(config["journal_file"].(string))
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	instanceId := journal.Resource(journalInstance)
+	if instanceId == "" {
+		t.Fatalf("journal should record the instance, actual: %v", journal.Resources)
+	}
+
+	// The build was killed while provisioning the running instance.
+	journal.CompletedStages = nil
+	if err := journal.save(); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	api.SetInstanceStatus(instanceId, InstanceStatusRunning)
+
+	delete(api.Failures, "CreateImage")
+	if _, err := testBuilderRun(t, api, config); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if calls := api.Called("StartInstance"); calls != 1 {
+		t.Fatalf("the running instance should not be started again, StartInstance calls: %d", calls)
+	}
+	if leftovers := api.Leftovers(); len(leftovers) > 0 {
+		t.Fatalf("temporary resources should have been deleted, actual: %v", leftovers)
+	}
+}
+
+func TestBuilderRun_ResumeSSH(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	api.Failures["CreateImage"] = fakeAPIError{"QuotaExceed.Image", "The image quota is exceeded."}
+	config := testBuilderConfig()
+	config["communicator"] = "ssh"
+	config["ssh_port"] = api.ServeSSH(t)
+	config["ssh_timeout"] = "10s"
+	config["temporary_security_group_source_cidrs"] = []string{"127.0.0.1/32"}
+	config["associate_public_ip_address"] = true
+	config["resume"] = true
+	config["journal_file"] = filepath.Join(t.TempDir(), "journal.json")
+
+	if _, err := testBuilderRun(t, api, config); err == nil {
+		t.Fatal("should have error")
+	}
+
+	journal, err := loadBuildJournal(config["journal_file"].(string))
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if journal.Resource(journalKeyPair) == "" || journal.PrivateKey == "" || journal.Resource(journalInstance) == "" {
+		t.Fatalf("journal should record the key pair and the instance, actual: %v", journal.Resources)
+	}
+
+	// The build was killed while provisioning the running instance, which
+	// only accepts the key pair it was started with.
+	journal.CompletedStages = nil
+	if err := journal.save(); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	api.SetInstanceStatus(journal.Resource(journalInstance), InstanceStatusRunning)
+
+	delete(api.Failures, "CreateImage")
+	if _, err := testBuilderRun(t, api, config); err != nil {
+		t.Fatalf("should connect with the recorded key pair: %s", err)
+	}
+	if calls := api.Called("CreateKeyPair"); calls != 1 {
+		t.Fatalf("the recorded key pair should be reused, CreateKeyPair calls: %d", calls)
+	}
+	if leftovers := api.Leftovers(); len(leftovers) > 0 {
+		t.Fatalf("temporary resources should have been deleted, actual: %v", leftovers)
+	}
+}
+
+func TestBuilderRun_DryRun(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	config := testBuilderConfig()
+	config["dry_run"] = true
+
+	artifact, err := testBuilderRun(t, api, config)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if artifact != nil {
+		t.Fatalf("dry run should not create an artifact, actual: %v", artifact)
+	}
+	for _, action := range []string{"CreateKeyPair", "CreateVpc", "CreateVSwitch", "CreateSecurityGroup", "CreateInstance"} {
+		if calls := api.Called(action); calls != 0 {
+			t.Fatalf("dry run should not call %s, actions: %v", action, api.Actions())
+		}
+	}
+
+	// With an existing network, the instance creation is dry-run.
+	client, vpcClient := api.Clients(t)
+	createVpcRequest := ecs.CreateCreateVpcRequest()
+	createVpcRequest.CidrBlock = DefaultCidrBlock
+	createVpcResponse, err := client.CreateVpc(createVpcRequest)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	createVSwitchRequest := vpc.CreateCreateVSwitchRequest()
+	createVSwitchRequest.VpcId = createVpcResponse.VpcId
+	createVSwitchRequest.ZoneId = api.Zones[0]
+	createVSwitchResponse, err := vpcClient.CreateVSwitch(createVSwitchRequest)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	createSecurityGroupRequest := ecs.CreateCreateSecurityGroupRequest()
+	createSecurityGroupRequest.VpcId = createVpcResponse.VpcId
+	createSecurityGroupResponse, err := client.CreateSecurityGroup(createSecurityGroupRequest)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	config = testBuilderConfig()
+	config["dry_run"] = true
+	config["vpc_id"] = createVpcResponse.VpcId
+	config["vswitch_id"] = createVSwitchResponse.VSwitchId
+	config["security_group_id"] = createSecurityGroupResponse.SecurityGroupId
+	if _, err := testBuilderRun(t, api, config); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if calls := api.Called("CreateInstance"); calls != 1 {
+		t.Fatalf("bad: expected 1 dry run instance creation, actual %d", calls)
+	}
+
+	config["security_group_id"] = "sg-missing"
+	if _, err := testBuilderRun(t, api, config); err == nil {
+		t.Fatal("should have error with a missing security group")
+	}
+
+	api.SoldOut = []string{"ecs.n1.tiny"}
+	config["security_group_id"] = createSecurityGroupResponse.SecurityGroupId
+	if _, err := testBuilderRun(t, api, config); err == nil {
+		t.Fatal("should have error with a sold out instance type")
+	}
+}
+
+func TestBuilderRun_Sweep(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	client, vpcClient := api.Clients(t)
+	ownership := map[string]string{BuildOwnershipTagKey: "build-uuid"}
+
+	createVpcRequest := ecs.CreateCreateVpcRequest()
+	createVpcRequest.CidrBlock = DefaultCidrBlock
+	createVpcResponse, err := client.CreateVpc(createVpcRequest)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	createVSwitchRequest := vpc.CreateCreateVSwitchRequest()
+	createVSwitchRequest.VpcId = createVpcResponse.VpcId
+	createVSwitchRequest.ZoneId = api.Zones[0]
+	createVSwitchResponse, err := vpcClient.CreateVSwitch(createVSwitchRequest)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	createSecurityGroupRequest := ecs.CreateCreateSecurityGroupRequest()
+	createSecurityGroupRequest.VpcId = createVpcResponse.VpcId
+	createSecurityGroupResponse, err := client.CreateSecurityGroup(createSecurityGroupRequest)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	createInstanceRequest := ecs.CreateCreateInstanceRequest()
+	createInstanceRequest.ImageId = fakeAPISourceImage
+	createInstanceRequest.SecurityGroupId = createSecurityGroupResponse.SecurityGroupId
+	createInstanceRequest.VSwitchId = createVSwitchResponse.VSwitchId
+	createInstanceResponse, err := client.CreateInstance(createInstanceRequest)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	allocateEipAddressResponse, err := client.AllocateEipAddress(ecs.CreateAllocateEipAddressRequest())
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	associateEipAddressRequest := ecs.CreateAssociateEipAddressRequest()
+	associateEipAddressRequest.AllocationId = allocateEipAddressResponse.AllocationId
+	associateEipAddressRequest.InstanceId = createInstanceResponse.InstanceId
+	if _, err := client.AssociateEipAddress(associateEipAddressRequest); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	createKeyPairRequest := ecs.CreateCreateKeyPairRequest()
+	createKeyPairRequest.KeyPairName = "packer_orphaned"
+	if _, err := client.CreateKeyPair(createKeyPairRequest); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	for _, resourceId := range []string{
+		createVpcResponse.VpcId,
+		createVSwitchResponse.VSwitchId,
+		createSecurityGroupResponse.SecurityGroupId,
+		createInstanceResponse.InstanceId,
+		allocateEipAddressResponse.AllocationId,
+		"packer_orphaned",
+	} {
+		api.Tag(resourceId, ownership)
+		api.Backdate(resourceId, 48*time.Hour)
+	}
+
+	// Neither a resource without the ownership tag nor a recent one is swept.
+	untaggedVpcResponse, err := client.CreateVpc(createVpcRequest)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	api.Backdate(untaggedVpcResponse.VpcId, 48*time.Hour)
+	recentSecurityGroupResponse, err := client.CreateSecurityGroup(ecs.CreateCreateSecurityGroupRequest())
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	api.Tag(recentSecurityGroupResponse.SecurityGroupId, ownership)
+
+	config := testBuilderConfig()
+	config["sweep"] = true
+	config["dry_run"] = true
+	if _, err := testBuilderRun(t, api, config); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if leftovers := api.Leftovers(); len(leftovers) != 8 {
+		t.Fatalf("dry run should not delete anything, leftovers: %v", leftovers)
+	}
+
+	config = map[string]interface{}{
+		"access_key":       "foo",
+		"secret_key":       "bar",
+		"region":           "cn-beijing",
+		"sweep":            true,
+		"sweep_older_than": "24h",
+	}
+	if _, err := testBuilderRun(t, api, config); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	expected := []string{
+		"vpc " + untaggedVpcResponse.VpcId,
+		"security group " + recentSecurityGroupResponse.SecurityGroupId,
+	}
+	leftovers := api.Leftovers()
+	sort.Strings(expected)
+	sort.Strings(leftovers)
+	if !reflect.DeepEqual(leftovers, expected) {
+		t.Fatalf("bad: expected leftovers %v, actual %v", expected, leftovers)
+	}
+}
+
+func TestBuilderRun_SweepInterruptedBuild(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	api.Failures["CreateImage"] = fakeAPIError{"QuotaExceed.Image", "The image quota is exceeded."}
+	config := testBuilderConfig()
+	config["associate_public_ip_address"] = true
+	config["resume"] = true
+	config["journal_file"] = filepath.Join(t.TempDir(), "journal.json")
+
+	// The resources of the failed build are kept, as those of a killed one.
+	if _, err := testBuilderRun(t, api, config); err == nil {
+		t.Fatal("should have error")
+	}
+	leftovers := api.Leftovers()
+	if len(leftovers) == 0 {
+		t.Fatal("temporary resources should have been kept")
+	}
+	for _, leftover := range leftovers {
+		fields := strings.Fields(leftover)
+		api.Backdate(fields[len(fields)-1], 48*time.Hour)
+	}
+
+	config = map[string]interface{}{
+		"access_key": "foo",
+		"secret_key": "bar",
+		"region":     "cn-beijing",
+		"sweep":      true,
+	}
+	if _, err := testBuilderRun(t, api, config); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if leftovers := api.Leftovers(); len(leftovers) > 0 {
+		t.Fatalf("the resources of the build should have been swept, actual: %v", leftovers)
+	}
+}
+
+func TestBuilderRun_TemporaryResourceTags(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	config := testBuilderConfig()
+	config["associate_public_ip_address"] = true
+	config["temporary_resource_tags"] = map[string]string{"Team": "infra"}
+	config["run_tags"] = map[string]string{"Team": "build"}
+	config["packer_build_name"] = "tagged"
+
+	if _, err := testBuilderRun(t, api, config); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	tagged := api.Tagged(BuildOwnershipTagKey)
+	var kinds []string
+	buildUUID := ""
+	for resourceId, tags := range tagged {
+		kind := strings.SplitN(resourceId, "-", 2)[0]
+		if strings.HasPrefix(resourceId, "packer_") {
+			kind = "keypair"
+		}
+		kinds = append(kinds, kind)
+
+		expectedTeam := "infra"
+		if kind == "i" || kind == "d" {
+			expectedTeam = "build"
+		}
+		if tags["Team"] != expectedTeam {
+			t.Fatalf("bad: expected %s tag Team=%s, actual %v", resourceId, expectedTeam, tags)
+		}
+		if tags[BuildNameTagKey] != "tagged" || tags[BuildCreationTimeTagKey] == "" || tags[BuildPluginVersionTagKey] == "" {
+			t.Fatalf("%s should have been tagged with the build, actual: %v", resourceId, tags)
+		}
+		if buildUUID != "" && tags[BuildOwnershipTagKey] != buildUUID {
+			t.Fatalf("bad: resources tagged with different builds %s and %s", buildUUID, tags[BuildOwnershipTagKey])
+		}
+		buildUUID = tags[BuildOwnershipTagKey]
+	}
+
+	sort.Strings(kinds)
+	expected := []string{"d", "eip", "i", "keypair", "sg", "vpc", "vsw"}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Fatalf("bad: expected tagged resources %v, actual %v", expected, kinds)
+	}
+
+	// The resources are tagged when they are created, not afterwards.
+	if calls := api.Called("TagResources"); calls != 0 {
+		t.Fatalf("bad: expected no call to TagResources, actual %d", calls)
+	}
+	for _, form := range api.Requests("AddTags") {
+		if form.Get("ResourceType") == TagResourceDisk {
+			t.Fatalf("the disks should have been tagged with the instance, actions: %v", api.Actions())
+		}
+	}
+}
@@ -4,21 +4,142 @@
 package ecs
 
 import (
+	"context"
+	stderrors "errors"
 	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/vpc"
+	"golang.org/x/time/rate"
 )
 
+// ECSClient is the subset of the ECS API used by this plugin. It is
+// implemented by *ecs.Client, and can be replaced by a fake in tests.
+type ECSClient interface {
+	AddTags(request *ecs.AddTagsRequest) (response *ecs.AddTagsResponse, err error)
+	AllocateEipAddress(request *ecs.AllocateEipAddressRequest) (response *ecs.AllocateEipAddressResponse, err error)
+	AllocatePublicIpAddress(request *ecs.AllocatePublicIpAddressRequest) (response *ecs.AllocatePublicIpAddressResponse, err error)
+	AssociateEipAddress(request *ecs.AssociateEipAddressRequest) (response *ecs.AssociateEipAddressResponse, err error)
+	AttachKeyPair(request *ecs.AttachKeyPairRequest) (response *ecs.AttachKeyPairResponse, err error)
+	AuthorizeSecurityGroup(request *ecs.AuthorizeSecurityGroupRequest) (response *ecs.AuthorizeSecurityGroupResponse, err error)
+	AuthorizeSecurityGroupEgress(request *ecs.AuthorizeSecurityGroupEgressRequest) (response *ecs.AuthorizeSecurityGroupEgressResponse, err error)
+	CancelCopyImage(request *ecs.CancelCopyImageRequest) (response *ecs.CancelCopyImageResponse, err error)
+	CopyImage(request *ecs.CopyImageRequest) (response *ecs.CopyImageResponse, err error)
+	CreateImage(request *ecs.CreateImageRequest) (response *ecs.CreateImageResponse, err error)
+	CreateInstance(request *ecs.CreateInstanceRequest) (response *ecs.CreateInstanceResponse, err error)
+	CreateKeyPair(request *ecs.CreateKeyPairRequest) (response *ecs.CreateKeyPairResponse, err error)
+	CreateSecurityGroup(request *ecs.CreateSecurityGroupRequest) (response *ecs.CreateSecurityGroupResponse, err error)
+	CreateSnapshot(request *ecs.CreateSnapshotRequest) (response *ecs.CreateSnapshotResponse, err error)
+	CreateVpc(request *ecs.CreateVpcRequest) (response *ecs.CreateVpcResponse, err error)
+	DeleteImage(request *ecs.DeleteImageRequest) (response *ecs.DeleteImageResponse, err error)
+	DeleteInstance(request *ecs.DeleteInstanceRequest) (response *ecs.DeleteInstanceResponse, err error)
+	DeleteKeyPairs(request *ecs.DeleteKeyPairsRequest) (response *ecs.DeleteKeyPairsResponse, err error)
+	DeleteSecurityGroup(request *ecs.DeleteSecurityGroupRequest) (response *ecs.DeleteSecurityGroupResponse, err error)
+	DeleteSnapshot(request *ecs.DeleteSnapshotRequest) (response *ecs.DeleteSnapshotResponse, err error)
+	DeleteVSwitch(request *ecs.DeleteVSwitchRequest) (response *ecs.DeleteVSwitchResponse, err error)
+	DeleteVpc(request *ecs.DeleteVpcRequest) (response *ecs.DeleteVpcResponse, err error)
+	DescribeAvailableResource(request *ecs.DescribeAvailableResourceRequest) (response *ecs.DescribeAvailableResourceResponse, err error)
+	DescribeCloudAssistantStatus(request *ecs.DescribeCloudAssistantStatusRequest) (response *ecs.DescribeCloudAssistantStatusResponse, err error)
+	DescribeDisks(request *ecs.DescribeDisksRequest) (response *ecs.DescribeDisksResponse, err error)
+	DescribeEipAddresses(request *ecs.DescribeEipAddressesRequest) (response *ecs.DescribeEipAddressesResponse, err error)
+	DescribeImageFromFamily(request *ecs.DescribeImageFromFamilyRequest) (response *ecs.DescribeImageFromFamilyResponse, err error)
+	DescribeImageSharePermission(request *ecs.DescribeImageSharePermissionRequest) (response *ecs.DescribeImageSharePermissionResponse, err error)
+	DescribeImages(request *ecs.DescribeImagesRequest) (response *ecs.DescribeImagesResponse, err error)
+	DescribeInstances(request *ecs.DescribeInstancesRequest) (response *ecs.DescribeInstancesResponse, err error)
+	DescribeInvocationResults(request *ecs.DescribeInvocationResultsRequest) (response *ecs.DescribeInvocationResultsResponse, err error)
+	DescribeKeyPairs(request *ecs.DescribeKeyPairsRequest) (response *ecs.DescribeKeyPairsResponse, err error)
+	DescribeRegions(request *ecs.DescribeRegionsRequest) (response *ecs.DescribeRegionsResponse, err error)
+	DescribeSecurityGroups(request *ecs.DescribeSecurityGroupsRequest) (response *ecs.DescribeSecurityGroupsResponse, err error)
+	DescribeSnapshots(request *ecs.DescribeSnapshotsRequest) (response *ecs.DescribeSnapshotsResponse, err error)
+	DescribeTags(request *ecs.DescribeTagsRequest) (response *ecs.DescribeTagsResponse, err error)
+	DescribeTaskAttribute(request *ecs.DescribeTaskAttributeRequest) (response *ecs.DescribeTaskAttributeResponse, err error)
+	DescribeVpcs(request *ecs.DescribeVpcsRequest) (response *ecs.DescribeVpcsResponse, err error)
+	DetachKeyPair(request *ecs.DetachKeyPairRequest) (response *ecs.DetachKeyPairResponse, err error)
+	ExportImage(request *ecs.ExportImageRequest) (response *ecs.ExportImageResponse, err error)
+	ImportImage(request *ecs.ImportImageRequest) (response *ecs.ImportImageResponse, err error)
+	ModifyImageAttribute(request *ecs.ModifyImageAttributeRequest) (response *ecs.ModifyImageAttributeResponse, err error)
+	ModifyImageSharePermission(request *ecs.ModifyImageSharePermissionRequest) (response *ecs.ModifyImageSharePermissionResponse, err error)
+	ReleaseEipAddress(request *ecs.ReleaseEipAddressRequest) (response *ecs.ReleaseEipAddressResponse, err error)
+	RunCommand(request *ecs.RunCommandRequest) (response *ecs.RunCommandResponse, err error)
+	StartInstance(request *ecs.StartInstanceRequest) (response *ecs.StartInstanceResponse, err error)
+	StopInstance(request *ecs.StopInstanceRequest) (response *ecs.StopInstanceResponse, err error)
+	UnassociateEipAddress(request *ecs.UnassociateEipAddressRequest) (response *ecs.UnassociateEipAddressResponse, err error)
+}
+
+// VPCClient is the subset of the VPC API used by this plugin. It is
+// implemented by *vpc.Client, and can be replaced by a fake in tests.
+type VPCClient interface {
+	CreateVSwitch(request *vpc.CreateVSwitchRequest) (response *vpc.CreateVSwitchResponse, err error)
+	DescribeEipAddresses(request *vpc.DescribeEipAddressesRequest) (response *vpc.DescribeEipAddressesResponse, err error)
+	DescribeVSwitches(request *vpc.DescribeVSwitchesRequest) (response *vpc.DescribeVSwitchesResponse, err error)
+	DescribeVpcs(request *vpc.DescribeVpcsRequest) (response *vpc.DescribeVpcsResponse, err error)
+}
+
+var (
+	_ ECSClient = (*ecs.Client)(nil)
+	_ VPCClient = (*vpc.Client)(nil)
+)
+
+var (
+	apiRateLimiterMutex sync.Mutex
+	apiRateLimiter      *rate.Limiter
+)
+
+// sharedAPIRateLimiter returns the limiter shared by all the clients of the
+// process, updated to the given rate in requests per second.
+func sharedAPIRateLimiter(limit float64) *rate.Limiter {
+	apiRateLimiterMutex.Lock()
+	defer apiRateLimiterMutex.Unlock()
+
+	burst := int(math.Ceil(limit))
+	if apiRateLimiter == nil {
+		apiRateLimiter = rate.NewLimiter(rate.Limit(limit), burst)
+	} else {
+		apiRateLimiter.SetLimit(rate.Limit(limit))
+		apiRateLimiter.SetBurst(burst)
+	}
+	return apiRateLimiter
+}
+
+// rateLimitedTransport delays the requests going through it so that they do
+// not exceed the rate of its limiter.
+type rateLimitedTransport struct {
+	limiter   *rate.Limiter
+	transport http.RoundTripper
+}
+
+func newRateLimitedTransport(limit float64) *rateLimitedTransport {
+	return &rateLimitedTransport{
+		limiter: sharedAPIRateLimiter(limit),
+		transport: &http.Transport{
+			Proxy:       http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{Timeout: DefaultRequestConnectTimeout}).DialContext,
+		},
+	}
+}
+
+func (t *rateLimitedTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(request.Context()); err != nil {
+		return nil, err
+	}
+	return t.transport.RoundTrip(request)
+}
+
 type ClientWrapper struct {
-	*ecs.Client
+	ECSClient
 }
 
 type VPCClientWrapper struct {
-	*vpc.Client
+	VPCClient
 }
 
 const (
@@ -33,8 +154,12 @@ const (
 	ImageStatusCreating     = "Creating"
 	ImageStatusCreateFailed = "CreateFailed"
 	ImageStatusAvailable    = "Available"
+	ImageStatusDeprecated   = "Deprecated"
 )
 
+// The state of the KMS keys which can encrypt disks and images.
+const KMSKeyStateEnabled = "Enabled"
+
 var ImageStatusQueried = fmt.Sprintf("%s,%s,%s,%s", ImageStatusWaiting, ImageStatusCreating, ImageStatusCreateFailed, ImageStatusAvailable)
 
 const (
@@ -77,6 +202,22 @@ const (
 	ImageOwnerMarketplace = "marketplace"
 )
 
+const (
+	ImageBootModeBIOS = "BIOS"
+	ImageBootModeUEFI = "UEFI"
+)
+
+const (
+	ImageArchitectureI386   = "i386"
+	ImageArchitectureX86_64 = "x86_64"
+	ImageArchitectureArm64  = "arm64"
+)
+
+const (
+	ImageNvmeSupported   = "supported"
+	ImageNvmeUnsupported = "unsupported"
+)
+
 const (
 	IOOptimizedNone      = "none"
 	IOOptimizedOptimized = "optimized"
@@ -87,6 +228,12 @@ const (
 	InstanceNetworkVpc     = "vpc"
 )
 
+const (
+	SpotStrategyNoSpot         = "NoSpot"
+	SpotStrategyWithPriceLimit = "SpotWithPriceLimit"
+	SpotStrategyAsPriceGo      = "SpotAsPriceGo"
+)
+
 const (
 	DiskTypeSystem = "system"
 	DiskTypeData   = "data"
@@ -99,6 +246,16 @@ const (
 	TagResourceDisk     = "disk"
 )
 
+// The keys of the tags identifying the build which created a temporary
+// resource. BuildOwnershipTagKey, whose value is the UUID of the build, marks
+// the resources deleted by the sweep mode.
+const (
+	BuildOwnershipTagKey     = "packer-build-uuid"
+	BuildNameTagKey          = "packer-build-name"
+	BuildCreationTimeTagKey  = "packer-created-at"
+	BuildPluginVersionTagKey = "packer-plugin-version"
+)
+
 const (
 	IpProtocolAll  = "all"
 	IpProtocolTCP  = "tcp"
@@ -112,6 +269,34 @@ const (
 	NicTypeIntranet = "intranet"
 )
 
+// The types of the commands run by Cloud Assistant.
+const (
+	CommandTypeShell      = "RunShellScript"
+	CommandTypeBat        = "RunBatScript"
+	CommandTypePowerShell = "RunPowerShellScript"
+)
+
+// The statuses of a command run by Cloud Assistant on an instance, the ones
+// not listed here meaning that the command did not run to its end.
+const (
+	InvocationStatusPending  = "Pending"
+	InvocationStatusRunning  = "Running"
+	InvocationStatusStopping = "Stopping"
+	InvocationStatusSuccess  = "Success"
+	InvocationStatusFailed   = "Failed"
+)
+
+// The statuses of an asynchronous task, like the export of an image. The
+// task ends with TaskStatusFinished when it succeeds.
+const (
+	TaskStatusWaiting    = "Waiting"
+	TaskStatusProcessing = "Processing"
+	TaskStatusFinished   = "Finished"
+	TaskStatusFailed     = "Failed"
+	TaskStatusCancelled  = "Cancelled"
+	TaskStatusDeleted    = "Deleted"
+)
+
 const (
 	DefaultPortRange = "-1/-1"
 	DefaultCidrIp    = "0.0.0.0/0"
@@ -125,6 +310,66 @@ const (
 	mediumRetryTimes     = 360
 )
 
+// statusBackoff is used to wait for images and snapshots, which can take up to
+// hours to become ready. It polls less and less often as the wait grows, and
+// spreads the requests of concurrent builds.
+var statusBackoff = JitteredBackoff(ExponentialBackoff(defaultRetryInterval, 30*time.Second))
+
+// throttlingErrors are the error codes returned when the requests exceed the
+// API rate allowed for the account.
+var throttlingErrors = []string{
+	"Throttling",
+	"Throttling.User",
+	"Throttling.Api",
+	"Throttling.Resource",
+}
+
+// maxThrottlingRetryInterval caps the wait before retrying a throttled request.
+const maxThrottlingRetryInterval = 2 * time.Minute
+
+// BackoffPolicy returns how long to wait before the given retry, attempt
+// being 1 for the first retry.
+type BackoffPolicy func(attempt int) time.Duration
+
+// ConstantBackoff waits the same interval before every retry.
+func ConstantBackoff(interval time.Duration) BackoffPolicy {
+	return func(attempt int) time.Duration {
+		return interval
+	}
+}
+
+// ExponentialBackoff doubles the wait before every retry, starting from
+// initial and capped at max.
+func ExponentialBackoff(initial time.Duration, max time.Duration) BackoffPolicy {
+	return func(attempt int) time.Duration {
+		delay := initial
+		for i := 1; i < attempt && delay < max; i++ {
+			delay *= 2
+		}
+		if delay > max {
+			delay = max
+		}
+		return delay
+	}
+}
+
+// JitteredBackoff randomizes the wait of policy between half and all of it,
+// so that concurrent builds do not retry in lockstep.
+func JitteredBackoff(policy BackoffPolicy) BackoffPolicy {
+	return func(attempt int) time.Duration {
+		delay := policy(attempt)
+		if delay <= 1 {
+			return delay
+		}
+		return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+}
+
+func isThrottlingError(err error) bool {
+	e, ok := err.(errors.Error)
+	return ok && ContainsInArray(throttlingErrors, e.ErrorCode())
+}
+
 type WaitForExpectEvalResult struct {
 	evalPass  bool
 	stopRetry bool
@@ -148,20 +393,65 @@ var (
 )
 
 type WaitForExpectArgs struct {
+	// Context stops the retries as soon as it is done. A nil Context never
+	// stops them.
+	Context       context.Context
 	RequestFunc   func() (responses.AcsResponse, error)
 	EvalFunc      func(response responses.AcsResponse, err error) WaitForExpectEvalResult
 	RetryInterval time.Duration
-	RetryTimes    int
-	RetryTimeout  time.Duration
+	// Backoff computes the wait between retries. It defaults to waiting
+	// RetryInterval before every retry.
+	Backoff      BackoffPolicy
+	RetryTimes   int
+	RetryTimeout time.Duration
+}
+
+// WaitForExpectCancelledError is returned by WaitForExpected when its context
+// is done before the expected result is met.
+type WaitForExpectCancelledError struct {
+	// Err is the error of the context, context.Canceled or
+	// context.DeadlineExceeded.
+	Err error
+	// LastError is the last error returned by the request, if any.
+	LastError error
+}
+
+func (e *WaitForExpectCancelledError) Error() string {
+	if e.LastError != nil {
+		return fmt.Sprintf("waiting cancelled: %s, last error: %s", e.Err, e.LastError)
+	}
+	return fmt.Sprintf("waiting cancelled: %s", e.Err)
+}
+
+func (e *WaitForExpectCancelledError) Unwrap() error {
+	return e.Err
+}
+
+// IsWaitForExpectCancelled reports whether err was returned because the
+// context of WaitForExpected was done.
+func IsWaitForExpectCancelled(err error) bool {
+	var cancelled *WaitForExpectCancelledError
+	return stderrors.As(err, &cancelled)
 }
 
 func (c *ClientWrapper) WaitForExpected(args *WaitForExpectArgs) (responses.AcsResponse, error) {
+	ctx := args.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	if args.RetryInterval <= 0 {
 		args.RetryInterval = defaultRetryInterval
 	}
 	if args.RetryTimes <= 0 {
 		args.RetryTimes = defaultRetryTimes
 	}
+	if args.Backoff == nil {
+		args.Backoff = ConstantBackoff(args.RetryInterval)
+	}
+	// Throttled requests back off harder than the others, whatever the
+	// policy, to give the account some room to recover.
+	throttlingBackoff := JitteredBackoff(ExponentialBackoff(2*args.RetryInterval, maxThrottlingRetryInterval))
+	throttled := 0
 
 	var timeoutPoint time.Time
 	if args.RetryTimeout > 0 {
@@ -172,6 +462,10 @@ func (c *ClientWrapper) WaitForExpected(args *WaitForExpectArgs) (responses.AcsR
 	var lastError error
 
 	for i := 0; ; i++ {
+		if ctx.Err() != nil {
+			return lastResponse, &WaitForExpectCancelledError{Err: ctx.Err(), LastError: lastError}
+		}
+
 		if args.RetryTimeout > 0 && time.Now().After(timeoutPoint) {
 			break
 		}
@@ -188,11 +482,25 @@ func (c *ClientWrapper) WaitForExpected(args *WaitForExpectArgs) (responses.AcsR
 		if evalResult.evalPass {
 			return response, nil
 		}
-		if evalResult.stopRetry {
-			return response, err
+
+		delay := args.Backoff(i + 1)
+		if isThrottlingError(err) {
+			throttled++
+			if throttlingDelay := throttlingBackoff(throttled); throttlingDelay > delay {
+				delay = throttlingDelay
+			}
+			log.Printf("[DEBUG] Request throttled, retrying in %s: %s", delay, err)
+		} else {
+			throttled = 0
+			if evalResult.stopRetry {
+				return response, err
+			}
 		}
 
-		time.Sleep(args.RetryInterval)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
 	}
 
 	if lastError == nil {
@@ -206,8 +514,9 @@ func (c *ClientWrapper) WaitForExpected(args *WaitForExpectArgs) (responses.AcsR
 	return lastResponse, fmt.Errorf("evaluate failed after %d times retry with %d seconds retry interval: %s", args.RetryTimes, int(args.RetryInterval.Seconds()), lastError)
 }
 
-func (c *ClientWrapper) WaitForInstanceStatus(regionId string, instanceId string, expectedStatus string) (responses.AcsResponse, error) {
+func (c *ClientWrapper) WaitForInstanceStatus(ctx context.Context, regionId string, instanceId string, expectedStatus string) (responses.AcsResponse, error) {
 	return c.WaitForExpected(&WaitForExpectArgs{
+		Context: ctx,
 		RequestFunc: func() (responses.AcsResponse, error) {
 			request := ecs.CreateDescribeInstancesRequest()
 			request.RegionId = regionId
@@ -232,8 +541,9 @@ func (c *ClientWrapper) WaitForInstanceStatus(regionId string, instanceId string
 	})
 }
 
-func (c *ClientWrapper) WaitForImageStatus(regionId string, imageId string, expectedStatus string, timeout time.Duration) (responses.AcsResponse, error) {
+func (c *ClientWrapper) WaitForImageStatus(ctx context.Context, regionId string, imageId string, expectedStatus string, timeout time.Duration) (responses.AcsResponse, error) {
 	return c.WaitForExpected(&WaitForExpectArgs{
+		Context: ctx,
 		RequestFunc: func() (responses.AcsResponse, error) {
 			request := ecs.CreateDescribeImagesRequest()
 			request.RegionId = regionId
@@ -256,12 +566,14 @@ func (c *ClientWrapper) WaitForImageStatus(regionId string, imageId string, expe
 
 			return WaitForExpectToRetry
 		},
+		Backoff:      statusBackoff,
 		RetryTimeout: timeout,
 	})
 }
 
-func (c *ClientWrapper) WaitForSnapshotStatus(regionId string, snapshotId string, expectedStatus string, timeout time.Duration) (responses.AcsResponse, error) {
+func (c *ClientWrapper) WaitForSnapshotStatus(ctx context.Context, regionId string, snapshotId string, expectedStatus string, timeout time.Duration) (responses.AcsResponse, error) {
 	return c.WaitForExpected(&WaitForExpectArgs{
+		Context: ctx,
 		RequestFunc: func() (responses.AcsResponse, error) {
 			request := ecs.CreateDescribeSnapshotsRequest()
 			request.RegionId = regionId
@@ -282,10 +594,57 @@ func (c *ClientWrapper) WaitForSnapshotStatus(regionId string, snapshotId string
 			}
 			return WaitForExpectToRetry
 		},
+		Backoff:      statusBackoff,
 		RetryTimeout: timeout,
 	})
 }
 
+// WaitForTask waits for the task to finish, calling progress with the
+// progress of the task, like "50%", whenever it changes. It fails as soon as
+// the task fails, is cancelled or is deleted.
+func (c *ClientWrapper) WaitForTask(ctx context.Context, regionId string, taskId string, timeout time.Duration, progress func(string)) (*ecs.DescribeTaskAttributeResponse, error) {
+	lastProgress := ""
+	response, err := c.WaitForExpected(&WaitForExpectArgs{
+		Context: ctx,
+		RequestFunc: func() (responses.AcsResponse, error) {
+			request := ecs.CreateDescribeTaskAttributeRequest()
+			request.RegionId = regionId
+			request.TaskId = taskId
+			return c.DescribeTaskAttribute(request)
+		},
+		EvalFunc: func(response responses.AcsResponse, err error) WaitForExpectEvalResult {
+			if err != nil {
+				return WaitForExpectToRetry
+			}
+
+			taskResponse := response.(*ecs.DescribeTaskAttributeResponse)
+			if progress != nil && taskResponse.TaskProcess != "" && taskResponse.TaskProcess != lastProgress {
+				lastProgress = taskResponse.TaskProcess
+				progress(taskResponse.TaskProcess)
+			}
+
+			switch taskResponse.TaskStatus {
+			case TaskStatusFinished:
+				return WaitForExpectSuccess
+			case TaskStatusFailed, TaskStatusCancelled, TaskStatusDeleted:
+				return WaitForExpectFailToStop
+			}
+			return WaitForExpectToRetry
+		},
+		Backoff:      statusBackoff,
+		RetryTimeout: timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	taskResponse := response.(*ecs.DescribeTaskAttributeResponse)
+	if taskResponse.TaskStatus != TaskStatusFinished {
+		return taskResponse, fmt.Errorf("task %s is %s", taskId, taskResponse.TaskStatus)
+	}
+	return taskResponse, nil
+}
+
 type EvalErrorType bool
 
 const (
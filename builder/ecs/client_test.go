@@ -4,11 +4,17 @@
 package ecs
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	sdkerrors "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
 )
 
 func TestWaitForExpectedExceedRetryTimes(t *testing.T) {
@@ -82,3 +88,152 @@ func TestWaitForExpectedExceedRetryTimeout(t *testing.T) {
 		t.Fatalf("WaitForExpected should terminate within %f seconds", (expectTimeout + timeTolerance).Seconds())
 	}
 }
+
+func TestWaitForExpectedCancelled(t *testing.T) {
+	c := ClientWrapper{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	iter := 0
+	waitDone := make(chan error, 1)
+
+	go func() {
+		_, err := c.WaitForExpected(&WaitForExpectArgs{
+			Context: ctx,
+			RequestFunc: func() (responses.AcsResponse, error) {
+				iter++
+				if iter == 2 {
+					cancel()
+				}
+				return nil, fmt.Errorf("test: let iteration %d failed", iter)
+			},
+			EvalFunc: func(response responses.AcsResponse, err error) WaitForExpectEvalResult {
+				return WaitForExpectToRetry
+			},
+			RetryInterval: 100 * time.Millisecond,
+			RetryTimeout:  time.Hour,
+		})
+
+		waitDone <- err
+	}()
+
+	select {
+	case err := <-waitDone:
+		if iter != 2 {
+			t.Fatalf("WaitForExpected should stop right after the context is cancelled, actual iterations: %d", iter)
+		}
+		if !IsWaitForExpectCancelled(err) || !errors.Is(err, context.Canceled) {
+			t.Fatalf("WaitForExpected should return a cancellation error, actual: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitForExpected should terminate as soon as the context is cancelled")
+	}
+}
+
+func TestBackoffPolicies(t *testing.T) {
+	constant := ConstantBackoff(time.Second)
+	if constant(1) != time.Second || constant(10) != time.Second {
+		t.Fatalf("constant backoff should always wait 1s")
+	}
+
+	exponential := ExponentialBackoff(time.Second, 5*time.Second)
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if delay := exponential(attempt + 1); delay != expected {
+			t.Fatalf("exponential backoff should wait %s before retry %d, actual: %s", expected, attempt+1, delay)
+		}
+	}
+
+	jittered := JitteredBackoff(constant)
+	for i := 0; i < 100; i++ {
+		if delay := jittered(1); delay < time.Second/2 || delay > time.Second {
+			t.Fatalf("jittered backoff should wait between 0.5s and 1s, actual: %s", delay)
+		}
+	}
+}
+
+func TestWaitForExpectedThrottling(t *testing.T) {
+	c := ClientWrapper{}
+
+	iter := 0
+	_, err := c.WaitForExpected(&WaitForExpectArgs{
+		RequestFunc: func() (responses.AcsResponse, error) {
+			iter++
+			if iter < 3 {
+				return nil, sdkerrors.NewServerError(400, `{"Code":"Throttling.User","Message":"Request was denied due to user flow control."}`, "")
+			}
+			return nil, nil
+		},
+		// Throttling is not in the retry errors, but should be retried anyway.
+		EvalFunc:      c.EvalCouldRetryResponse([]string{"IncorrectInstanceStatus"}, EvalRetryErrorType),
+		RetryInterval: 10 * time.Millisecond,
+	})
+
+	if err != nil {
+		t.Fatalf("throttled requests should be retried, actual error: %s", err)
+	}
+	if iter != 3 {
+		t.Fatalf("WaitForExpected should succeed at the 3rd iteration, actual: %d", iter)
+	}
+}
+
+func TestRateLimitedTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newRateLimitedTransport(4)}
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		response, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("should not have error: %s", err)
+		}
+		response.Body.Close()
+	}
+
+	// The first 4 requests are allowed by the burst, the 2 others wait 250ms each.
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("requests should have been rate limited, elapsed: %s", elapsed)
+	}
+}
+
+func TestWaitForTask(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	client, _ := api.Clients(t)
+	exported := testImage(t, client, "packer_exported")
+	failed := testImage(t, client, "packer_failed")
+	api.FailedExports = []string{failed}
+
+	exportImage := func(imageId string) string {
+		request := ecs.CreateExportImageRequest()
+		request.RegionId = fakeAPIRegion
+		request.ImageId = imageId
+		request.OSSBucket = "bucket"
+		response, err := client.ExportImage(request)
+		if err != nil {
+			t.Fatalf("should not have error: %s", err)
+		}
+		return response.TaskId
+	}
+
+	var progress []string
+	task, err := client.WaitForTask(context.Background(), fakeAPIRegion, exportImage(exported), time.Minute, func(p string) {
+		progress = append(progress, p)
+	})
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if task.TaskStatus != TaskStatusFinished {
+		t.Fatalf("bad: expected task %s, actual %s", TaskStatusFinished, task.TaskStatus)
+	}
+	if len(progress) != 1 || progress[0] != "100%" {
+		t.Fatalf("bad: the progress should be reported, actual %v", progress)
+	}
+
+	// 任务失败时立即返回，不等到超时
+	start := time.Now()
+	if _, err := client.WaitForTask(context.Background(), fakeAPIRegion, exportImage(failed), time.Minute, nil); err == nil {
+		t.Fatalf("should have error")
+	}
+	if time.Since(start) > defaultRetryInterval {
+		t.Fatalf("bad: the failed task should stop the wait, waited %s", time.Since(start))
+	}
+}
@@ -0,0 +1,400 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ecs
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// CloudAssistantCommunicator is the communicator type running the commands
+// through the Cloud Assistant API, so that the instance needs neither a
+// public IP address nor inbound access.
+const CloudAssistantCommunicator = "cloud-assistant"
+
+// cloudAssistantChunkSize is the size of the file chunks transferred by a
+// single command. Encoded in base64 within the script, itself encoded in
+// base64, a chunk fits in the 18 KB allowed for the content of a command, and
+// in the 24 KB kept of its output when downloaded.
+const cloudAssistantChunkSize = 8 * 1024
+
+// cloudAssistantMaxUploadSize is the size of the largest file uploaded by the
+// communicator. Every chunk takes a command, so that a larger file would take
+// hours to upload.
+const cloudAssistantMaxUploadSize = 10 * 1024 * 1024
+
+var runCommandRetryErrors = []string{
+	"ServiceUnavailable",
+	"InternalError",
+}
+
+// cloudAssistantCommunicator runs the commands of the provisioners with
+// RunCommand, and transfers the files in chunks over the same commands.
+type cloudAssistantCommunicator struct {
+	client     *ClientWrapper
+	regionId   string
+	instanceId string
+	windows    bool
+	timeout    time.Duration
+}
+
+var _ packersdk.Communicator = (*cloudAssistantCommunicator)(nil)
+
+func (c *cloudAssistantCommunicator) Start(ctx context.Context, cmd *packersdk.RemoteCmd) error {
+	if cmd.Stdin != nil {
+		return fmt.Errorf("the %s communicator does not support the standard input of commands", CloudAssistantCommunicator)
+	}
+
+	// 与 WinRM 一致，Windows 下的命令由 cmd 执行
+	commandType := CommandTypeShell
+	if c.windows {
+		commandType = CommandTypeBat
+	}
+
+	invokeId, err := c.runCommand(ctx, commandType, cmd.Command)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		result, err := c.waitForInvocation(ctx, invokeId)
+		if err != nil {
+			log.Printf("[ERROR] Failed waiting for the result of command %s: %s", invokeId, err)
+			cmd.SetExited(packersdk.CmdDisconnect)
+			return
+		}
+
+		output, exitStatus, err := invocationOutput(result)
+		if cmd.Stdout != nil {
+			_, _ = cmd.Stdout.Write(output)
+		}
+		if err != nil {
+			if cmd.Stderr != nil {
+				_, _ = fmt.Fprintln(cmd.Stderr, err)
+			}
+			if exitStatus == 0 {
+				exitStatus = 1
+			}
+		}
+		cmd.SetExited(exitStatus)
+	}()
+
+	return nil
+}
+
+func (c *cloudAssistantCommunicator) Upload(dst string, r io.Reader, fi *os.FileInfo) error {
+	ctx := context.TODO()
+
+	// 文件大小已知时，在上传前检查大小限制
+	if fi != nil && (*fi).Size() > cloudAssistantMaxUploadSize {
+		return uploadTooLargeError(dst)
+	}
+
+	// 先写入临时文件，上传完成后再移动到目标路径
+	temporaryPath := dst + ".packer-upload"
+	if _, err := c.runScript(ctx, c.createFileScript(temporaryPath)); err != nil {
+		return fmt.Errorf("Error creating %s: %s", dst, err)
+	}
+
+	chunk := make([]byte, cloudAssistantChunkSize)
+	var size int64
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			size += int64(n)
+			if size > cloudAssistantMaxUploadSize {
+				return uploadTooLargeError(dst)
+			}
+			content := base64.StdEncoding.EncodeToString(chunk[:n])
+			if _, err := c.runScript(ctx, c.appendFileScript(temporaryPath, content)); err != nil {
+				return fmt.Errorf("Error uploading %s: %s", dst, err)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Error reading the content of %s: %s", dst, err)
+		}
+	}
+
+	var mode os.FileMode
+	if fi != nil {
+		mode = (*fi).Mode().Perm()
+	}
+	if _, err := c.runScript(ctx, c.moveFileScript(temporaryPath, dst, mode)); err != nil {
+		return fmt.Errorf("Error moving %s: %s", dst, err)
+	}
+
+	return nil
+}
+
+func uploadTooLargeError(dst string) error {
+	return fmt.Errorf("Error uploading %s: the %s communicator uploads files up to %d MB, download larger files from the instance instead",
+		dst, CloudAssistantCommunicator, cloudAssistantMaxUploadSize/1024/1024)
+}
+
+func (c *cloudAssistantCommunicator) UploadDir(dst string, src string, exclude []string) error {
+	ctx := context.TODO()
+
+	// Like rsync, the directory itself is uploaded unless src ends with a
+	// separator.
+	if !strings.HasSuffix(src, "/") && !strings.HasSuffix(src, string(os.PathSeparator)) {
+		dst = path.Join(dst, filepath.Base(src))
+	}
+
+	return filepath.Walk(src, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(src, localPath)
+		if err != nil {
+			return err
+		}
+		for _, pattern := range exclude {
+			if matched, _ := filepath.Match(pattern, relativePath); matched {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		remotePath := path.Join(dst, filepath.ToSlash(relativePath))
+		if info.IsDir() {
+			if _, err := c.runScript(ctx, c.makeDirScript(remotePath)); err != nil {
+				return fmt.Errorf("Error creating %s: %s", remotePath, err)
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			log.Printf("[WARN] Skipping %s, which is not a regular file", localPath)
+			return nil
+		}
+
+		file, err := os.Open(localPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		return c.Upload(remotePath, file, &info)
+	})
+}
+
+func (c *cloudAssistantCommunicator) Download(src string, w io.Writer) error {
+	ctx := context.TODO()
+
+	for index := 0; ; index++ {
+		output, err := c.runScript(ctx, c.readFileScript(src, index))
+		if err != nil {
+			return fmt.Errorf("Error downloading %s: %s", src, err)
+		}
+
+		chunk, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(output)))
+		if err != nil {
+			return fmt.Errorf("Error decoding %s: %s", src, err)
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+
+		if len(chunk) < cloudAssistantChunkSize {
+			return nil
+		}
+	}
+}
+
+func (c *cloudAssistantCommunicator) DownloadDir(src string, dst string, exclude []string) error {
+	return fmt.Errorf("DownloadDir is not implemented for the %s communicator", CloudAssistantCommunicator)
+}
+
+// runScript runs a script of the communicator, a shell script on Linux or a
+// PowerShell one on Windows, and returns its output. It fails unless the
+// script exits with 0.
+func (c *cloudAssistantCommunicator) runScript(ctx context.Context, script string) ([]byte, error) {
+	commandType := CommandTypeShell
+	if c.windows {
+		commandType = CommandTypePowerShell
+		script = "$ErrorActionPreference = 'Stop'\n" + script
+	}
+
+	invokeId, err := c.runCommand(ctx, commandType, script)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.waitForInvocation(ctx, invokeId)
+	if err != nil {
+		return nil, err
+	}
+
+	output, exitStatus, err := invocationOutput(result)
+	if err != nil {
+		return nil, err
+	}
+	if exitStatus != 0 {
+		return nil, fmt.Errorf("exit status %d: %s", exitStatus, strings.TrimSpace(string(output)))
+	}
+
+	return output, nil
+}
+
+func (c *cloudAssistantCommunicator) runCommand(ctx context.Context, commandType string, content string) (string, error) {
+	request := ecs.CreateRunCommandRequest()
+	request.RegionId = c.regionId
+	request.InstanceId = &[]string{c.instanceId}
+	request.Name = "packer"
+	request.Type = commandType
+	request.ContentEncoding = "Base64"
+	request.CommandContent = base64.StdEncoding.EncodeToString([]byte(content))
+	request.Timeout = requests.NewInteger(int(c.timeout.Seconds()))
+
+	response, err := c.client.WaitForExpected(&WaitForExpectArgs{
+		Context: ctx,
+		RequestFunc: func() (responses.AcsResponse, error) {
+			return c.client.RunCommand(request)
+		},
+		EvalFunc: c.client.EvalCouldRetryResponse(runCommandRetryErrors, EvalRetryErrorType),
+	})
+	if err != nil {
+		return "", fmt.Errorf("Error running command: %s", err)
+	}
+
+	return response.(*ecs.RunCommandResponse).InvokeId, nil
+}
+
+// waitForInvocation waits for the command to end on the instance, and
+// returns its result.
+func (c *cloudAssistantCommunicator) waitForInvocation(ctx context.Context, invokeId string) (*ecs.InvocationResult, error) {
+	response, err := c.client.WaitForExpected(&WaitForExpectArgs{
+		Context: ctx,
+		RequestFunc: func() (responses.AcsResponse, error) {
+			request := ecs.CreateDescribeInvocationResultsRequest()
+			request.RegionId = c.regionId
+			request.InvokeId = invokeId
+			request.InstanceId = c.instanceId
+			request.ContentEncoding = "Base64"
+			return c.client.DescribeInvocationResults(request)
+		},
+		EvalFunc: func(response responses.AcsResponse, err error) WaitForExpectEvalResult {
+			if err != nil {
+				return WaitForExpectToRetry
+			}
+
+			results := response.(*ecs.DescribeInvocationResultsResponse).Invocation.InvocationResults.InvocationResult
+			for _, result := range results {
+				switch result.InvocationStatus {
+				case InvocationStatusPending, InvocationStatusRunning, InvocationStatusStopping:
+					return WaitForExpectToRetry
+				default:
+					return WaitForExpectSuccess
+				}
+			}
+			return WaitForExpectToRetry
+		},
+		Backoff: JitteredBackoff(ExponentialBackoff(time.Second, 10*time.Second)),
+		// Cloud Assistant stops the command itself once it times out
+		RetryTimeout: c.timeout + time.Minute,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error waiting for command %s: %s", invokeId, err)
+	}
+
+	result := response.(*ecs.DescribeInvocationResultsResponse).Invocation.InvocationResults.InvocationResult[0]
+	return &result, nil
+}
+
+// invocationOutput returns the output and the exit status of a command. The
+// error tells why the command did not run to its end, if so.
+func invocationOutput(result *ecs.InvocationResult) ([]byte, int, error) {
+	output, err := base64.StdEncoding.DecodeString(result.Output)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Error decoding the output of command %s: %s", result.InvokeId, err)
+	}
+	if result.Dropped > 0 {
+		log.Printf("[WARN] %d bytes of the output of command %s were dropped", result.Dropped, result.InvokeId)
+	}
+
+	exitStatus := int(result.ExitCode)
+	switch result.InvocationStatus {
+	case InvocationStatusSuccess, InvocationStatusFailed:
+		return output, exitStatus, nil
+	default:
+		return output, exitStatus, fmt.Errorf("command %s ended with status %s: %s %s",
+			result.InvokeId, result.InvocationStatus, result.ErrorCode, result.ErrorInfo)
+	}
+}
+
+func (c *cloudAssistantCommunicator) createFileScript(file string) string {
+	if c.windows {
+		return fmt.Sprintf("New-Item -ItemType Directory -Force -Path (Split-Path -Parent %s) | Out-Null\n"+
+			"[IO.File]::WriteAllBytes(%s, [byte[]]@())", powerShellQuote(file), powerShellQuote(file))
+	}
+	return fmt.Sprintf("mkdir -p \"$(dirname %s)\" && : > %s", shellQuote(file), shellQuote(file))
+}
+
+func (c *cloudAssistantCommunicator) appendFileScript(file string, chunk string) string {
+	if c.windows {
+		return fmt.Sprintf("$b = [Convert]::FromBase64String('%s')\n"+
+			"$f = [IO.File]::Open(%s, 'Append')\n"+
+			"$f.Write($b, 0, $b.Length)\n"+
+			"$f.Close()", chunk, powerShellQuote(file))
+	}
+	return fmt.Sprintf("printf '%%s' '%s' | base64 -d >> %s", chunk, shellQuote(file))
+}
+
+func (c *cloudAssistantCommunicator) moveFileScript(src string, dst string, mode os.FileMode) string {
+	if c.windows {
+		return fmt.Sprintf("Move-Item -Force -Path %s -Destination %s", powerShellQuote(src), powerShellQuote(dst))
+	}
+	script := fmt.Sprintf("mv -f %s %s", shellQuote(src), shellQuote(dst))
+	if mode != 0 {
+		script = fmt.Sprintf("chmod %o %s && %s", mode, shellQuote(src), script)
+	}
+	return script
+}
+
+func (c *cloudAssistantCommunicator) readFileScript(file string, index int) string {
+	if c.windows {
+		return fmt.Sprintf("$f = [IO.File]::OpenRead(%s)\n"+
+			"$f.Seek(%d, 'Begin') | Out-Null\n"+
+			"$b = New-Object byte[] %d\n"+
+			"$n = $f.Read($b, 0, $b.Length)\n"+
+			"$f.Close()\n"+
+			"[Convert]::ToBase64String($b, 0, $n)", powerShellQuote(file), index*cloudAssistantChunkSize, cloudAssistantChunkSize)
+	}
+	return fmt.Sprintf("test -f %s || { echo %s: No such file >&2; exit 1; }\n"+
+		"dd if=%s bs=%d skip=%d count=1 2>/dev/null | base64 | tr -d '\\n'",
+		shellQuote(file), shellQuote(file), shellQuote(file), cloudAssistantChunkSize, index)
+}
+
+func (c *cloudAssistantCommunicator) makeDirScript(dir string) string {
+	if c.windows {
+		return fmt.Sprintf("New-Item -ItemType Directory -Force -Path %s | Out-Null", powerShellQuote(dir))
+	}
+	return fmt.Sprintf("mkdir -p %s", shellQuote(dir))
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func powerShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
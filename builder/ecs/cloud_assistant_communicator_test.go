@@ -0,0 +1,182 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ecs
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// testCloudAssistantCommunicator returns a communicator for an instance of
+// the fake API, which runs the commands on the local machine.
+func testCloudAssistantCommunicator(t *testing.T) *cloudAssistantCommunicator {
+	api := newFakeAlicloudAPI(t)
+	client, _ := api.Clients(t)
+
+	securityGroup, err := client.CreateSecurityGroup(ecs.CreateCreateSecurityGroupRequest())
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	request := ecs.CreateCreateInstanceRequest()
+	request.SecurityGroupId = securityGroup.SecurityGroupId
+	request.ImageId = fakeAPISourceImage
+	instance, err := client.CreateInstance(request)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	return &cloudAssistantCommunicator{
+		client:     client,
+		regionId:   fakeAPIRegion,
+		instanceId: instance.InstanceId,
+		timeout:    time.Minute,
+	}
+}
+
+func TestCloudAssistantCommunicator_Start(t *testing.T) {
+	comm := testCloudAssistantCommunicator(t)
+
+	var stdout bytes.Buffer
+	cmd := &packersdk.RemoteCmd{
+		Command: "echo hello; exit 3",
+		Stdout:  &stdout,
+	}
+	if err := cmd.RunWithUi(context.Background(), comm, packersdk.TestUi(t)); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	if cmd.ExitStatus() != 3 {
+		t.Fatalf("bad: expected exit status 3, actual %d", cmd.ExitStatus())
+	}
+	if !strings.Contains(stdout.String(), "hello") {
+		t.Fatalf("bad: output should be written to stdout, actual %q", stdout.String())
+	}
+}
+
+func TestCloudAssistantCommunicator_UploadDownload(t *testing.T) {
+	comm := testCloudAssistantCommunicator(t)
+	dir := t.TempDir()
+
+	// 多个分块，以及恰好为分块大小整数倍的文件
+	for _, size := range []int{0, 100, 2 * cloudAssistantChunkSize, 2*cloudAssistantChunkSize + 100} {
+		data := make([]byte, size)
+		rand.Read(data)
+
+		dst := filepath.Join(dir, "sub", "file")
+		fi := testFileInfo(t, 0600)
+		if err := comm.Upload(dst, bytes.NewReader(data), &fi); err != nil {
+			t.Fatalf("should not have error: %s", err)
+		}
+
+		uploaded, err := os.ReadFile(dst)
+		if err != nil {
+			t.Fatalf("should not have error: %s", err)
+		}
+		if !bytes.Equal(uploaded, data) {
+			t.Fatalf("bad: the %d bytes uploaded differ", size)
+		}
+		if info, _ := os.Stat(dst); info.Mode().Perm() != 0600 {
+			t.Fatalf("bad: expected mode 0600, actual %o", info.Mode().Perm())
+		}
+
+		var downloaded bytes.Buffer
+		if err := comm.Download(dst, &downloaded); err != nil {
+			t.Fatalf("should not have error: %s", err)
+		}
+		if !bytes.Equal(downloaded.Bytes(), data) {
+			t.Fatalf("bad: the %d bytes downloaded differ", size)
+		}
+	}
+
+	if err := comm.Download(filepath.Join(dir, "missing"), &bytes.Buffer{}); err == nil {
+		t.Fatal("downloading a missing file should have error")
+	}
+
+	// Files above the size limit fail before any chunk is sent.
+	large := filepath.Join(t.TempDir(), "large")
+	if err := os.WriteFile(large, nil, 0600); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if err := os.Truncate(large, cloudAssistantMaxUploadSize+1); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	fi, err := os.Stat(large)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	dst := filepath.Join(dir, "large")
+	if err := comm.Upload(dst, bytes.NewReader(nil), &fi); err == nil {
+		t.Fatal("uploading a file above the size limit should have error")
+	}
+	if _, err := os.Stat(dst + ".packer-upload"); !os.IsNotExist(err) {
+		t.Fatalf("nothing should have been uploaded: %v", err)
+	}
+}
+
+func TestCloudAssistantCommunicator_UploadDir(t *testing.T) {
+	comm := testCloudAssistantCommunicator(t)
+	src := filepath.Join(t.TempDir(), "src")
+	dst := t.TempDir()
+
+	for name, content := range map[string]string{
+		"a.txt":       "a",
+		"sub/b.txt":   "b",
+		"skip/c.txt":  "c",
+		"sub/d.local": "d",
+	} {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("should not have error: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("should not have error: %s", err)
+		}
+	}
+
+	if err := comm.UploadDir(dst, src, []string{"skip", "sub/*.local"}); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	for name, expected := range map[string]string{
+		"src/a.txt":       "a",
+		"src/sub/b.txt":   "b",
+		"src/skip/c.txt":  "",
+		"src/sub/d.local": "",
+	} {
+		content, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if expected == "" {
+			if err == nil {
+				t.Fatalf("bad: %s should have been excluded", name)
+			}
+			continue
+		}
+		if err != nil || string(content) != expected {
+			t.Fatalf("bad: %s should contain %q, actual %q, %v", name, expected, content, err)
+		}
+	}
+}
+
+func testFileInfo(t *testing.T, mode os.FileMode) os.FileInfo {
+	path := filepath.Join(t.TempDir(), "info")
+	if err := os.WriteFile(path, nil, mode); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	return info
+}
@@ -0,0 +1,1481 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ecs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/kms"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/vpc"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	fakeAPIRegion      = "cn-beijing"
+	fakeAPISourceImage = "ubuntu_22_04_x64_20G_alibase_20230101.vhd"
+)
+
+// fakeAPIError is the error returned by the fake API for a single call.
+type fakeAPIError struct {
+	Code    string
+	Message string
+}
+
+// fakeImage is an image known by the fake API, together with the region it
+// lives in, which ecs.Image does not carry.
+type fakeImage struct {
+	RegionId string
+	Image    ecs.Image
+	// BootMode and NvmeSupport are the features set on the image, which
+	// ecs.Image does not carry either.
+	BootMode    string
+	NvmeSupport string
+	// KMSKeyId is the KMS key encrypting a copied image.
+	KMSKeyId string
+}
+
+// fakeSecurityGroupRule is a rule authorized on a security group through the
+// fake API.
+type fakeSecurityGroupRule struct {
+	Direction  string
+	IpProtocol string
+	PortRange  string
+	CidrIp     string
+}
+
+// fakeAlicloudAPI is an in-process fake of the ECS and VPC endpoints, so that
+// the builder steps can be exercised without real credentials. It keeps the
+// resources created through it in memory and moves them to their final status
+// immediately, so steps waiting on a status never need to retry.
+type fakeAlicloudAPI struct {
+	*httptest.Server
+
+	Regions []string
+	Zones   []string
+	// Failures makes the given actions fail with the given error.
+	Failures map[string]fakeAPIError
+	// NoSpotStock makes the creation of spot instances fail.
+	NoSpotStock bool
+	// SoldOut lists the instance types sold out in all the zones.
+	SoldOut []string
+	// FailedCopies lists the regions where the copies of images fail.
+	FailedCopies []string
+	// KMSKeys lists the states of the KMS keys of every region.
+	KMSKeys map[string]map[string]string
+	// FailedExports lists the images whose exports fail.
+	FailedExports []string
+	// Hooks are run after the given actions succeed, e.g. to cancel the
+	// build in the middle of a step.
+	Hooks map[string]func()
+
+	mu             sync.Mutex
+	nextId         int
+	actions        []string
+	forms          []url.Values
+	images         map[string]*fakeImage
+	snapshots      map[string]*ecs.Snapshot
+	disks          map[string]*ecs.Disk
+	instances      map[string]*ecs.Instance
+	vpcs           map[string]*ecs.Vpc
+	vSwitches      map[string]*vpc.VSwitch
+	securityGroups map[string]*ecs.SecurityGroup
+	rules          map[string][]fakeSecurityGroupRule
+	keyPairs       map[string]*ecs.KeyPair
+	publicKeys     map[string]ssh.PublicKey
+	eips           map[string]*ecs.EipAddress
+	tags           map[string]map[string]string
+	shares         map[string]map[string]bool
+	invocations    map[string]*ecs.InvocationResult
+	tasks          map[string]*ecs.DescribeTaskAttributeResponse
+
+	// bootKeyPairs holds the key pair of every instance when it was last
+	// started, which is the one it accepts.
+	bootKeyPairs map[string]string
+	ipAddress    string
+}
+
+// newFakeAlicloudAPI starts a fake API server holding a single system image
+// named fakeAPISourceImage. The server is closed when the test ends.
+func newFakeAlicloudAPI(t *testing.T) *fakeAlicloudAPI {
+	f := &fakeAlicloudAPI{
+		Regions:        []string{fakeAPIRegion, "cn-hangzhou", "cn-shanghai"},
+		Zones:          []string{fakeAPIRegion + "-a", fakeAPIRegion + "-b"},
+		Failures:       map[string]fakeAPIError{},
+		Hooks:          map[string]func(){},
+		images:         map[string]*fakeImage{},
+		snapshots:      map[string]*ecs.Snapshot{},
+		disks:          map[string]*ecs.Disk{},
+		instances:      map[string]*ecs.Instance{},
+		vpcs:           map[string]*ecs.Vpc{},
+		vSwitches:      map[string]*vpc.VSwitch{},
+		securityGroups: map[string]*ecs.SecurityGroup{},
+		rules:          map[string][]fakeSecurityGroupRule{},
+		keyPairs:       map[string]*ecs.KeyPair{},
+		publicKeys:     map[string]ssh.PublicKey{},
+		bootKeyPairs:   map[string]string{},
+		eips:           map[string]*ecs.EipAddress{},
+		tags:           map[string]map[string]string{},
+		shares:         map[string]map[string]bool{},
+		invocations:    map[string]*ecs.InvocationResult{},
+		tasks:          map[string]*ecs.DescribeTaskAttributeResponse{},
+	}
+
+	f.images[fakeAPISourceImage] = &fakeImage{
+		RegionId: fakeAPIRegion,
+		Image: ecs.Image{
+			ImageId:         fakeAPISourceImage,
+			ImageName:       fakeAPISourceImage,
+			ImageOwnerAlias: ImageOwnerSystem,
+			OSName:          "Ubuntu 22.04 64位",
+			OSType:          "linux",
+			Architecture:    "x86_64",
+			Status:          ImageStatusAvailable,
+			CreationTime:    "2023-01-01T00:00:00Z",
+		},
+	}
+
+	f.Server = httptest.NewServer(f)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// Clients returns ECS and VPC clients sending their requests to the fake API.
+func (f *fakeAlicloudAPI) Clients(t *testing.T) (*ClientWrapper, *VPCClientWrapper) {
+	ecsClient, err := ecs.NewClientWithAccessKey(fakeAPIRegion, "access_key", "secret_key")
+	if err != nil {
+		t.Fatalf("Error creating ecs client: %s", err)
+	}
+	ecsClient.Domain = f.Listener.Addr().String()
+
+	vpcClient, err := vpc.NewClientWithAccessKey(fakeAPIRegion, "access_key", "secret_key")
+	if err != nil {
+		t.Fatalf("Error creating vpc client: %s", err)
+	}
+	vpcClient.Domain = f.Listener.Addr().String()
+
+	return &ClientWrapper{ecsClient}, &VPCClientWrapper{vpcClient}
+}
+
+// Attach makes the given access config use the fake API.
+func (f *fakeAlicloudAPI) Attach(t *testing.T, c *AlicloudAccessConfig) {
+	c.client, c.vpcClient = f.Clients(t)
+
+	kmsClient, err := kms.NewClientWithAccessKey(fakeAPIRegion, "access_key", "secret_key")
+	if err != nil {
+		t.Fatalf("Error creating kms client: %s", err)
+	}
+	kmsClient.Domain = f.Listener.Addr().String()
+	c.kmsClient = kmsClient
+}
+
+// Actions returns the actions called so far, in order.
+func (f *fakeAlicloudAPI) Actions() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.actions...)
+}
+
+// Requests returns the parameters of the calls of the given action, in order.
+func (f *fakeAlicloudAPI) Requests(action string) []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var forms []url.Values
+	for index, a := range f.actions {
+		if a == action {
+			forms = append(forms, f.forms[index])
+		}
+	}
+	return forms
+}
+
+// Called reports how many times the given action was called.
+func (f *fakeAlicloudAPI) Called(action string) int {
+	count := 0
+	for _, a := range f.Actions() {
+		if a == action {
+			count++
+		}
+	}
+	return count
+}
+
+// Leftovers lists the temporary resources that are still around.
+func (f *fakeAlicloudAPI) Leftovers() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var leftovers []string
+	for id := range f.instances {
+		leftovers = append(leftovers, "instance "+id)
+	}
+	for id := range f.vpcs {
+		leftovers = append(leftovers, "vpc "+id)
+	}
+	for id := range f.vSwitches {
+		leftovers = append(leftovers, "vswitch "+id)
+	}
+	for id := range f.securityGroups {
+		leftovers = append(leftovers, "security group "+id)
+	}
+	for name := range f.keyPairs {
+		leftovers = append(leftovers, "key pair "+name)
+	}
+	for id := range f.eips {
+		leftovers = append(leftovers, "eip "+id)
+	}
+	return leftovers
+}
+
+// Image returns the image with the given ID, if any.
+func (f *fakeAlicloudAPI) Image(imageId string) (*fakeImage, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	image, ok := f.images[imageId]
+	return image, ok
+}
+
+// Tags returns the tags added to the given resource.
+func (f *fakeAlicloudAPI) Tags(resourceId string) map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tags := map[string]string{}
+	for key, value := range f.tags[resourceId] {
+		tags[key] = value
+	}
+	return tags
+}
+
+// SharedWith returns whether the image is shared with the account.
+func (f *fakeAlicloudAPI) SharedWith(imageId string, account string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.shares[imageId][account]
+}
+
+// Tagged returns the IDs of the resources tagged with the given key, deleted
+// ones included, and their tags.
+func (f *fakeAlicloudAPI) Tagged(key string) map[string]map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tagged := map[string]map[string]string{}
+	for resourceId, tags := range f.tags {
+		if _, ok := tags[key]; ok {
+			tagged[resourceId] = tags
+		}
+	}
+	return tagged
+}
+
+// Tag adds the given tags to a resource, as if it had been created with them.
+func (f *fakeAlicloudAPI) Tag(resourceId string, tags map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.tags[resourceId] == nil {
+		f.tags[resourceId] = map[string]string{}
+	}
+	for key, value := range tags {
+		f.tags[resourceId][key] = value
+	}
+}
+
+// Backdate moves the creation time of a resource the given age back.
+func (f *fakeAlicloudAPI) Backdate(resourceId string, age time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	creationTime := time.Now().Add(-age).UTC().Format("2006-01-02T15:04:05Z")
+	if instance, ok := f.instances[resourceId]; ok {
+		instance.CreationTime = creationTime
+	}
+	if v, ok := f.vpcs[resourceId]; ok {
+		v.CreationTime = creationTime
+	}
+	if vSwitch, ok := f.vSwitches[resourceId]; ok {
+		vSwitch.CreationTime = creationTime
+	}
+	if securityGroup, ok := f.securityGroups[resourceId]; ok {
+		securityGroup.CreationTime = creationTime
+	}
+	if keyPair, ok := f.keyPairs[resourceId]; ok {
+		keyPair.CreationTime = creationTime
+	}
+	if eip, ok := f.eips[resourceId]; ok {
+		eip.AllocationTime = creationTime
+	}
+}
+
+// SetInstanceStatus changes the status of an instance, e.g. to leave it
+// running as a killed build would.
+func (f *fakeAlicloudAPI) SetInstanceStatus(instanceId string, status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.instances[instanceId].Status = status
+}
+
+// ServeSSH starts an SSH server on the loopback interface, which becomes the
+// address of the EIPs and public IPs allocated afterwards. Like the
+// instances, the server only accepts the key pair a running instance was
+// started with. It returns the port of the server.
+func (f *fakeAlicloudAPI) ServeSSH(t *testing.T) int {
+	hostKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating host key: %s", err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("Error generating host key: %s", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if f.accepts(key) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("public key of %s rejected", conn.User())
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening for SSH: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, channels, requests, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				go ssh.DiscardRequests(requests)
+				for channel := range channels {
+					_ = channel.Reject(ssh.Prohibited, "no sessions on the fake API")
+				}
+			}()
+		}
+	}()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ipAddress = "127.0.0.1"
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// accepts reports whether a running instance accepts the given key.
+func (f *fakeAlicloudAPI) accepts(key ssh.PublicKey) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for instanceId, instance := range f.instances {
+		publicKey, ok := f.publicKeys[f.bootKeyPairs[instanceId]]
+		if instance.Status == InstanceStatusRunning && ok && bytes.Equal(publicKey.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rules returns the rules authorized on the given security group.
+func (f *fakeAlicloudAPI) Rules(securityGroupId string) []fakeSecurityGroupRule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeSecurityGroupRule(nil), f.rules[securityGroupId]...)
+}
+
+func (f *fakeAlicloudAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := r.ParseForm(); err != nil {
+		f.writeError(w, &fakeAPIError{"InvalidParameter", err.Error()})
+		return
+	}
+
+	action := r.Form.Get("Action")
+	f.actions = append(f.actions, action)
+	f.forms = append(f.forms, r.Form)
+
+	if failure, ok := f.Failures[action]; ok {
+		f.writeError(w, &failure)
+		return
+	}
+
+	response, apiErr := f.handle(action, r.Form)
+	if apiErr != nil {
+		f.writeError(w, apiErr)
+		return
+	}
+	if hook, ok := f.Hooks[action]; ok {
+		hook()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (f *fakeAlicloudAPI) writeError(w http.ResponseWriter, apiErr *fakeAPIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"Code":      apiErr.Code,
+		"Message":   apiErr.Message,
+		"RequestId": f.newId("request"),
+	})
+}
+
+func (f *fakeAlicloudAPI) handle(action string, form url.Values) (interface{}, *fakeAPIError) {
+	switch action {
+	case "DescribeRegions":
+		return f.describeRegions()
+	case "DescribeAvailableResource":
+		return f.describeAvailableResource(form)
+	case "DescribeImages":
+		return f.describeImages(form)
+	case "DescribeImageFromFamily":
+		return f.describeImageFromFamily(form)
+	case "CreateImage":
+		return f.createImage(form)
+	case "CopyImage":
+		return f.copyImage(form)
+	case "CancelCopyImage":
+		return f.cancelCopyImage(form)
+	case "DeleteImage":
+		return f.deleteImage(form)
+	case "ModifyImageAttribute":
+		return f.modifyImageAttribute(form)
+	case "ModifyImageSharePermission":
+		return f.modifyImageSharePermission(form)
+	case "DescribeImageSharePermission":
+		return f.describeImageSharePermission(form)
+	case "DescribeSnapshots":
+		return f.describeSnapshots(form)
+	case "CreateSnapshot":
+		return f.createSnapshot(form)
+	case "DeleteSnapshot":
+		return f.deleteSnapshot(form)
+	case "DescribeDisks":
+		return f.describeDisks(form)
+	case "CreateInstance":
+		return f.createInstance(form)
+	case "DescribeInstances":
+		return f.describeInstances(form)
+	case "StartInstance":
+		return f.setInstanceStatus(form, InstanceStatusRunning)
+	case "StopInstance":
+		return f.setInstanceStatus(form, InstanceStatusStopped)
+	case "DeleteInstance":
+		return f.deleteInstance(form)
+	case "CreateKeyPair":
+		return f.createKeyPair(form)
+	case "AttachKeyPair":
+		return f.attachKeyPair(form, form.Get("KeyPairName"))
+	case "DetachKeyPair":
+		return f.attachKeyPair(form, "")
+	case "DeleteKeyPairs":
+		return f.deleteKeyPairs(form)
+	case "DescribeKeyPairs":
+		return f.describeKeyPairs(form)
+	case "CreateVpc":
+		return f.createVpc(form)
+	case "DescribeVpcs":
+		return f.describeVpcs(form)
+	case "DeleteVpc":
+		return f.deleteVpc(form)
+	case "CreateVSwitch":
+		return f.createVSwitch(form)
+	case "DescribeVSwitches":
+		return f.describeVSwitches(form)
+	case "DeleteVSwitch":
+		return f.deleteVSwitch(form)
+	case "CreateSecurityGroup":
+		return f.createSecurityGroup(form)
+	case "DescribeSecurityGroups":
+		return f.describeSecurityGroups(form)
+	case "AuthorizeSecurityGroup":
+		return f.authorizeSecurityGroup(form, "ingress")
+	case "AuthorizeSecurityGroupEgress":
+		return f.authorizeSecurityGroup(form, "egress")
+	case "DeleteSecurityGroup":
+		return f.deleteSecurityGroup(form)
+	case "AllocateEipAddress":
+		return f.allocateEipAddress(form)
+	case "AssociateEipAddress":
+		return f.setEipStatus(form, EipStatusInUse)
+	case "UnassociateEipAddress":
+		return f.setEipStatus(form, EipStatusAvailable)
+	case "DescribeEipAddresses":
+		return f.describeEipAddresses(form)
+	case "ReleaseEipAddress":
+		return f.releaseEipAddress(form)
+	case "AllocatePublicIpAddress":
+		return f.allocatePublicIpAddress(form)
+	case "AddTags":
+		return f.addTags(form)
+	case "DescribeTags":
+		return f.describeTags(form)
+	case "DescribeCloudAssistantStatus":
+		return f.describeCloudAssistantStatus(form)
+	case "RunCommand":
+		return f.runCommand(form)
+	case "DescribeInvocationResults":
+		return f.describeInvocationResults(form)
+	case "DescribeKey":
+		return f.describeKey(form)
+	case "ExportImage":
+		return f.exportImage(form)
+	case "DescribeTaskAttribute":
+		return f.describeTaskAttribute(form)
+	}
+
+	return nil, &fakeAPIError{"InvalidAction.NotFound", fmt.Sprintf("The action %s is not supported by the fake API.", action)}
+}
+
+func (f *fakeAlicloudAPI) newId(prefix string) string {
+	f.nextId++
+	return fmt.Sprintf("%s-fake%06d", prefix, f.nextId)
+}
+
+// newIpAddress returns the address of the SSH server when it is started, or
+// the given public address otherwise.
+func (f *fakeAlicloudAPI) newIpAddress(format string, n int) string {
+	if f.ipAddress != "" {
+		return f.ipAddress
+	}
+	return fmt.Sprintf(format, n)
+}
+
+func (f *fakeAlicloudAPI) region(form url.Values) string {
+	if regionId := form.Get("RegionId"); regionId != "" {
+		return regionId
+	}
+	return fakeAPIRegion
+}
+
+func fakeNotFound(kind, id string) *fakeAPIError {
+	return &fakeAPIError{fmt.Sprintf("Invalid%s.NotFound", kind), fmt.Sprintf("The specified %s %s does not exist.", kind, id)}
+}
+
+// fakeJSONList decodes parameters like InstanceIds, which are sent as a JSON
+// encoded list of strings.
+func fakeJSONList(form url.Values, key string) []string {
+	var list []string
+	if value := form.Get(key); value != "" {
+		_ = json.Unmarshal([]byte(value), &list)
+	}
+	return list
+}
+
+// fakeRepeatedList decodes parameters like AddAccount.1, AddAccount.2.
+func fakeRepeatedList(form url.Values, key string) []string {
+	var list []string
+	for i := 1; form.Get(fmt.Sprintf("%s.%d", key, i)) != ""; i++ {
+		list = append(list, form.Get(fmt.Sprintf("%s.%d", key, i)))
+	}
+	return list
+}
+
+// fakeTags decodes the Tag.N.Key and Tag.N.Value parameters.
+func fakeTags(form url.Values) map[string]string {
+	tags := map[string]string{}
+	for i := 1; form.Get(fmt.Sprintf("Tag.%d.Key", i)) != ""; i++ {
+		tags[form.Get(fmt.Sprintf("Tag.%d.Key", i))] = form.Get(fmt.Sprintf("Tag.%d.Value", i))
+	}
+	return tags
+}
+
+// hasTags reports whether the resource carries the tags filtered by the
+// Tag.N.Key and Tag.N.Value parameters. An empty value matches any value.
+func (f *fakeAlicloudAPI) hasTags(resourceId string, form url.Values) bool {
+	for key, value := range fakeTags(form) {
+		tagValue, ok := f.tags[resourceId][key]
+		if !ok || (value != "" && value != tagValue) {
+			return false
+		}
+	}
+	return true
+}
+
+func fakeNow() string {
+	return time.Now().UTC().Format("2006-01-02T15:04:05Z")
+}
+
+func (f *fakeAlicloudAPI) describeRegions() (interface{}, *fakeAPIError) {
+	response := &ecs.DescribeRegionsResponse{RequestId: f.newId("request")}
+	for _, regionId := range f.Regions {
+		response.Regions.Region = append(response.Regions.Region, ecs.Region{RegionId: regionId, LocalName: regionId})
+	}
+	return response, nil
+}
+
+func (f *fakeAlicloudAPI) describeAvailableResource(form url.Values) (interface{}, *fakeAPIError) {
+	response := &ecs.DescribeAvailableResourceResponse{RequestId: f.newId("request")}
+	for _, zoneId := range f.Zones {
+		status := "Available"
+		if ContainsInArray(f.SoldOut, form.Get("InstanceType")) {
+			status = "SoldOut"
+		}
+		zone := ecs.AvailableZone{ZoneId: zoneId, RegionId: f.region(form), Status: "Available"}
+		zone.AvailableResources.AvailableResource = []ecs.AvailableResource{{Type: "InstanceType"}}
+		zone.AvailableResources.AvailableResource[0].SupportedResources.SupportedResource = []ecs.SupportedResource{
+			{Value: form.Get("InstanceType"), Status: status},
+		}
+		response.AvailableZones.AvailableZone = append(response.AvailableZones.AvailableZone, zone)
+	}
+	return response, nil
+}
+
+func (f *fakeAlicloudAPI) describeImages(form url.Values) (interface{}, *fakeAPIError) {
+	regionId := f.region(form)
+	status := form.Get("Status")
+	if status == "" {
+		status = ImageStatusAvailable
+	}
+
+	response := &ecs.DescribeImagesResponse{RequestId: f.newId("request"), RegionId: regionId}
+	for _, image := range f.images {
+		if image.RegionId != regionId ||
+			!ContainsInArray(strings.Split(status, ","), image.Image.Status) ||
+			(form.Get("ImageId") != "" && form.Get("ImageId") != image.Image.ImageId) ||
+			(form.Get("ImageName") != "" && form.Get("ImageName") != image.Image.ImageName) ||
+			(form.Get("ImageOwnerAlias") != "" && form.Get("ImageOwnerAlias") != image.Image.ImageOwnerAlias) {
+			continue
+		}
+		response.Images.Image = append(response.Images.Image, image.Image)
+	}
+	response.TotalCount = len(response.Images.Image)
+	response.PageNumber = 1
+	response.PageSize = len(response.Images.Image)
+	return response, nil
+}
+
+func (f *fakeAlicloudAPI) describeImageFromFamily(form url.Values) (interface{}, *fakeAPIError) {
+	response := &ecs.DescribeImageFromFamilyResponse{RequestId: f.newId("request")}
+	for _, image := range f.images {
+		if image.RegionId == f.region(form) && image.Image.ImageFamily == form.Get("ImageFamily") &&
+			image.Image.CreationTime >= response.Image.CreationTime {
+			response.Image = ecs.Image{
+				ImageId:         image.Image.ImageId,
+				ImageName:       image.Image.ImageName,
+				ImageFamily:     image.Image.ImageFamily,
+				ImageOwnerAlias: image.Image.ImageOwnerAlias,
+				OSName:          image.Image.OSName,
+				OSType:          image.Image.OSType,
+				Architecture:    image.Image.Architecture,
+				Status:          image.Image.Status,
+				CreationTime:    image.Image.CreationTime,
+			}
+		}
+	}
+	return response, nil
+}
+
+func (f *fakeAlicloudAPI) createImage(form url.Values) (interface{}, *fakeAPIError) {
+	regionId := f.region(form)
+	for _, image := range f.images {
+		if image.RegionId == regionId && image.Image.ImageName == form.Get("ImageName") {
+			return nil, &fakeAPIError{"InvalidImageName.Duplicated", "The specified image name is already in use."}
+		}
+	}
+
+	image := ecs.Image{
+		ImageId:         f.newId("m"),
+		ImageName:       form.Get("ImageName"),
+		ImageVersion:    form.Get("ImageVersion"),
+		ImageFamily:     form.Get("ImageFamily"),
+		Architecture:    form.Get("Architecture"),
+		Description:     form.Get("Description"),
+		ImageOwnerAlias: ImageOwnerSelf,
+		Status:          ImageStatusAvailable,
+		Progress:        "100%",
+		CreationTime:    fakeNow(),
+	}
+
+	if snapshotId := form.Get("SnapshotId"); snapshotId != "" {
+		snapshot, ok := f.snapshots[snapshotId]
+		if !ok {
+			return nil, fakeNotFound("SnapshotId", snapshotId)
+		}
+		image.DiskDeviceMappings.DiskDeviceMapping = append(image.DiskDeviceMappings.DiskDeviceMapping,
+			ecs.DiskDeviceMapping{SnapshotId: snapshot.SnapshotId, Size: snapshot.SourceDiskSize, Type: DiskTypeSystem})
+	} else {
+		instanceId := form.Get("InstanceId")
+		instance, ok := f.instances[instanceId]
+		if !ok {
+			return nil, fakeNotFound("InstanceId", instanceId)
+		}
+		if instance.Status != InstanceStatusStopped {
+			return nil, &fakeAPIError{"IncorrectInstanceStatus", "The current status of the instance does not support this operation."}
+		}
+		image.OSName = instance.OSName
+		image.OSType = instance.OSType
+		for _, disk := range f.instanceDisks(instanceId) {
+			snapshot := f.newSnapshot(disk.DiskId, strconv.Itoa(disk.Size))
+			image.DiskDeviceMappings.DiskDeviceMapping = append(image.DiskDeviceMappings.DiskDeviceMapping,
+				ecs.DiskDeviceMapping{SnapshotId: snapshot.SnapshotId, Size: snapshot.SourceDiskSize, Type: disk.Type, Device: disk.Device})
+		}
+	}
+
+	f.images[image.ImageId] = &fakeImage{RegionId: regionId, Image: image}
+	return &ecs.CreateImageResponse{RequestId: f.newId("request"), ImageId: image.ImageId}, nil
+}
+
+func (f *fakeAlicloudAPI) copyImage(form url.Values) (interface{}, *fakeAPIError) {
+	source, ok := f.images[form.Get("ImageId")]
+	if !ok || source.RegionId != f.region(form) {
+		return nil, fakeNotFound("ImageId", form.Get("ImageId"))
+	}
+
+	image := source.Image
+	image.ImageId = f.newId("m")
+	image.ImageName = form.Get("DestinationImageName")
+	image.Description = form.Get("DestinationDescription")
+	image.ImageFamily = ""
+	image.IsCopied = true
+	image.CreationTime = fakeNow()
+	image.DiskDeviceMappings.DiskDeviceMapping = nil
+	for _, device := range source.Image.DiskDeviceMappings.DiskDeviceMapping {
+		snapshot := f.newSnapshot("", device.Size)
+		device.SnapshotId = snapshot.SnapshotId
+		image.DiskDeviceMappings.DiskDeviceMapping = append(image.DiskDeviceMappings.DiskDeviceMapping, device)
+	}
+
+	if ContainsInArray(f.FailedCopies, form.Get("DestinationRegionId")) {
+		image.Status = ImageStatusCreateFailed
+	}
+
+	f.images[image.ImageId] = &fakeImage{RegionId: form.Get("DestinationRegionId"), Image: image, KMSKeyId: form.Get("KMSKeyId")}
+	return &ecs.CopyImageResponse{RequestId: f.newId("request"), ImageId: image.ImageId}, nil
+}
+
+func (f *fakeAlicloudAPI) cancelCopyImage(form url.Values) (interface{}, *fakeAPIError) {
+	if _, ok := f.images[form.Get("ImageId")]; !ok {
+		return nil, fakeNotFound("ImageId", form.Get("ImageId"))
+	}
+	delete(f.images, form.Get("ImageId"))
+	return &ecs.CancelCopyImageResponse{RequestId: f.newId("request")}, nil
+}
+
+func (f *fakeAlicloudAPI) deleteImage(form url.Values) (interface{}, *fakeAPIError) {
+	if _, ok := f.images[form.Get("ImageId")]; !ok {
+		return nil, fakeNotFound("ImageId", form.Get("ImageId"))
+	}
+	delete(f.images, form.Get("ImageId"))
+	return &ecs.DeleteImageResponse{RequestId: f.newId("request")}, nil
+}
+
+func (f *fakeAlicloudAPI) modifyImageAttribute(form url.Values) (interface{}, *fakeAPIError) {
+	image, ok := f.images[form.Get("ImageId")]
+	if !ok || image.RegionId != f.region(form) {
+		return nil, fakeNotFound("ImageId", form.Get("ImageId"))
+	}
+	if imageFamily := form.Get("ImageFamily"); imageFamily != "" {
+		image.Image.ImageFamily = imageFamily
+	}
+	if bootMode := form.Get("BootMode"); bootMode != "" {
+		image.BootMode = bootMode
+	}
+	if nvmeSupport := form.Get("Features.NvmeSupport"); nvmeSupport != "" {
+		image.NvmeSupport = nvmeSupport
+	}
+	return &ecs.ModifyImageAttributeResponse{RequestId: f.newId("request")}, nil
+}
+
+func (f *fakeAlicloudAPI) modifyImageSharePermission(form url.Values) (interface{}, *fakeAPIError) {
+	imageId := form.Get("ImageId")
+	if _, ok := f.images[imageId]; !ok {
+		return nil, fakeNotFound("ImageId", imageId)
+	}
+	if f.shares[imageId] == nil {
+		f.shares[imageId] = map[string]bool{}
+	}
+	for _, account := range fakeRepeatedList(form, "AddAccount") {
+		f.shares[imageId][account] = true
+	}
+	for _, account := range fakeRepeatedList(form, "RemoveAccount") {
+		delete(f.shares[imageId], account)
+	}
+	return &ecs.ModifyImageSharePermissionResponse{RequestId: f.newId("request")}, nil
+}
+
+func (f *fakeAlicloudAPI) describeImageSharePermission(form url.Values) (interface{}, *fakeAPIError) {
+	imageId := form.Get("ImageId")
+	if _, ok := f.images[imageId]; !ok {
+		return nil, fakeNotFound("ImageId", imageId)
+	}
+	response := &ecs.DescribeImageSharePermissionResponse{RequestId: f.newId("request"), ImageId: imageId}
+	for account := range f.shares[imageId] {
+		response.Accounts.Account = append(response.Accounts.Account, ecs.Account{AliyunId: account})
+	}
+	return response, nil
+}
+
+func (f *fakeAlicloudAPI) newSnapshot(diskId string, size string) *ecs.Snapshot {
+	snapshot := &ecs.Snapshot{
+		SnapshotId:     f.newId("s"),
+		SourceDiskId:   diskId,
+		SourceDiskSize: size,
+		Status:         SnapshotStatusAccomplished,
+		Progress:       "100%",
+		CreationTime:   fakeNow(),
+	}
+	f.snapshots[snapshot.SnapshotId] = snapshot
+	return snapshot
+}
+
+func (f *fakeAlicloudAPI) describeSnapshots(form url.Values) (interface{}, *fakeAPIError) {
+	response := &ecs.DescribeSnapshotsResponse{RequestId: f.newId("request")}
+	for _, snapshotId := range fakeJSONList(form, "SnapshotIds") {
+		if snapshot, ok := f.snapshots[snapshotId]; ok {
+			response.Snapshots.Snapshot = append(response.Snapshots.Snapshot, *snapshot)
+		}
+	}
+	response.TotalCount = len(response.Snapshots.Snapshot)
+	return response, nil
+}
+
+func (f *fakeAlicloudAPI) createSnapshot(form url.Values) (interface{}, *fakeAPIError) {
+	disk, ok := f.disks[form.Get("DiskId")]
+	if !ok {
+		return nil, fakeNotFound("DiskId", form.Get("DiskId"))
+	}
+	snapshot := f.newSnapshot(disk.DiskId, strconv.Itoa(disk.Size))
+	return &ecs.CreateSnapshotResponse{RequestId: f.newId("request"), SnapshotId: snapshot.SnapshotId}, nil
+}
+
+func (f *fakeAlicloudAPI) deleteSnapshot(form url.Values) (interface{}, *fakeAPIError) {
+	if _, ok := f.snapshots[form.Get("SnapshotId")]; !ok {
+		return nil, fakeNotFound("SnapshotId", form.Get("SnapshotId"))
+	}
+	delete(f.snapshots, form.Get("SnapshotId"))
+	return &ecs.DeleteSnapshotResponse{RequestId: f.newId("request")}, nil
+}
+
+// instanceDisks returns the disks of an instance, system disk first.
+func (f *fakeAlicloudAPI) instanceDisks(instanceId string) []ecs.Disk {
+	var disks []ecs.Disk
+	for _, disk := range f.disks {
+		if disk.InstanceId != instanceId {
+			continue
+		}
+		if disk.Type == DiskTypeSystem {
+			disks = append([]ecs.Disk{*disk}, disks...)
+		} else {
+			disks = append(disks, *disk)
+		}
+	}
+	return disks
+}
+
+func (f *fakeAlicloudAPI) describeDisks(form url.Values) (interface{}, *fakeAPIError) {
+	response := &ecs.DescribeDisksResponse{RequestId: f.newId("request")}
+	for _, disk := range f.instanceDisks(form.Get("InstanceId")) {
+		if form.Get("DiskType") != "" && form.Get("DiskType") != "all" && form.Get("DiskType") != disk.Type {
+			continue
+		}
+		response.Disks.Disk = append(response.Disks.Disk, disk)
+	}
+	response.TotalCount = len(response.Disks.Disk)
+	return response, nil
+}
+
+func (f *fakeAlicloudAPI) createInstance(form url.Values) (interface{}, *fakeAPIError) {
+	securityGroupId := form.Get("SecurityGroupId")
+	securityGroup, ok := f.securityGroups[securityGroupId]
+	if !ok {
+		return nil, fakeNotFound("SecurityGroupId", securityGroupId)
+	}
+
+	spotStrategy := form.Get("SpotStrategy")
+	if spotStrategy == "" {
+		spotStrategy = SpotStrategyNoSpot
+	}
+	if (f.NoSpotStock && spotStrategy != SpotStrategyNoSpot) || ContainsInArray(f.SoldOut, form.Get("InstanceType")) {
+		return nil, &fakeAPIError{"OperationDenied.NoStock", "The requested resource is sold out in the specified zone."}
+	}
+	if form.Get("DryRun") == "true" {
+		return nil, &fakeAPIError{"DryRunOperation", "Request validation has been passed with DryRun flag set."}
+	}
+
+	instance := &ecs.Instance{
+		InstanceId:              f.newId("i"),
+		SpotStrategy:            spotStrategy,
+		InstanceName:            form.Get("InstanceName"),
+		InstanceType:            form.Get("InstanceType"),
+		RegionId:                f.region(form),
+		ZoneId:                  form.Get("ZoneId"),
+		ImageId:                 form.Get("ImageId"),
+		Status:                  InstanceStatusStopped,
+		InternetChargeType:      form.Get("InternetChargeType"),
+		InstanceNetworkType:     InstanceNetworkClassic,
+		CreationTime:            fakeNow(),
+		InternetMaxBandwidthOut: 0,
+	}
+	instance.SecurityGroupIds.SecurityGroupId = []string{securityGroupId}
+
+	if form.Get("ImageId") != "" {
+		image, ok := f.images[form.Get("ImageId")]
+		if !ok {
+			return nil, fakeNotFound("ImageId", form.Get("ImageId"))
+		}
+		instance.OSName = image.Image.OSName
+		instance.OSType = image.Image.OSType
+	}
+
+	if vSwitchId := form.Get("VSwitchId"); vSwitchId != "" {
+		vSwitch, ok := f.vSwitches[vSwitchId]
+		if !ok {
+			return nil, fakeNotFound("VSwitchId", vSwitchId)
+		}
+		if vSwitch.VpcId != securityGroup.VpcId {
+			return nil, &fakeAPIError{"InvalidSecurityGroup.NotInVpc", "The specified security group is not in the vpc of the vswitch."}
+		}
+		instance.InstanceNetworkType = InstanceNetworkVpc
+		instance.VpcAttributes.VpcId = vSwitch.VpcId
+		instance.VpcAttributes.VSwitchId = vSwitchId
+		instance.VpcAttributes.PrivateIpAddress.IpAddress = []string{fmt.Sprintf("172.16.0.%d", len(f.instances)+10)}
+		instance.ZoneId = vSwitch.ZoneId
+	}
+
+	size, _ := strconv.Atoi(form.Get("SystemDisk.Size"))
+	f.addDisk(instance.InstanceId, DiskTypeSystem, form.Get("SystemDisk.Category"), size, "/dev/xvda")
+	for i := 1; form.Get(fmt.Sprintf("DataDisk.%d.Category", i)) != "" ||
+		form.Get(fmt.Sprintf("DataDisk.%d.Size", i)) != ""; i++ {
+		size, _ := strconv.Atoi(form.Get(fmt.Sprintf("DataDisk.%d.Size", i)))
+		f.addDisk(instance.InstanceId, DiskTypeData, form.Get(fmt.Sprintf("DataDisk.%d.Category", i)), size,
+			fmt.Sprintf("/dev/xvd%c", 'a'+i))
+	}
+
+	// The tags of the instance are added to its disks.
+	if tags := fakeTags(form); len(tags) > 0 {
+		f.tags[instance.InstanceId] = tags
+		for _, disk := range f.instanceDisks(instance.InstanceId) {
+			f.tags[disk.DiskId] = fakeTags(form)
+		}
+	}
+
+	f.instances[instance.InstanceId] = instance
+	return &ecs.CreateInstanceResponse{RequestId: f.newId("request"), InstanceId: instance.InstanceId}, nil
+}
+
+func (f *fakeAlicloudAPI) addDisk(instanceId, diskType, category string, size int, device string) {
+	disk := &ecs.Disk{
+		DiskId:     f.newId("d"),
+		InstanceId: instanceId,
+		Type:       diskType,
+		Category:   category,
+		Size:       size,
+		Device:     device,
+		Status:     "In_use",
+	}
+	f.disks[disk.DiskId] = disk
+}
+
+func (f *fakeAlicloudAPI) describeInstances(form url.Values) (interface{}, *fakeAPIError) {
+	response := &ecs.DescribeInstancesResponse{RequestId: f.newId("request")}
+	instanceIds := fakeJSONList(form, "InstanceIds")
+	for instanceId, instance := range f.instances {
+		if (len(instanceIds) > 0 && !ContainsInArray(instanceIds, instanceId)) || !f.hasTags(instanceId, form) {
+			continue
+		}
+		response.Instances.Instance = append(response.Instances.Instance, *instance)
+	}
+	response.TotalCount = len(response.Instances.Instance)
+	return response, nil
+}
+
+func (f *fakeAlicloudAPI) setInstanceStatus(form url.Values, status string) (interface{}, *fakeAPIError) {
+	instance, ok := f.instances[form.Get("InstanceId")]
+	if !ok {
+		return nil, fakeNotFound("InstanceId", form.Get("InstanceId"))
+	}
+	if instance.Status == status {
+		return nil, &fakeAPIError{"IncorrectInstanceStatus", "The current status of the resource does not support this operation."}
+	}
+	instance.Status = status
+	if status == InstanceStatusRunning {
+		// 密钥对在实例启动时才生效
+		f.bootKeyPairs[instance.InstanceId] = instance.KeyPairName
+		return &ecs.StartInstanceResponse{RequestId: f.newId("request")}, nil
+	}
+	return &ecs.StopInstanceResponse{RequestId: f.newId("request")}, nil
+}
+
+func (f *fakeAlicloudAPI) deleteInstance(form url.Values) (interface{}, *fakeAPIError) {
+	instanceId := form.Get("InstanceId")
+	instance, ok := f.instances[instanceId]
+	if !ok {
+		return nil, fakeNotFound("InstanceId", instanceId)
+	}
+	if instance.Status != InstanceStatusStopped && form.Get("Force") != "true" {
+		return nil, &fakeAPIError{"IncorrectInstanceStatus", "The current status of the instance does not support this operation."}
+	}
+	for _, eip := range f.eips {
+		if eip.InstanceId == instanceId {
+			eip.InstanceId = ""
+			eip.Status = EipStatusAvailable
+		}
+	}
+	for _, disk := range f.instanceDisks(instanceId) {
+		delete(f.disks, disk.DiskId)
+	}
+	delete(f.instances, instanceId)
+	return &ecs.DeleteInstanceResponse{RequestId: f.newId("request")}, nil
+}
+
+func (f *fakeAlicloudAPI) createKeyPair(form url.Values) (interface{}, *fakeAPIError) {
+	name := form.Get("KeyPairName")
+	if _, ok := f.keyPairs[name]; ok {
+		return nil, &fakeAPIError{"KeyPair.AlreadyExist", "The key pair already exists."}
+	}
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, &fakeAPIError{"InternalError", err.Error()}
+	}
+	privateKeyDER, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return nil, &fakeAPIError{"InternalError", err.Error()}
+	}
+	publicKey, err := ssh.NewPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, &fakeAPIError{"InternalError", err.Error()}
+	}
+
+	f.keyPairs[name] = &ecs.KeyPair{KeyPairName: name, CreationTime: fakeNow()}
+	f.publicKeys[name] = publicKey
+	if tags := fakeTags(form); len(tags) > 0 {
+		f.tags[name] = tags
+	}
+	return &ecs.CreateKeyPairResponse{
+		RequestId:          f.newId("request"),
+		KeyPairName:        name,
+		KeyPairFingerPrint: ssh.FingerprintLegacyMD5(publicKey),
+		PrivateKeyBody:     string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateKeyDER})),
+	}, nil
+}
+
+func (f *fakeAlicloudAPI) attachKeyPair(form url.Values, keyPairName string) (interface{}, *fakeAPIError) {
+	if _, ok := f.keyPairs[form.Get("KeyPairName")]; !ok {
+		return nil, fakeNotFound("KeyPairName", form.Get("KeyPairName"))
+	}
+	for _, instanceId := range fakeJSONList(form, "InstanceIds") {
+		instance, ok := f.instances[instanceId]
+		if !ok {
+			return nil, fakeNotFound("InstanceId", instanceId)
+		}
+		instance.KeyPairName = keyPairName
+	}
+	if keyPairName == "" {
+		return &ecs.DetachKeyPairResponse{RequestId: f.newId("request")}, nil
+	}
+	return &ecs.AttachKeyPairResponse{RequestId: f.newId("request")}, nil
+}
+
+func (f *fakeAlicloudAPI) deleteKeyPairs(form url.Values) (interface{}, *fakeAPIError) {
+	for _, name := range fakeJSONList(form, "KeyPairNames") {
+		delete(f.keyPairs, name)
+	}
+	return &ecs.DeleteKeyPairsResponse{RequestId: f.newId("request")}, nil
+}
+
+func (f *fakeAlicloudAPI) describeKeyPairs(form url.Values) (interface{}, *fakeAPIError) {
+	response := &ecs.DescribeKeyPairsResponse{RequestId: f.newId("request")}
+	for name, keyPair := range f.keyPairs {
+		if (form.Get("KeyPairName") != "" && form.Get("KeyPairName") != name) || !f.hasTags(name, form) {
+			continue
+		}
+		response.KeyPairs.KeyPair = append(response.KeyPairs.KeyPair, *keyPair)
+	}
+	response.TotalCount = len(response.KeyPairs.KeyPair)
+	return response, nil
+}
+
+func (f *fakeAlicloudAPI) createVpc(form url.Values) (interface{}, *fakeAPIError) {
+	v := &ecs.Vpc{
+		VpcId:        f.newId("vpc"),
+		VpcName:      form.Get("VpcName"),
+		RegionId:     f.region(form),
+		CidrBlock:    form.Get("CidrBlock"),
+		VRouterId:    f.newId("vrt"),
+		Status:       "Available",
+		CreationTime: fakeNow(),
+	}
+	f.vpcs[v.VpcId] = v
+	if tags := fakeTags(form); len(tags) > 0 {
+		f.tags[v.VpcId] = tags
+	}
+	return &ecs.CreateVpcResponse{RequestId: f.newId("request"), VpcId: v.VpcId, VRouterId: v.VRouterId}, nil
+}
+
+func (f *fakeAlicloudAPI) describeVpcs(form url.Values) (interface{}, *fakeAPIError) {
+	response := &ecs.DescribeVpcsResponse{RequestId: f.newId("request")}
+	for _, v := range f.vpcs {
+		if (form.Get("VpcId") != "" && form.Get("VpcId") != v.VpcId) || !f.hasTags(v.VpcId, form) {
+			continue
+		}
+		response.Vpcs.Vpc = append(response.Vpcs.Vpc, *v)
+	}
+	response.TotalCount = len(response.Vpcs.Vpc)
+	return response, nil
+}
+
+func (f *fakeAlicloudAPI) deleteVpc(form url.Values) (interface{}, *fakeAPIError) {
+	vpcId := form.Get("VpcId")
+	if _, ok := f.vpcs[vpcId]; !ok {
+		return nil, fakeNotFound("VpcId", vpcId)
+	}
+	for _, vSwitch := range f.vSwitches {
+		if vSwitch.VpcId == vpcId {
+			return nil, &fakeAPIError{"DependencyViolation.VSwitch", "The specified vpc has vswitches."}
+		}
+	}
+	for _, securityGroup := range f.securityGroups {
+		if securityGroup.VpcId == vpcId {
+			return nil, &fakeAPIError{"DependencyViolation.SecurityGroup", "The specified vpc has security groups."}
+		}
+	}
+	delete(f.vpcs, vpcId)
+	return &ecs.DeleteVpcResponse{RequestId: f.newId("request")}, nil
+}
+
+func (f *fakeAlicloudAPI) createVSwitch(form url.Values) (interface{}, *fakeAPIError) {
+	vpcId := form.Get("VpcId")
+	if _, ok := f.vpcs[vpcId]; !ok {
+		return nil, fakeNotFound("VpcId", vpcId)
+	}
+	vSwitch := &vpc.VSwitch{
+		VSwitchId:    f.newId("vsw"),
+		VSwitchName:  form.Get("VSwitchName"),
+		VpcId:        vpcId,
+		ZoneId:       form.Get("ZoneId"),
+		CidrBlock:    form.Get("CidrBlock"),
+		Status:       VSwitchStatusAvailable,
+		CreationTime: fakeNow(),
+	}
+	f.vSwitches[vSwitch.VSwitchId] = vSwitch
+	if tags := fakeTags(form); len(tags) > 0 {
+		f.tags[vSwitch.VSwitchId] = tags
+	}
+	return &vpc.CreateVSwitchResponse{RequestId: f.newId("request"), VSwitchId: vSwitch.VSwitchId}, nil
+}
+
+func (f *fakeAlicloudAPI) describeVSwitches(form url.Values) (interface{}, *fakeAPIError) {
+	response := &vpc.DescribeVSwitchesResponse{RequestId: f.newId("request")}
+	for _, vSwitch := range f.vSwitches {
+		if (form.Get("VpcId") != "" && form.Get("VpcId") != vSwitch.VpcId) ||
+			(form.Get("VSwitchId") != "" && form.Get("VSwitchId") != vSwitch.VSwitchId) ||
+			(form.Get("VSwitchName") != "" && form.Get("VSwitchName") != vSwitch.VSwitchName) ||
+			(form.Get("ZoneId") != "" && form.Get("ZoneId") != vSwitch.ZoneId) ||
+			!f.hasTags(vSwitch.VSwitchId, form) {
+			continue
+		}
+		response.VSwitches.VSwitch = append(response.VSwitches.VSwitch, *vSwitch)
+	}
+	response.TotalCount = len(response.VSwitches.VSwitch)
+	return response, nil
+}
+
+func (f *fakeAlicloudAPI) deleteVSwitch(form url.Values) (interface{}, *fakeAPIError) {
+	vSwitchId := form.Get("VSwitchId")
+	if _, ok := f.vSwitches[vSwitchId]; !ok {
+		return nil, fakeNotFound("VSwitchId", vSwitchId)
+	}
+	for _, instance := range f.instances {
+		if instance.VpcAttributes.VSwitchId == vSwitchId {
+			return nil, &fakeAPIError{"DependencyViolation", "The specified vswitch has instances."}
+		}
+	}
+	delete(f.vSwitches, vSwitchId)
+	return &ecs.DeleteVSwitchResponse{RequestId: f.newId("request")}, nil
+}
+
+func (f *fakeAlicloudAPI) createSecurityGroup(form url.Values) (interface{}, *fakeAPIError) {
+	vpcId := form.Get("VpcId")
+	if vpcId != "" {
+		if _, ok := f.vpcs[vpcId]; !ok {
+			return nil, fakeNotFound("VpcId", vpcId)
+		}
+	}
+	securityGroup := &ecs.SecurityGroup{
+		SecurityGroupId:   f.newId("sg"),
+		SecurityGroupName: form.Get("SecurityGroupName"),
+		VpcId:             vpcId,
+		CreationTime:      fakeNow(),
+	}
+	f.securityGroups[securityGroup.SecurityGroupId] = securityGroup
+	if tags := fakeTags(form); len(tags) > 0 {
+		f.tags[securityGroup.SecurityGroupId] = tags
+	}
+	return &ecs.CreateSecurityGroupResponse{RequestId: f.newId("request"), SecurityGroupId: securityGroup.SecurityGroupId}, nil
+}
+
+func (f *fakeAlicloudAPI) describeSecurityGroups(form url.Values) (interface{}, *fakeAPIError) {
+	response := &ecs.DescribeSecurityGroupsResponse{RequestId: f.newId("request"), RegionId: f.region(form)}
+	for _, securityGroup := range f.securityGroups {
+		if (form.Get("VpcId") != "" && form.Get("VpcId") != securityGroup.VpcId) ||
+			(form.Get("SecurityGroupId") != "" && form.Get("SecurityGroupId") != securityGroup.SecurityGroupId) ||
+			!f.hasTags(securityGroup.SecurityGroupId, form) {
+			continue
+		}
+		response.SecurityGroups.SecurityGroup = append(response.SecurityGroups.SecurityGroup, *securityGroup)
+	}
+	response.TotalCount = len(response.SecurityGroups.SecurityGroup)
+	return response, nil
+}
+
+func (f *fakeAlicloudAPI) authorizeSecurityGroup(form url.Values, direction string) (interface{}, *fakeAPIError) {
+	securityGroupId := form.Get("SecurityGroupId")
+	if _, ok := f.securityGroups[securityGroupId]; !ok {
+		return nil, fakeNotFound("SecurityGroupId", securityGroupId)
+	}
+	rule := fakeSecurityGroupRule{
+		Direction:  direction,
+		IpProtocol: form.Get("IpProtocol"),
+		PortRange:  form.Get("PortRange"),
+		CidrIp:     form.Get("SourceCidrIp"),
+	}
+	if direction == "egress" {
+		rule.CidrIp = form.Get("DestCidrIp")
+	}
+	f.rules[securityGroupId] = append(f.rules[securityGroupId], rule)
+	if direction == "egress" {
+		return &ecs.AuthorizeSecurityGroupEgressResponse{RequestId: f.newId("request")}, nil
+	}
+	return &ecs.AuthorizeSecurityGroupResponse{RequestId: f.newId("request")}, nil
+}
+
+func (f *fakeAlicloudAPI) deleteSecurityGroup(form url.Values) (interface{}, *fakeAPIError) {
+	securityGroupId := form.Get("SecurityGroupId")
+	if _, ok := f.securityGroups[securityGroupId]; !ok {
+		return nil, fakeNotFound("SecurityGroupId", securityGroupId)
+	}
+	for _, instance := range f.instances {
+		if ContainsInArray(instance.SecurityGroupIds.SecurityGroupId, securityGroupId) {
+			return nil, &fakeAPIError{"DependencyViolation", "The specified security group has instances."}
+		}
+	}
+	delete(f.securityGroups, securityGroupId)
+	delete(f.rules, securityGroupId)
+	return &ecs.DeleteSecurityGroupResponse{RequestId: f.newId("request")}, nil
+}
+
+func (f *fakeAlicloudAPI) allocateEipAddress(form url.Values) (interface{}, *fakeAPIError) {
+	eip := &ecs.EipAddress{
+		AllocationId:       f.newId("eip"),
+		IpAddress:          f.newIpAddress("47.0.0.%d", len(f.eips)+10),
+		RegionId:           f.region(form),
+		InternetChargeType: form.Get("InternetChargeType"),
+		Bandwidth:          form.Get("Bandwidth"),
+		Status:             EipStatusAvailable,
+		AllocationTime:     fakeNow(),
+	}
+	f.eips[eip.AllocationId] = eip
+	if tags := fakeTags(form); len(tags) > 0 {
+		f.tags[eip.AllocationId] = tags
+	}
+	return &ecs.AllocateEipAddressResponse{RequestId: f.newId("request"), AllocationId: eip.AllocationId, EipAddress: eip.IpAddress}, nil
+}
+
+func (f *fakeAlicloudAPI) setEipStatus(form url.Values, status string) (interface{}, *fakeAPIError) {
+	eip, ok := f.eips[form.Get("AllocationId")]
+	if !ok {
+		return nil, fakeNotFound("AllocationId", form.Get("AllocationId"))
+	}
+	eip.Status = status
+	if status == EipStatusInUse {
+		if _, ok := f.instances[form.Get("InstanceId")]; !ok {
+			return nil, fakeNotFound("InstanceId", form.Get("InstanceId"))
+		}
+		eip.InstanceId = form.Get("InstanceId")
+		return &ecs.AssociateEipAddressResponse{RequestId: f.newId("request")}, nil
+	}
+	eip.InstanceId = ""
+	return &ecs.UnassociateEipAddressResponse{RequestId: f.newId("request")}, nil
+}
+
+func (f *fakeAlicloudAPI) describeEipAddresses(form url.Values) (interface{}, *fakeAPIError) {
+	response := &ecs.DescribeEipAddressesResponse{RequestId: f.newId("request")}
+	for _, eip := range f.eips {
+		if (form.Get("AllocationId") != "" && form.Get("AllocationId") != eip.AllocationId) || !f.hasTags(eip.AllocationId, form) {
+			continue
+		}
+		response.EipAddresses.EipAddress = append(response.EipAddresses.EipAddress, *eip)
+	}
+	response.TotalCount = len(response.EipAddresses.EipAddress)
+	return response, nil
+}
+
+func (f *fakeAlicloudAPI) releaseEipAddress(form url.Values) (interface{}, *fakeAPIError) {
+	eip, ok := f.eips[form.Get("AllocationId")]
+	if !ok {
+		return nil, fakeNotFound("AllocationId", form.Get("AllocationId"))
+	}
+	if eip.Status != EipStatusAvailable {
+		return nil, &fakeAPIError{"IncorrectEipStatus", "The current status of the eip does not support this operation."}
+	}
+	delete(f.eips, eip.AllocationId)
+	return &ecs.ReleaseEipAddressResponse{RequestId: f.newId("request")}, nil
+}
+
+func (f *fakeAlicloudAPI) allocatePublicIpAddress(form url.Values) (interface{}, *fakeAPIError) {
+	instance, ok := f.instances[form.Get("InstanceId")]
+	if !ok {
+		return nil, fakeNotFound("InstanceId", form.Get("InstanceId"))
+	}
+	ipAddress := f.newIpAddress("39.0.0.%d", len(f.instances)+10)
+	instance.PublicIpAddress.IpAddress = []string{ipAddress}
+	return &ecs.AllocatePublicIpAddressResponse{RequestId: f.newId("request"), IpAddress: ipAddress}, nil
+}
+
+func (f *fakeAlicloudAPI) addTags(form url.Values) (interface{}, *fakeAPIError) {
+	resourceId := form.Get("ResourceId")
+	if f.tags[resourceId] == nil {
+		f.tags[resourceId] = map[string]string{}
+	}
+	for key, value := range fakeTags(form) {
+		f.tags[resourceId][key] = value
+	}
+	return &ecs.AddTagsResponse{RequestId: f.newId("request")}, nil
+}
+
+func (f *fakeAlicloudAPI) describeTags(form url.Values) (interface{}, *fakeAPIError) {
+	response := &ecs.DescribeTagsResponse{RequestId: f.newId("request")}
+	for key, value := range f.tags[form.Get("ResourceId")] {
+		response.Tags.Tag = append(response.Tags.Tag, ecs.Tag{TagKey: key, TagValue: value})
+	}
+	response.TotalCount = len(response.Tags.Tag)
+	return response, nil
+}
+
+func (f *fakeAlicloudAPI) describeCloudAssistantStatus(form url.Values) (interface{}, *fakeAPIError) {
+	instanceId := form.Get("InstanceId.1")
+	if _, ok := f.instances[instanceId]; !ok {
+		return nil, fakeNotFound("InstanceId", instanceId)
+	}
+	response := &ecs.DescribeCloudAssistantStatusResponse{RequestId: f.newId("request"), TotalCount: 1}
+	response.InstanceCloudAssistantStatusSet.InstanceCloudAssistantStatus = []ecs.InstanceCloudAssistantStatus{{
+		InstanceId:            instanceId,
+		OSType:                "Linux",
+		CloudAssistantStatus:  "true",
+		CloudAssistantVersion: "2.2.3.398",
+	}}
+	return response, nil
+}
+
+// runCommand runs the shell scripts on the local machine, as if it were the
+// instance, so that the files transferred by the cloud-assistant
+// communicator can be checked.
+func (f *fakeAlicloudAPI) runCommand(form url.Values) (interface{}, *fakeAPIError) {
+	instanceId := form.Get("InstanceId.1")
+	if _, ok := f.instances[instanceId]; !ok {
+		return nil, fakeNotFound("InstanceId", instanceId)
+	}
+	if form.Get("Type") != CommandTypeShell {
+		return nil, &fakeAPIError{"InvalidParameter", fmt.Sprintf("The fake API only runs %s commands.", CommandTypeShell)}
+	}
+	content, err := base64.StdEncoding.DecodeString(form.Get("CommandContent"))
+	if err != nil {
+		return nil, &fakeAPIError{"InvalidParameter", err.Error()}
+	}
+
+	result := &ecs.InvocationResult{
+		InvokeId:         f.newId("t"),
+		InstanceId:       instanceId,
+		InvocationStatus: InvocationStatusSuccess,
+	}
+	output, err := exec.Command("/bin/sh", "-c", string(content)).CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.InvocationStatus = InvocationStatusFailed
+		result.ExitCode = int64(exitErr.ExitCode())
+	} else if err != nil {
+		return nil, &fakeAPIError{"InternalError", err.Error()}
+	}
+	result.Output = base64.StdEncoding.EncodeToString(output)
+	f.invocations[result.InvokeId] = result
+
+	return &ecs.RunCommandResponse{RequestId: f.newId("request"), CommandId: f.newId("c"), InvokeId: result.InvokeId}, nil
+}
+
+func (f *fakeAlicloudAPI) describeInvocationResults(form url.Values) (interface{}, *fakeAPIError) {
+	result, ok := f.invocations[form.Get("InvokeId")]
+	if !ok {
+		return nil, fakeNotFound("InvokeId", form.Get("InvokeId"))
+	}
+	response := &ecs.DescribeInvocationResultsResponse{RequestId: f.newId("request")}
+	response.Invocation.InvocationResults.InvocationResult = []ecs.InvocationResult{*result}
+	return response, nil
+}
+
+func (f *fakeAlicloudAPI) describeKey(form url.Values) (interface{}, *fakeAPIError) {
+	keyId := form.Get("KeyId")
+	state, ok := f.KMSKeys[f.region(form)][keyId]
+	if !ok {
+		return nil, &fakeAPIError{"Forbidden.KeyNotFound", fmt.Sprintf("The specified Key %s is not found.", keyId)}
+	}
+
+	response := &kms.DescribeKeyResponse{RequestId: f.newId("request")}
+	response.KeyMetadata.KeyId = keyId
+	response.KeyMetadata.KeyState = state
+	return response, nil
+}
+
+func (f *fakeAlicloudAPI) exportImage(form url.Values) (interface{}, *fakeAPIError) {
+	image, ok := f.images[form.Get("ImageId")]
+	if !ok || image.RegionId != f.region(form) {
+		return nil, fakeNotFound("ImageId", form.Get("ImageId"))
+	}
+
+	task := &ecs.DescribeTaskAttributeResponse{
+		TaskId:       f.newId("t"),
+		RegionId:     f.region(form),
+		TaskAction:   "ExportImage",
+		TaskStatus:   TaskStatusFinished,
+		TaskProcess:  "100%",
+		CreationTime: fakeNow(),
+		FinishedTime: fakeNow(),
+	}
+	if ContainsInArray(f.FailedExports, image.Image.ImageId) {
+		task.TaskStatus = TaskStatusFailed
+		task.TaskProcess = "50%"
+	}
+	f.tasks[task.TaskId] = task
+
+	return &ecs.ExportImageResponse{RequestId: f.newId("request"), TaskId: task.TaskId, RegionId: task.RegionId}, nil
+}
+
+func (f *fakeAlicloudAPI) describeTaskAttribute(form url.Values) (interface{}, *fakeAPIError) {
+	task, ok := f.tasks[form.Get("TaskId")]
+	if !ok || task.RegionId != f.region(form) {
+		return nil, fakeNotFound("TaskId", form.Get("TaskId"))
+	}
+
+	response := *task
+	response.RequestId = f.newId("request")
+	return &response, nil
+}
@@ -57,6 +57,10 @@ type AlicloudDiskDevice struct {
 	// it was in the source image. Please refer to Introduction of ECS disk
 	// encryption for more details.
 	Encrypted config.Trilean `mapstructure:"disk_encrypted" required:"false"`
+	// The ID of the KMS key encrypting the disk, in the region of the build.
+	// It requires `disk_encrypted` to be true. By default, the disk is
+	// encrypted with the default service key of the region.
+	KMSKeyId string `mapstructure:"disk_kms_key_id" required:"false"`
 }
 
 // The "AlicloudDiskDevices" object is used to define disk mappings for your
@@ -98,6 +102,38 @@ type AlicloudDiskDevices struct {
 	ECSImagesDiskMappings []AlicloudDiskDevice `mapstructure:"image_disk_mappings" required:"false"`
 }
 
+// defaultImageCopyConcurrency is the number of regions the image is copied to
+// at the same time by default.
+const defaultImageCopyConcurrency = 4
+
+// The "AlicloudImageCopyRegion" object is used for the `image_copy_region`
+// option, and contains the following fields:
+type AlicloudImageCopyRegion struct {
+	// The region the image is copied to.
+	Region string `mapstructure:"region" required:"true"`
+	// The name of the copy, [2, 128] English or Chinese characters. It must
+	// begin with an uppercase/lowercase letter or a Chinese character, and may
+	// contain numbers, _ or -. It cannot begin with `http://` or `https://`.
+	Name string `mapstructure:"name" required:"false"`
+	// The description of the copy, with a length limit of 0 to 256
+	// characters. It cannot begin with `http://` or `https://`.
+	Description string `mapstructure:"description" required:"false"`
+	// Whether or not to encrypt the copy. By default, it is `image_encrypted`.
+	Encrypted config.Trilean `mapstructure:"encrypted" required:"false"`
+	// The ID of the KMS key encrypting the copy. By default, the copy is
+	// encrypted with the default service key of the region.
+	KMSKeyId string `mapstructure:"kms_key_id" required:"false"`
+}
+
+// encrypted returns the encryption of the copy, which defaults to the one of
+// the image.
+func (r *AlicloudImageCopyRegion) encrypted(imageEncrypted config.Trilean) config.Trilean {
+	if r.Encrypted != config.TriUnset {
+		return r.Encrypted
+	}
+	return imageEncrypted
+}
+
 type AlicloudImageConfig struct {
 	// The name of the user-defined image, [2, 128] English or Chinese
 	// characters. It must begin with an uppercase/lowercase letter or a
@@ -114,18 +150,45 @@ type AlicloudImageConfig struct {
 	// The ID of the resource group to which to assign the custom image.
 	// If you do not specify this parameter, the image is assigned to the default resource group.
 	AlicloudResourceGroupId string `mapstructure:"resource_group_id" required:"false"`
+	// The image family the image and its copies are added to, so that the
+	// latest image of the family can be selected by `image_family`. [2, 128]
+	// characters, which cannot begin with `aliyun`, `acs:`, `http://` or
+	// `https://`.
+	TargetImageFamily string `mapstructure:"target_image_family" required:"false"`
+	// The boot mode of the image and its copies, `BIOS` or `UEFI`. By
+	// default, the image keeps the boot mode of the source image.
+	ImageBootMode string `mapstructure:"image_boot_mode" required:"false"`
+	// The architecture of the image, `i386`, `x86_64` or `arm64`. By
+	// default, it is the architecture of the source image.
+	ImageArchitecture string `mapstructure:"image_architecture" required:"false"`
+	// Whether the image and its copies support NVMe, which instance types
+	// attaching their disks over NVMe require. By default, the image keeps
+	// the NVMe support of the source image.
+	ImageNvmeSupport config.Trilean `mapstructure:"image_nvme_support" required:"false"`
 	// The IDs of to-be-added Aliyun accounts to which the image is shared. The
 	// number of accounts is 1 to 10. If number of accounts is greater than 10,
 	// this parameter is ignored.
 	AlicloudImageShareAccounts   []string `mapstructure:"image_share_account" required:"false"`
 	AlicloudImageUNShareAccounts []string `mapstructure:"image_unshare_account"`
-	// Copy to the destination regionIds.
+	// Copy to the destination regionIds. Deprecated in favor of
+	// `image_copy_region`.
 	AlicloudImageDestinationRegions []string `mapstructure:"image_copy_regions" required:"false"`
 	// The name of the destination image, [2, 128] English or Chinese
 	// characters. It must begin with an uppercase/lowercase letter or a
 	// Chinese character, and may contain numbers, _ or -. It cannot begin with
-	// `http://` or `https://`.
+	// `http://` or `https://`. Deprecated in favor of `image_copy_region`.
 	AlicloudImageDestinationNames []string `mapstructure:"image_copy_names" required:"false"`
+	// The regions the image is copied to, with the name, the description and
+	// the encryption of every copy. See the [`image_copy_region`](#image-copy-region)
+	// block below.
+	AlicloudImageCopyRegions []AlicloudImageCopyRegion `mapstructure:"image_copy_region" required:"false"`
+	// If this value is true, the build waits for the copies of the image to be
+	// available, and fails if any of them fails to be created. By default, the
+	// build only waits for the copies it has to tag or modify.
+	WaitForCopiedImages bool `mapstructure:"wait_for_copied_images" required:"false"`
+	// The number of regions the image is copied to at the same time. The
+	// default value is 4.
+	ImageCopyConcurrency int `mapstructure:"image_copy_concurrency" required:"false"`
 	// Whether or not to encrypt the target images,            including those
 	// copied if image_copy_regions is specified. If this option is set to
 	// true, a temporary image will be created from the provisioned instance in
@@ -133,6 +196,12 @@ type AlicloudImageConfig struct {
 	// region. By default, Packer will keep the encryption setting to what it
 	// was in the source image.
 	ImageEncrypted config.Trilean `mapstructure:"image_encrypted" required:"false"`
+	// The ID of the KMS key encrypting the image in the region of the build.
+	// It requires `image_encrypted` to be true. KMS keys belong to a region,
+	// so every encrypted copy of `image_copy_region` then needs its own
+	// `kms_key_id`. By default, the image is encrypted with the default
+	// service key of the region.
+	ImageKMSKeyId string `mapstructure:"image_kms_key_id" required:"false"`
 	// If this value is true, when the target image names including those
 	// copied are duplicated with existing images, it will delete the existing
 	// images and then create the target images, otherwise, the creation will
@@ -159,9 +228,14 @@ type AlicloudImageConfig struct {
 	// containing a `key` and a `value` field. In HCL2 mode the
 	// [`dynamic_block`](/packer/docs/templates/hcl_templates/expressions#dynamic-blocks)
 	// will allow you to create those programatically.
-	AlicloudImageTag    config.KeyValues `mapstructure:"tag" required:"false"`
-	AlicloudDiskDevices `mapstructure:",squash"`
-	SkipIfExists        bool `mapstructure:"skip_if_exists" required:"false"`
+	AlicloudImageTag config.KeyValues `mapstructure:"tag" required:"false"`
+	// Key/value pair tags applied to the image in a region and its snapshots,
+	// keyed by the region, either the region of the build or one of the
+	// regions the image is copied to. They are merged with [`tags`](#tags), and override
+	// the tags with the same keys.
+	AlicloudImageRegionTags map[string]map[string]string `mapstructure:"image_region_tags" required:"false"`
+	AlicloudDiskDevices     `mapstructure:",squash"`
+	SkipIfExists            bool `mapstructure:"skip_if_exists" required:"false"`
 }
 
 func (c *AlicloudImageConfig) Prepare(ctx *interpolate.Context) []error {
@@ -180,6 +254,65 @@ func (c *AlicloudImageConfig) Prepare(ctx *interpolate.Context) []error {
 		errs = append(errs, fmt.Errorf("image_name can't include spaces"))
 	}
 
+	if c.TargetImageFamily != "" {
+		if len(c.TargetImageFamily) < 2 || len(c.TargetImageFamily) > 128 {
+			errs = append(errs, fmt.Errorf("target_image_family must less than 128 letters and more than 1 letters"))
+		}
+		for _, prefix := range []string{"aliyun", "acs:", "http://", "https://"} {
+			if strings.HasPrefix(c.TargetImageFamily, prefix) {
+				errs = append(errs, fmt.Errorf("target_image_family can't start with '%s'", prefix))
+			}
+		}
+	}
+
+	if c.ImageBootMode != "" && !ContainsInArray([]string{ImageBootModeBIOS, ImageBootModeUEFI}, c.ImageBootMode) {
+		errs = append(errs, fmt.Errorf("image_boot_mode must be one of %s or %s", ImageBootModeBIOS, ImageBootModeUEFI))
+	}
+
+	if c.ImageArchitecture != "" && !ContainsInArray([]string{ImageArchitectureI386, ImageArchitectureX86_64, ImageArchitectureArm64}, c.ImageArchitecture) {
+		errs = append(errs, fmt.Errorf("image_architecture must be one of %s, %s or %s", ImageArchitectureI386, ImageArchitectureX86_64, ImageArchitectureArm64))
+	}
+
+	if c.ImageKMSKeyId != "" && !c.ImageEncrypted.True() {
+		errs = append(errs, fmt.Errorf("image_kms_key_id requires image_encrypted to be true"))
+	}
+	if c.ECSSystemDiskMapping.KMSKeyId != "" && !c.ECSSystemDiskMapping.Encrypted.True() {
+		errs = append(errs, fmt.Errorf("disk_kms_key_id of system_disk_mapping requires disk_encrypted to be true"))
+	}
+	for _, imageDisk := range c.ECSImagesDiskMappings {
+		if imageDisk.KMSKeyId != "" && !imageDisk.Encrypted.True() {
+			errs = append(errs, fmt.Errorf("disk_kms_key_id of image_disk_mappings requires disk_encrypted to be true"))
+		}
+	}
+
+	copyRegionSet := make(map[string]struct{})
+	for _, copyRegion := range c.AlicloudImageCopyRegions {
+		copyRegionSet[copyRegion.Region] = struct{}{}
+	}
+
+	// image_copy_regions 和 image_copy_names 转换为 image_copy_region，已有的地域以 image_copy_region 为准
+	for index, region := range c.AlicloudImageDestinationRegions {
+		if _, ok := copyRegionSet[region]; ok {
+			continue
+		}
+		copyRegionSet[region] = struct{}{}
+
+		copyRegion := AlicloudImageCopyRegion{Region: region}
+		if index < len(c.AlicloudImageDestinationNames) {
+			copyRegion.Name = c.AlicloudImageDestinationNames[index]
+		}
+		c.AlicloudImageCopyRegions = append(c.AlicloudImageCopyRegions, copyRegion)
+	}
+
+	// 合并后再校验，image_copy_regions 中的地域同样需要各自的 KMS 密钥
+	errs = append(errs, PrepareCopyRegions(c.AlicloudImageCopyRegions, c.ImageEncrypted, c.ImageKMSKeyId)...)
+
+	if c.ImageCopyConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("image_copy_concurrency can't be negative"))
+	} else if c.ImageCopyConcurrency == 0 {
+		c.ImageCopyConcurrency = defaultImageCopyConcurrency
+	}
+
 	if len(c.AlicloudImageDestinationRegions) > 0 {
 		regionSet := make(map[string]struct{})
 		regions := make([]string, 0, len(c.AlicloudImageDestinationRegions))
@@ -200,3 +333,47 @@ func (c *AlicloudImageConfig) Prepare(ctx *interpolate.Context) []error {
 
 	return errs
 }
+
+// PrepareCopyRegions validates the image_copy_region blocks of an image whose
+// encryption is imageEncrypted, with the KMS key imageKMSKeyId if any.
+func PrepareCopyRegions(copyRegions []AlicloudImageCopyRegion, imageEncrypted config.Trilean, imageKMSKeyId string) []error {
+	var errs []error
+	copyRegionSet := make(map[string]struct{})
+	for _, copyRegion := range copyRegions {
+		if copyRegion.Region == "" {
+			errs = append(errs, fmt.Errorf("region must be specified in image_copy_region"))
+			continue
+		}
+		if _, ok := copyRegionSet[copyRegion.Region]; ok {
+			errs = append(errs, fmt.Errorf("image_copy_region %s is specified more than once", copyRegion.Region))
+		}
+		copyRegionSet[copyRegion.Region] = struct{}{}
+
+		if copyRegion.KMSKeyId != "" && !copyRegion.encrypted(imageEncrypted).True() {
+			errs = append(errs, fmt.Errorf("kms_key_id of image_copy_region %s requires the copy to be encrypted", copyRegion.Region))
+		}
+		if copyRegion.KMSKeyId == "" && imageKMSKeyId != "" && copyRegion.encrypted(imageEncrypted).True() {
+			errs = append(errs, fmt.Errorf("The copy to %s must specify its own kms_key_id in image_copy_region when image_kms_key_id is specified", copyRegion.Region))
+		}
+	}
+
+	return errs
+}
+
+// regionImageTags returns the tags of the image in the region, overridden by
+// the tags of the region.
+func (c *AlicloudImageConfig) regionImageTags(regionId string) map[string]string {
+	regionTags, ok := c.AlicloudImageRegionTags[regionId]
+	if !ok {
+		return c.AlicloudImageTags
+	}
+
+	tags := make(map[string]string, len(c.AlicloudImageTags)+len(regionTags))
+	for key, value := range c.AlicloudImageTags {
+		tags[key] = value
+	}
+	for key, value := range regionTags {
+		tags[key] = value
+	}
+	return tags
+}
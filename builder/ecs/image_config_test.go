@@ -4,9 +4,12 @@
 package ecs
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
 )
 
 func testAlicloudImageConfig() *AlicloudImageConfig {
@@ -72,3 +75,120 @@ func TestSkipIfExists(t *testing.T) {
 		}
 	}
 }
+
+func TestECSImageConfigPrepare_Features(t *testing.T) {
+	c := testAlicloudImageConfig()
+	c.TargetImageFamily = "web-server"
+	c.ImageBootMode = ImageBootModeUEFI
+	c.ImageArchitecture = ImageArchitectureArm64
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.TargetImageFamily = "aliyun-family"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("target_image_family starting with aliyun should have error: %s", err)
+	}
+
+	c.TargetImageFamily = ""
+	c.ImageBootMode = "Legacy"
+	c.ImageArchitecture = "amd64"
+	if err := c.Prepare(nil); len(err) != 2 {
+		t.Fatalf("bad image_boot_mode and image_architecture should have errors: %s", err)
+	}
+}
+
+func TestECSImageConfigPrepare_copyRegions(t *testing.T) {
+	c := testAlicloudImageConfig()
+	c.AlicloudImageCopyRegions = []AlicloudImageCopyRegion{{Region: "cn-hangzhou", Name: "foo-hz"}}
+	c.AlicloudImageDestinationRegions = []string{"cn-hangzhou", "cn-shanghai"}
+	c.AlicloudImageDestinationNames = []string{"bar-hz", "bar-sh"}
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+
+	expected := []AlicloudImageCopyRegion{{Region: "cn-hangzhou", Name: "foo-hz"}, {Region: "cn-shanghai", Name: "bar-sh"}}
+	if !reflect.DeepEqual(c.AlicloudImageCopyRegions, expected) {
+		t.Fatalf("bad: expected %v, actual %v", expected, c.AlicloudImageCopyRegions)
+	}
+	if c.ImageCopyConcurrency != defaultImageCopyConcurrency {
+		t.Fatalf("bad: expected concurrency %d, actual %d", defaultImageCopyConcurrency, c.ImageCopyConcurrency)
+	}
+
+	c = testAlicloudImageConfig()
+	c.ImageCopyConcurrency = -1
+	if errs := c.Prepare(nil); len(errs) != 1 || !strings.Contains(errs[0].Error(), "can't be negative") {
+		t.Fatalf("should have error for a negative concurrency, actual: %v", errs)
+	}
+
+	c = testAlicloudImageConfig()
+	c.AlicloudImageCopyRegions = []AlicloudImageCopyRegion{{Region: "cn-hangzhou"}, {Region: "cn-hangzhou"}}
+	if err := c.Prepare(nil); err == nil {
+		t.Fatal("should have error for duplicated regions")
+	}
+
+	c = testAlicloudImageConfig()
+	c.AlicloudImageCopyRegions = []AlicloudImageCopyRegion{{Region: "cn-hangzhou", KMSKeyId: "key-1"}}
+	if err := c.Prepare(nil); err == nil {
+		t.Fatal("should have error for a KMS key without encryption")
+	}
+
+	c.AlicloudImageCopyRegions[0].Encrypted = config.TriTrue
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+}
+
+func TestECSImageConfigPrepare_kmsKeys(t *testing.T) {
+	c := testAlicloudImageConfig()
+	c.ImageKMSKeyId = "key-image"
+	if err := c.Prepare(nil); err == nil {
+		t.Fatal("should have error for a KMS key without image_encrypted")
+	}
+
+	c.ImageEncrypted = config.TriTrue
+	c.AlicloudImageCopyRegions = []AlicloudImageCopyRegion{{Region: "cn-hangzhou"}}
+	if err := c.Prepare(nil); err == nil {
+		t.Fatal("should have error for a copy region without its own KMS key")
+	}
+
+	c.AlicloudImageCopyRegions[0].KMSKeyId = "key-hangzhou"
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+
+	// The regions of image_copy_regions need their own KMS key too.
+	c = testAlicloudImageConfig()
+	c.ImageEncrypted = config.TriTrue
+	c.ImageKMSKeyId = "key-image"
+	c.AlicloudImageDestinationRegions = []string{"cn-hangzhou"}
+	if err := c.Prepare(nil); err == nil {
+		t.Fatal("should have error for an image_copy_regions region without its own KMS key")
+	}
+
+	c = testAlicloudImageConfig()
+	c.ImageEncrypted = config.TriTrue
+	c.ImageKMSKeyId = "key-image"
+	c.AlicloudImageDestinationRegions = []string{"cn-hangzhou"}
+	c.AlicloudImageCopyRegions = []AlicloudImageCopyRegion{{Region: "cn-hangzhou", KMSKeyId: "key-hangzhou"}}
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+
+	c = testAlicloudImageConfig()
+	c.ECSSystemDiskMapping.KMSKeyId = "key-disk"
+	if err := c.Prepare(nil); err == nil {
+		t.Fatal("should have error for a disk KMS key without disk_encrypted")
+	}
+
+	c.ECSSystemDiskMapping.Encrypted = config.TriTrue
+	c.ECSImagesDiskMappings = []AlicloudDiskDevice{{KMSKeyId: "key-disk"}}
+	if err := c.Prepare(nil); err == nil {
+		t.Fatal("should have error for a data disk KMS key without disk_encrypted")
+	}
+
+	c.ECSImagesDiskMappings[0].Encrypted = config.TriTrue
+	if err := c.Prepare(nil); err != nil {
+		t.Fatalf("shouldn't have err: %s", err)
+	}
+}
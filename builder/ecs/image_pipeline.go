@@ -0,0 +1,183 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ecs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// RunImagePipeline applies the image options of the config to an image
+// created outside of the builder, e.g. imported, the way the builder does
+// for the images it creates: it sets the family and features of the image,
+// tags it, copies and encrypts it, and shares the copies. It returns the
+// image of every region.
+//
+// When the image is encrypted, the given image is only the source of the
+// encrypted copy and is deleted once the copy is complete.
+func RunImagePipeline(ctx context.Context, ui packersdk.Ui, config *Config, client *ClientWrapper, imageId string) (map[string]string, error) {
+	return runImageSteps(ctx, ui, config, client, new(multistep.BasicStateBag), imagePipelineSteps(config, &stepUseAlicloudImage{
+		ImageId: imageId,
+	}))
+}
+
+// PromoteImage tags an existing image, copies it and shares it and its
+// copies with the image options of the config, e.g. to promote an image
+// built and tested beforehand. Unlike RunImagePipeline, the image is never
+// deleted, even when the promotion fails. It returns the image of every
+// region.
+func PromoteImage(ctx context.Context, ui packersdk.Ui, config *Config, client *ClientWrapper, imageId string) (map[string]string, error) {
+	return runImageSteps(ctx, ui, config, client, new(multistep.BasicStateBag), imagePipelineSteps(config, &stepUseAlicloudImage{
+		ImageId:   imageId,
+		KeepImage: true,
+	}))
+}
+
+// imagePipelineSteps returns the steps processing the image provided by
+// useImage the way the builder processes the images it creates.
+func imagePipelineSteps(config *Config, useImage *stepUseAlicloudImage) []multistep.Step {
+	return []multistep.Step{
+		useImage,
+		&stepCreateTags{
+			Tags: config.regionImageTags(config.AlicloudRegion),
+		},
+		newStepRegionCopyAlicloudImage(config, config.AlicloudRegion),
+		&stepShareAlicloudImage{
+			AlicloudImageShareAccounts:   config.AlicloudImageShareAccounts,
+			AlicloudImageUNShareAccounts: config.AlicloudImageUNShareAccounts,
+			RegionId:                     config.AlicloudRegion,
+		},
+	}
+}
+
+// CopySharedImage copies an image of the region shared by another account
+// into the account of the client, to the regions of the image_copy_region
+// blocks of the config, including the region of the image. The copies are
+// tagged like the copies of the builder. It returns the copy of every
+// region.
+func CopySharedImage(ctx context.Context, ui packersdk.Ui, config *Config, client *ClientWrapper, regionId string, imageId string) (map[string]string, error) {
+	step := newStepRegionCopyAlicloudImage(config, regionId)
+	step.SharedImage = true
+
+	state := new(multistep.BasicStateBag)
+	state.Put("alicloudimage", imageId)
+	state.Put("alicloudimages", map[string]string{})
+	return runImageSteps(ctx, ui, config, client, state, []multistep.Step{step})
+}
+
+// runImageSteps runs the steps processing an image with the state and
+// returns the image of every region they leave in the alicloudimages state.
+func runImageSteps(ctx context.Context, ui packersdk.Ui, config *Config, client *ClientWrapper, state *multistep.BasicStateBag, steps []multistep.Step) (map[string]string, error) {
+	state.Put("config", config)
+	state.Put("client", client)
+	state.Put("ui", ui)
+
+	runner := commonsteps.NewRunner(steps, config.PackerConfig, ui)
+	runner.Run(ctx, state)
+
+	if rawErr, ok := state.GetOk("error"); ok {
+		return nil, rawErr.(error)
+	}
+	if _, ok := state.GetOk(multistep.StateCancelled); ok {
+		return nil, fmt.Errorf("Build was cancelled.")
+	}
+
+	return state.Get("alicloudimages").(map[string]string), nil
+}
+
+// newStepRegionCopyAlicloudImage returns the step copying the image of the
+// region with the copy options of the config.
+func newStepRegionCopyAlicloudImage(config *Config, regionId string) *stepRegionCopyAlicloudImage {
+	waitCopyingImageReadyTimeout := config.WaitCopyingImageReadyTimeout
+	if waitCopyingImageReadyTimeout <= 0 {
+		waitCopyingImageReadyTimeout = ALICLOUD_DEFAULT_LONG_TIMEOUT
+	}
+
+	return &stepRegionCopyAlicloudImage{
+		AlicloudImageCopyRegions:     config.AlicloudImageCopyRegions,
+		RegionId:                     regionId,
+		WaitCopyingImageReadyTimeout: waitCopyingImageReadyTimeout,
+		WaitForCopiedImages:          config.WaitForCopiedImages,
+		Concurrency:                  config.ImageCopyConcurrency,
+	}
+}
+
+// stepUseAlicloudImage provides an existing image to the steps following the
+// creation of the image, in place of stepCreateAlicloudImage.
+type stepUseAlicloudImage struct {
+	ImageId string
+	// KeepImage keeps the image when the following steps fail, as it is not
+	// owned by the build.
+	KeepImage bool
+
+	image *ecs.Image
+}
+
+func (s *stepUseAlicloudImage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	client := state.Get("client").(*ClientWrapper)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	imagesResponse, err := client.WaitForImageStatus(ctx, config.AlicloudRegion, s.ImageId, ImageStatusAvailable, time.Duration(ALICLOUD_DEFAULT_LONG_TIMEOUT)*time.Second)
+	if err != nil {
+		return halt(state, err, "Error waiting for image to be available")
+	}
+	images := imagesResponse.(*ecs.DescribeImagesResponse).Images.Image
+	if len(images) == 0 {
+		return halt(state, fmt.Errorf("image %s not found", s.ImageId), "Unable to find image")
+	}
+	s.image = &images[0]
+
+	// 加密时该镜像只是临时镜像，由加密后的副本加入镜像族系
+	if request := buildModifyImageAttributeRequest(config, config.AlicloudRegion, s.ImageId, !config.ImageEncrypted.True()); request != nil {
+		ui.Say(fmt.Sprintf("Setting the family and features of image: %s", s.ImageId))
+		if _, err := client.ModifyImageAttribute(request); err != nil {
+			return halt(state, err, "Error setting the family and features of image")
+		}
+	}
+
+	var snapshotIds []string
+	for _, device := range s.image.DiskDeviceMappings.DiskDeviceMapping {
+		snapshotIds = append(snapshotIds, device.SnapshotId)
+	}
+
+	state.Put("alicloudimage", s.ImageId)
+	state.Put("alicloudsnapshots", snapshotIds)
+	state.Put("alicloudimages", map[string]string{config.AlicloudRegion: s.ImageId})
+
+	return multistep.ActionContinue
+}
+
+func (s *stepUseAlicloudImage) Cleanup(state multistep.StateBag) {
+	if s.image == nil || s.KeepImage {
+		return
+	}
+
+	config := state.Get("config").(*Config)
+
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	_, halted := state.GetOk(multistep.StateHalted)
+	if !cancelled && !halted && !config.ImageEncrypted.True() {
+		return
+	}
+
+	client := state.Get("client").(*ClientWrapper)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	if !cancelled && !halted {
+		ui.Say(fmt.Sprintf("Deleting temporary image %s(%s) and related snapshots after finishing encryption...", s.image.ImageId, s.image.ImageName))
+	} else {
+		ui.Say("Deleting the image and related snapshots because of cancellation or error...")
+	}
+
+	if err := client.DeleteImageAndSnapshots(config.AlicloudRegion, s.image, true); err != nil {
+		ui.Error(fmt.Sprintf("Error deleting image, it may still be around: %s", err))
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ecs
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	confighelper "github.com/hashicorp/packer-plugin-sdk/template/config"
+)
+
+// testImage creates an image of the fake API the way an import would.
+func testImage(t *testing.T, client *ClientWrapper, imageName string) string {
+	securityGroup, err := client.CreateSecurityGroup(ecs.CreateCreateSecurityGroupRequest())
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	createInstanceRequest := ecs.CreateCreateInstanceRequest()
+	createInstanceRequest.SecurityGroupId = securityGroup.SecurityGroupId
+	createInstanceRequest.ImageId = fakeAPISourceImage
+	instance, err := client.CreateInstance(createInstanceRequest)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	startInstanceRequest := ecs.CreateStartInstanceRequest()
+	startInstanceRequest.InstanceId = instance.InstanceId
+	if _, err := client.StartInstance(startInstanceRequest); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	stopInstanceRequest := ecs.CreateStopInstanceRequest()
+	stopInstanceRequest.InstanceId = instance.InstanceId
+	if _, err := client.StopInstance(stopInstanceRequest); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	createImageRequest := ecs.CreateCreateImageRequest()
+	createImageRequest.RegionId = fakeAPIRegion
+	createImageRequest.InstanceId = instance.InstanceId
+	createImageRequest.ImageName = imageName
+	image, err := client.CreateImage(createImageRequest)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	return image.ImageId
+}
+
+func TestRunImagePipeline(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	client, _ := api.Clients(t)
+	imageId := testImage(t, client, "packer_import")
+
+	config := &Config{}
+	config.AlicloudRegion = fakeAPIRegion
+	config.AlicloudImageName = "foo"
+	config.AlicloudImageTags = map[string]string{"Project": "packer"}
+	config.AlicloudImageCopyRegions = []AlicloudImageCopyRegion{{Region: "cn-hangzhou"}}
+	config.AlicloudImageShareAccounts = []string{"123456"}
+	config.TargetImageFamily = "web-server"
+	config.ImageEncrypted = confighelper.TriTrue
+
+	images, err := RunImagePipeline(context.Background(), packersdk.TestUi(t), config, client, imageId)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	if len(images) != 2 || images[fakeAPIRegion] == imageId {
+		t.Fatalf("bad: expected the encrypted copy and a copy in cn-hangzhou, actual %v", images)
+	}
+	if _, ok := api.Image(imageId); ok {
+		t.Fatalf("bad: the image %s should have been deleted after encryption", imageId)
+	}
+	for regionId, copiedImageId := range images {
+		image, ok := api.Image(copiedImageId)
+		if !ok {
+			t.Fatalf("an image should have been created in %s, actual: %v", regionId, images)
+		}
+		if image.Image.ImageFamily != "web-server" {
+			t.Fatalf("bad: image %s in %s should have the family, actual: %+v", copiedImageId, regionId, image)
+		}
+	}
+	if api.Called("ModifyImageSharePermission") != 2 {
+		t.Fatalf("bad: the images of both regions should be shared, actual %v", api.Actions())
+	}
+}
+
+func TestRunImagePipeline_regionTags(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	client, _ := api.Clients(t)
+	imageId := testImage(t, client, "packer_import")
+
+	config := &Config{}
+	config.AlicloudRegion = fakeAPIRegion
+	config.AlicloudImageName = "foo"
+	config.AlicloudImageTags = map[string]string{"Project": "packer", "Env": "prod"}
+	config.AlicloudImageRegionTags = map[string]map[string]string{"cn-hangzhou": {"Env": "staging"}}
+	config.AlicloudImageCopyRegions = []AlicloudImageCopyRegion{{Region: "cn-hangzhou"}, {Region: "cn-shanghai"}}
+
+	images, err := RunImagePipeline(context.Background(), packersdk.TestUi(t), config, client, imageId)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	expected := map[string]map[string]string{
+		fakeAPIRegion: {"Project": "packer", "Env": "prod"},
+		"cn-hangzhou": {"Project": "packer", "Env": "staging"},
+		"cn-shanghai": {"Project": "packer", "Env": "prod"},
+	}
+	for regionId, tags := range expected {
+		image, ok := api.Image(images[regionId])
+		if !ok {
+			t.Fatalf("an image should have been created in %s, actual: %v", regionId, images)
+		}
+		if !reflect.DeepEqual(api.Tags(image.Image.ImageId), tags) {
+			t.Fatalf("bad: image in %s should have tags %v, actual %v", regionId, tags, api.Tags(image.Image.ImageId))
+		}
+		for _, device := range image.Image.DiskDeviceMappings.DiskDeviceMapping {
+			if !reflect.DeepEqual(api.Tags(device.SnapshotId), tags) {
+				t.Fatalf("bad: snapshot %s in %s should have tags %v, actual %v", device.SnapshotId, regionId, tags, api.Tags(device.SnapshotId))
+			}
+		}
+	}
+}
+
+func TestPromoteImage(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	client, _ := api.Clients(t)
+	imageId := testImage(t, client, "packer_dev")
+
+	config := &Config{}
+	config.AlicloudRegion = fakeAPIRegion
+	config.AlicloudImageTags = map[string]string{"Stage": "prod"}
+	config.AlicloudImageCopyRegions = []AlicloudImageCopyRegion{{Region: "cn-hangzhou", Name: "packer_prod"}}
+	config.AlicloudImageShareAccounts = []string{"123456"}
+
+	images, err := PromoteImage(context.Background(), packersdk.TestUi(t), config, client, imageId)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	if len(images) != 2 || images[fakeAPIRegion] != imageId {
+		t.Fatalf("bad: expected the image and a copy in cn-hangzhou, actual %v", images)
+	}
+	for regionId, promotedImageId := range images {
+		if !reflect.DeepEqual(api.Tags(promotedImageId), config.AlicloudImageTags) {
+			t.Fatalf("bad: image in %s should have tags %v, actual %v", regionId, config.AlicloudImageTags, api.Tags(promotedImageId))
+		}
+		if !api.SharedWith(promotedImageId, "123456") {
+			t.Fatalf("bad: image in %s should be shared", regionId)
+		}
+	}
+}
+
+func TestPromoteImage_failed(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	client, _ := api.Clients(t)
+	imageId := testImage(t, client, "packer_dev")
+	api.FailedCopies = []string{"cn-hangzhou"}
+
+	config := &Config{}
+	config.AlicloudRegion = fakeAPIRegion
+	config.AlicloudImageCopyRegions = []AlicloudImageCopyRegion{{Region: "cn-hangzhou"}}
+	config.WaitForCopiedImages = true
+
+	if _, err := PromoteImage(context.Background(), packersdk.TestUi(t), config, client, imageId); err == nil {
+		t.Fatalf("should have error")
+	}
+
+	// 晋升失败时不删除已有的镜像
+	if _, ok := api.Image(imageId); !ok {
+		t.Fatalf("bad: the promoted image %s should be kept", imageId)
+	}
+}
+
+func TestCopySharedImage(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	client, _ := api.Clients(t)
+	imageId := testImage(t, client, "packer_shared")
+
+	config := &Config{}
+	config.AlicloudRegion = fakeAPIRegion
+	config.AlicloudImageTags = map[string]string{"Owner": "prod"}
+	config.AlicloudImageCopyRegions = []AlicloudImageCopyRegion{{Region: fakeAPIRegion}, {Region: "cn-hangzhou"}}
+
+	images, err := CopySharedImage(context.Background(), packersdk.TestUi(t), config, client, fakeAPIRegion, imageId)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	if len(images) != 2 || images[fakeAPIRegion] == "" || images[fakeAPIRegion] == imageId || images["cn-hangzhou"] == "" {
+		t.Fatalf("bad: expected a copy in both regions, actual %v", images)
+	}
+	for _, form := range api.Requests("CopyImage") {
+		if form.Get("RegionId") != fakeAPIRegion || form.Get("ImageId") != imageId {
+			t.Fatalf("bad: the shared image should be copied from its region, actual %v", form)
+		}
+	}
+	for regionId, copiedImageId := range images {
+		if !reflect.DeepEqual(api.Tags(copiedImageId), config.AlicloudImageTags) {
+			t.Fatalf("bad: copy in %s should have tags %v, actual %v", regionId, config.AlicloudImageTags, api.Tags(copiedImageId))
+		}
+	}
+}
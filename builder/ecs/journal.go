@@ -0,0 +1,280 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ecs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// The kinds of the resources recorded in the build journal.
+const (
+	journalVpc           = "vpc"
+	journalVSwitch       = "vswitch"
+	journalSecurityGroup = "security_group"
+	journalInstance      = "instance"
+	journalEip           = "eip"
+	journalImage         = "image"
+	journalKeyPair       = "key_pair"
+)
+
+// The stages recorded in the build journal once completed.
+const (
+	journalStageProvision = "provision"
+)
+
+// buildJournal records the resources created by a build, so that a failed
+// build can be resumed from them instead of starting over. All its methods
+// can be called on a nil journal, which records nothing.
+type buildJournal struct {
+	Resources       map[string]string `json:"resources"`
+	CompletedStages []string          `json:"completed_stages,omitempty"`
+	// The private key of the recorded key pair, which can't be queried once
+	// the key pair is created.
+	PrivateKey string `json:"private_key,omitempty"`
+
+	path string
+}
+
+// loadBuildJournal reads the journal at path. A missing file gives an empty
+// journal, which is written on the first record.
+func loadBuildJournal(path string) (*buildJournal, error) {
+	journal := &buildJournal{
+		Resources: map[string]string{},
+		path:      path,
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return journal, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading build journal %s: %s", path, err)
+	}
+
+	if err := json.Unmarshal(data, journal); err != nil {
+		return nil, fmt.Errorf("Error parsing build journal %s: %s", path, err)
+	}
+	if journal.Resources == nil {
+		journal.Resources = map[string]string{}
+	}
+
+	return journal, nil
+}
+
+// getJournal returns the journal of the build, or nil when resume is off.
+func getJournal(state multistep.StateBag) *buildJournal {
+	if journal, ok := state.GetOk("journal"); ok {
+		return journal.(*buildJournal)
+	}
+
+	return nil
+}
+
+// Resource returns the ID of the recorded resource of the given kind.
+func (j *buildJournal) Resource(kind string) string {
+	if j == nil {
+		return ""
+	}
+
+	return j.Resources[kind]
+}
+
+// Record saves the ID of a resource created by the build.
+func (j *buildJournal) Record(kind string, id string) error {
+	if j == nil {
+		return nil
+	}
+
+	j.Resources[kind] = id
+	return j.save()
+}
+
+// RecordKeyPair saves the temporary key pair created by the build with its
+// private key.
+func (j *buildJournal) RecordKeyPair(name string, privateKey string) error {
+	if j == nil {
+		return nil
+	}
+
+	j.Resources[journalKeyPair] = name
+	j.PrivateKey = privateKey
+	return j.save()
+}
+
+// Forget drops a recorded resource, once deleted or found missing.
+func (j *buildJournal) Forget(kind string) error {
+	if j == nil {
+		return nil
+	}
+	if _, ok := j.Resources[kind]; !ok {
+		return nil
+	}
+
+	delete(j.Resources, kind)
+	if kind == journalKeyPair {
+		j.PrivateKey = ""
+	}
+	return j.save()
+}
+
+// Completed reports whether the given stage was completed by a former run.
+func (j *buildJournal) Completed(stage string) bool {
+	if j == nil {
+		return false
+	}
+
+	return slices.Contains(j.CompletedStages, stage)
+}
+
+// Complete records the given stage as completed.
+func (j *buildJournal) Complete(stage string) error {
+	if j == nil || j.Completed(stage) {
+		return nil
+	}
+
+	j.CompletedStages = append(j.CompletedStages, stage)
+	return j.save()
+}
+
+// Remove deletes the journal file once the build succeeded.
+func (j *buildJournal) Remove() error {
+	if j == nil {
+		return nil
+	}
+
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (j *buildJournal) save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免中断时留下不完整的日志
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*")
+	if err != nil {
+		return fmt.Errorf("Error writing build journal %s: %s", j.path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Error writing build journal %s: %s", j.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Error writing build journal %s: %s", j.path, err)
+	}
+
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return fmt.Errorf("Error writing build journal %s: %s", j.path, err)
+	}
+
+	return nil
+}
+
+// recordResource records a created resource in the journal. Failing to write
+// the journal only costs the ability to resume, so it does not fail the build.
+func recordResource(state multistep.StateBag, kind string, id string) {
+	if err := getJournal(state).Record(kind, id); err != nil {
+		ui := state.Get("ui").(packersdk.Ui)
+		ui.Error(err.Error())
+	}
+}
+
+// forgetResource drops a resource deleted by the build from the journal.
+func forgetResource(state multistep.StateBag, kind string) {
+	if err := getJournal(state).Forget(kind); err != nil {
+		log.Printf("[WARN] %s", err)
+	}
+}
+
+// keepForResume reports whether a resource must be kept when cleaning up,
+// which is the case when the build failed and can be resumed later.
+func keepForResume(state multistep.StateBag, module string, id string) bool {
+	if getJournal(state) == nil {
+		return false
+	}
+
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	_, halted := state.GetOk(multistep.StateHalted)
+	if !cancelled && !halted {
+		return false
+	}
+
+	ui := state.Get("ui").(packersdk.Ui)
+	ui.Say(fmt.Sprintf("Keeping %s %s to resume the build", module, id))
+	return true
+}
+
+// stepSkipIfCompleted runs Step unless a former run completed Stage.
+type stepSkipIfCompleted struct {
+	Stage   string
+	Step    multistep.Step
+	skipped bool
+}
+
+// skipIfCompleted wraps steps so that they are skipped when resuming a build
+// which completed the given stage.
+func skipIfCompleted(stage string, steps ...multistep.Step) []multistep.Step {
+	wrapped := make([]multistep.Step, 0, len(steps))
+	for _, step := range steps {
+		wrapped = append(wrapped, &stepSkipIfCompleted{Stage: stage, Step: step})
+	}
+
+	return wrapped
+}
+
+func (s *stepSkipIfCompleted) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	if getJournal(state).Completed(s.Stage) {
+		s.skipped = true
+		return multistep.ActionContinue
+	}
+
+	return s.Step.Run(ctx, state)
+}
+
+func (s *stepSkipIfCompleted) Cleanup(state multistep.StateBag) {
+	if s.skipped {
+		return
+	}
+
+	s.Step.Cleanup(state)
+}
+
+// stepCompleteStage records Stage as completed in the journal.
+type stepCompleteStage struct {
+	Stage string
+}
+
+func (s *stepCompleteStage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	journal := getJournal(state)
+	if journal.Completed(s.Stage) {
+		ui := state.Get("ui").(packersdk.Ui)
+		ui.Say(fmt.Sprintf("Skipped %s, completed by a former run", s.Stage))
+		return multistep.ActionContinue
+	}
+
+	if err := journal.Complete(s.Stage); err != nil {
+		ui := state.Get("ui").(packersdk.Ui)
+		ui.Error(err.Error())
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepCompleteStage) Cleanup(multistep.StateBag) {}
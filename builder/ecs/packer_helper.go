@@ -5,8 +5,11 @@ package ecs
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
+	"time"
 
+	"github.com/hashicorp/packer-plugin-alicloud/version"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
@@ -28,7 +31,7 @@ func halt(state multistep.StateBag, err error, prefix string) multistep.StepActi
 	ui := state.Get("ui").(packersdk.Ui)
 
 	if prefix != "" {
-		err = fmt.Errorf("%s: %s", prefix, err)
+		err = fmt.Errorf("%s: %w", prefix, err)
 	}
 
 	state.Put("error", err)
@@ -36,6 +39,48 @@ func halt(state multistep.StateBag, err error, prefix string) multistep.StepActi
 	return multistep.ActionHalt
 }
 
+// temporaryResourceTags returns the tags of a temporary resource created by
+// the build: temporary_resource_tags, then the given resource tags, then the
+// tags identifying the build, which can't be overridden.
+func temporaryResourceTags(state multistep.StateBag, resourceTags map[string]string) map[string]string {
+	config := state.Get("config").(*Config)
+
+	tags := make(map[string]string, len(config.TemporaryResourceTags)+len(resourceTags)+4)
+	for key, value := range config.TemporaryResourceTags {
+		tags[key] = value
+	}
+	for key, value := range resourceTags {
+		tags[key] = value
+	}
+
+	if config.PackerBuildName != "" {
+		tags[BuildNameTagKey] = config.PackerBuildName
+	}
+	if buildUUID, ok := state.GetOk("build_uuid"); ok {
+		tags[BuildOwnershipTagKey] = buildUUID.(string)
+	}
+	tags[BuildCreationTimeTagKey] = time.Now().UTC().Format(time.RFC3339)
+	tags[BuildPluginVersionTagKey] = version.PluginVersion.FormattedVersion()
+
+	return tags
+}
+
+// setCreationTags sets the Tag.N.Key and Tag.N.Value parameters of a
+// creation request whose SDK struct doesn't know them yet, so that the
+// resource is tagged from its creation.
+func setCreationTags(queryParams map[string]string, tags map[string]string) {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for i, key := range keys {
+		queryParams[fmt.Sprintf("Tag.%d.Key", i+1)] = key
+		queryParams[fmt.Sprintf("Tag.%d.Value", i+1)] = tags[key]
+	}
+}
+
 func convertNumber(value int) string {
 	if value <= 0 {
 		return ""
@@ -8,8 +8,10 @@ package ecs
 import (
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
@@ -30,9 +32,13 @@ type RunConfig struct {
 	// You can also obtain the latest instance type table by invoking the
 	// [Querying Instance Type
 	// Table](https://intl.aliyun.com/help/doc-detail/25620.htm?spm=a3c0i.o25499en.a3.6.Dr1bik)
-	// interface.
+	// interface. Either this or `instance_types` must be specified.
 	InstanceType string `mapstructure:"instance_type" required:"true"`
-	Description  string `mapstructure:"description"`
+	// A list of instance types to try in order, e.g. when the preferred ones
+	// are sold out. An instance type is tried in all the candidate zones
+	// before the next one. It cannot be specified with `instance_type`.
+	InstanceTypes []string `mapstructure:"instance_types" required:"false"`
+	Description   string   `mapstructure:"description"`
 	// This is the base image id which you want to
 	// create your customized images.
 	AlicloudSourceImage string `mapstructure:"source_image" required:"true"`
@@ -58,6 +64,14 @@ type RunConfig struct {
 	// Key/value pair tags to apply to the instance that is *launched*
 	// to create the image.
 	RunTags map[string]string `mapstructure:"run_tags" required:"false"`
+	// Key/value pair tags to apply to all the temporary resources created by
+	// the build: the VPC, vswitch, security group, key pair, EIP, instance
+	// and disks of the instance. Packer adds to them the tags
+	// `packer-build-name`, `packer-build-uuid`, `packer-created-at` and
+	// `packer-plugin-version` identifying the build. The resources are
+	// tagged when they are created. `run_tags` take precedence on the
+	// instance and its disks.
+	TemporaryResourceTags map[string]string `mapstructure:"temporary_resource_tags" required:"false"`
 	// ID of the security group to which a newly
 	// created instance belongs. Mutual access is allowed between instances in one
 	// security group. If not specified, the newly created instance will be added
@@ -70,6 +84,16 @@ type RunConfig struct {
 	// uppercase/lowercase letter or Chinese character. Can contain numbers, .,
 	// _ or -. It cannot begin with `http://` or `https://`.
 	SecurityGroupName string `mapstructure:"security_group_name" required:"false"`
+	// The CIDR blocks allowed to reach the communicator port (22 for SSH,
+	// 5985 or 5986 for WinRM by default) of the instance, when Packer creates
+	// the security group. Nothing else is opened inbound. Defaults to the
+	// address of the machine running Packer: its private IP address with
+	// `ssh_private_ip`, otherwise its public IP address, which is detected by
+	// calling the external services `https://checkip.amazonaws.com` and
+	// `https://ifconfig.me/ip`. Set it when these services can't be reached,
+	// or shouldn't be called. It must be specified with `ssh_bastion_host`
+	// and `ssh_proxy_host`, as the instance is reached from them.
+	TemporarySecurityGroupSourceCidrs []string `mapstructure:"temporary_security_group_source_cidrs" required:"false"`
 	// Specifies whether to enable security hardening. Valid values:
 	// Active: enables security hardening. This value is applicable only to public images.
 	// Deactive: does not enable security hardening. This value is applicable to all image types.
@@ -123,6 +147,27 @@ type RunConfig struct {
 	// -   `PayByTraffic`: \[1, 100\]. If this parameter is not specified, an
 	//     error is returned.
 	InternetMaxBandwidthOut int `mapstructure:"internet_max_bandwidth_out" required:"false"`
+	// The spot strategy of the instance that is *launched* to create the
+	// image. Optional values:
+	// -   `NoSpot`: creates a pay-as-you-go instance.
+	// -   `SpotWithPriceLimit`: creates a spot instance whose price cannot
+	//     exceed `spot_price_limit`.
+	// -   `SpotAsPriceGo`: creates a spot instance at the market price, capped
+	//     at the pay-as-you-go price.
+	//
+	// If this parameter is not specified, the default value is `NoSpot`. When
+	// spot instances are sold out in all of the candidate zones, Packer falls
+	// back to a pay-as-you-go instance. Other errors, e.g. a too low
+	// `spot_price_limit`, fail the build.
+	SpotStrategy string `mapstructure:"spot_strategy" required:"false"`
+	// The maximum hourly price of the spot instance, in USD for the regions out
+	// of China and in CNY otherwise. It must be set when `spot_strategy` is
+	// `SpotWithPriceLimit`, and only then.
+	SpotPriceLimit float64 `mapstructure:"spot_price_limit" required:"false"`
+	// The protection period of the spot instance, in hours, during which it is
+	// not reclaimed. Value range: \[0, 6\]. 0 means no protection period. If
+	// this parameter is not specified, the API uses 1 hour.
+	SpotDuration *int `mapstructure:"spot_duration" required:"false"`
 	// Timeout of creating snapshot(s).
 	// The default timeout is 3600 seconds if this option is not set or is set
 	// to 0. For those disks containing lots of data, it may require a higher
@@ -138,12 +183,51 @@ type RunConfig struct {
 	// the ECS created through private ip instead of allocating a public ip or an
 	// EIP. The default value is false.
 	SSHPrivateIp bool `mapstructure:"ssh_private_ip" required:"false"`
+	// The timeout of each command run by the `cloud-assistant` communicator,
+	// which runs the provisioners through the Cloud Assistant API instead of
+	// connecting to the instance, so that it needs neither a public IP
+	// address, a key pair nor inbound access. Defaults to `1h`.
+	CloudAssistantCommandTimeout time.Duration `mapstructure:"cloud_assistant_command_timeout" required:"false"`
 	//If true, Packer will not create a final image. Defaults to `false`.
 	SkipCreateImage bool `mapstructure:"skip_create_image" required:"false"`
+	// If true, Packer records the VPC, vswitch, security group, key pair,
+	// instance, EIP and image it creates in `journal_file`, and keeps them
+	// when the build fails. Running the build again adopts the recorded
+	// resources and skips the completed steps, for instance provisioning when
+	// only the image creation failed. The journal is removed once the build
+	// succeeds. Defaults to `false`.
+	Resume bool `mapstructure:"resume" required:"false"`
+	// The path of the build journal used by `resume`. Defaults to
+	// `packer_<build name>.journal.json` in the current directory.
+	JournalFile string `mapstructure:"journal_file" required:"false"`
+	// If true, Packer only checks the template against the account and
+	// reports what the build would create, without creating anything. The
+	// source image, the network, the zones where the instance types are
+	// available, the key pair and the destination regions are checked with
+	// read-only calls, and the creation of the instance with the `DryRun`
+	// flag of `CreateInstance`. Defaults to `false`.
+	DryRun bool `mapstructure:"dry_run" required:"false"`
+	// If true, Packer builds nothing and deletes instead the temporary
+	// resources left behind in `region` by interrupted builds: the
+	// instances, EIPs, key pairs, security groups, vswitches and VPCs tagged
+	// `packer-build-uuid` and older than `sweep_older_than`. Dependent
+	// resources are deleted first, and a report of the deleted resources is
+	// printed. Together with `dry_run`, the resources are only reported. Only
+	// the access options are required in this mode. Defaults to `false`.
+	Sweep bool `mapstructure:"sweep" required:"false"`
+	// The minimum age of the resources deleted by `sweep`, so that the ones
+	// of the builds still running are kept. Defaults to `24h`.
+	SweepOlderThan time.Duration `mapstructure:"sweep_older_than" required:"false"`
 }
 
 func (c *RunConfig) Prepare(ctx *interpolate.Context) []error {
-	if c.Comm.SSHKeyPairName == "" && c.Comm.SSHTemporaryKeyPairName == "" &&
+	if c.Sweep {
+		return c.prepareSweep()
+	}
+
+	cloudAssistant := c.Comm.Type == CloudAssistantCommunicator
+
+	if !cloudAssistant && c.Comm.SSHKeyPairName == "" && c.Comm.SSHTemporaryKeyPairName == "" &&
 		c.Comm.SSHPrivateKeyFile == "" && c.Comm.SSHPassword == "" && c.Comm.WinRMPassword == "" {
 
 		c.Comm.SSHTemporaryKeyPairName = fmt.Sprintf("packer_%s", uuid.TimeOrderedUUID())
@@ -153,8 +237,35 @@ func (c *RunConfig) Prepare(ctx *interpolate.Context) []error {
 		c.RunTags = make(map[string]string)
 	}
 
+	if c.TemporaryResourceTags == nil {
+		c.TemporaryResourceTags = make(map[string]string)
+	}
+
 	// Validation
+	// cloud-assistant 通信器不在 SDK 支持的类型中，按无通信器校验其余选项
+	if cloudAssistant {
+		c.Comm.Type = "none"
+	}
 	errs := c.Comm.Prepare(ctx)
+	if cloudAssistant {
+		c.Comm.Type = CloudAssistantCommunicator
+	}
+
+	if cloudAssistant && c.CloudAssistantCommandTimeout == 0 {
+		c.CloudAssistantCommandTimeout = time.Hour
+	}
+
+	if !cloudAssistant && c.CloudAssistantCommandTimeout != 0 {
+		errs = append(errs, fmt.Errorf("cloud_assistant_command_timeout can only be specified with the %s communicator", CloudAssistantCommunicator))
+	}
+
+	if c.CloudAssistantCommandTimeout < 0 {
+		errs = append(errs, errors.New("cloud_assistant_command_timeout can't be negative"))
+	}
+
+	if cloudAssistant && c.AssociatePublicIpAddress {
+		errs = append(errs, fmt.Errorf("associate_public_ip_address can't be specified with the %s communicator", CloudAssistantCommunicator))
+	}
 	if c.AlicloudSourceImage == "" && c.AlicloudImageFamily == "" {
 		errs = append(errs, errors.New("A source_image must be specified"))
 	}
@@ -171,10 +282,65 @@ func (c *RunConfig) Prepare(ctx *interpolate.Context) []error {
 		errs = append(errs, errors.New("The image_family can't include spaces"))
 	}
 
-	if c.InstanceType == "" {
+	if c.InstanceType == "" && len(c.InstanceTypes) == 0 {
 		errs = append(errs, errors.New("An alicloud_instance_type must be specified"))
 	}
 
+	if c.InstanceType != "" && len(c.InstanceTypes) > 0 {
+		errs = append(errs, errors.New("Only one of instance_type or instance_types can be specified."))
+	}
+
+	for _, instanceType := range c.InstanceTypes {
+		if instanceType == "" {
+			errs = append(errs, errors.New("The instance_types can't include empty values"))
+			break
+		}
+	}
+
+	if c.SpotStrategy != "" && !ContainsInArray([]string{SpotStrategyNoSpot, SpotStrategyWithPriceLimit, SpotStrategyAsPriceGo}, c.SpotStrategy) {
+		errs = append(errs, fmt.Errorf("spot_strategy must be one of %s, %s or %s", SpotStrategyNoSpot, SpotStrategyWithPriceLimit, SpotStrategyAsPriceGo))
+	}
+
+	if c.SpotStrategy == SpotStrategyWithPriceLimit && c.SpotPriceLimit <= 0 {
+		errs = append(errs, fmt.Errorf("A positive spot_price_limit must be specified when spot_strategy is %s", SpotStrategyWithPriceLimit))
+	}
+
+	if c.SpotStrategy != SpotStrategyWithPriceLimit && c.SpotPriceLimit != 0 {
+		errs = append(errs, fmt.Errorf("spot_price_limit can only be specified when spot_strategy is %s", SpotStrategyWithPriceLimit))
+	}
+
+	if c.SpotDuration != nil && (*c.SpotDuration < 0 || *c.SpotDuration > 6) {
+		errs = append(errs, errors.New("spot_duration must be between 0 and 6"))
+	}
+
+	if c.SpotDuration != nil && !c.isSpot() {
+		errs = append(errs, errors.New("spot_duration can only be specified with a spot_strategy creating a spot instance"))
+	}
+
+	if c.JournalFile != "" && !c.Resume {
+		errs = append(errs, errors.New("journal_file can only be specified when resume is true"))
+	}
+
+	for _, sourceCidr := range c.TemporarySecurityGroupSourceCidrs {
+		if _, _, err := net.ParseCIDR(sourceCidr); err != nil {
+			errs = append(errs, fmt.Errorf("temporary_security_group_source_cidrs has an invalid CIDR block %s", sourceCidr))
+		}
+	}
+
+	if c.SecurityGroupId == "" && len(c.TemporarySecurityGroupSourceCidrs) == 0 {
+		// 经跳板机或代理连接时，无法探测实际的来源地址
+		if c.Comm.SSHBastionHost != "" {
+			errs = append(errs, errors.New("temporary_security_group_source_cidrs must be specified with ssh_bastion_host"))
+		}
+		if c.Comm.SSHProxyHost != "" {
+			errs = append(errs, errors.New("temporary_security_group_source_cidrs must be specified with ssh_proxy_host"))
+		}
+	}
+
+	if c.SweepOlderThan != 0 {
+		errs = append(errs, errors.New("sweep_older_than can only be specified when sweep is true"))
+	}
+
 	if c.UserData != "" && c.UserDataFile != "" {
 		errs = append(errs, fmt.Errorf("Only one of user_data or user_data_file can be specified."))
 	} else if c.UserDataFile != "" {
@@ -185,3 +351,34 @@ func (c *RunConfig) Prepare(ctx *interpolate.Context) []error {
 
 	return errs
 }
+
+// prepareSweep validates the options of the sweep mode, which ignores the
+// build options.
+func (c *RunConfig) prepareSweep() []error {
+	var errs []error
+	if c.SweepOlderThan == 0 {
+		c.SweepOlderThan = 24 * time.Hour
+	}
+	if c.SweepOlderThan < 0 {
+		errs = append(errs, errors.New("sweep_older_than can't be negative"))
+	}
+	if c.Resume {
+		errs = append(errs, errors.New("resume can't be specified when sweep is true"))
+	}
+
+	return errs
+}
+
+// isSpot reports whether the instance launched to create the image is a spot
+// instance.
+func (c *RunConfig) isSpot() bool {
+	return c.SpotStrategy == SpotStrategyWithPriceLimit || c.SpotStrategy == SpotStrategyAsPriceGo
+}
+
+// candidateInstanceTypes returns the instance types to try, in order.
+func (c *RunConfig) candidateInstanceTypes() []string {
+	if len(c.InstanceTypes) > 0 {
+		return c.InstanceTypes
+	}
+	return []string{c.InstanceType}
+}
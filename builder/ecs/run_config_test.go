@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
 )
@@ -179,3 +180,177 @@ func TestRunConfigPrepare_DisableStopInstance(t *testing.T) {
 		t.Fatalf("invalid value, expected: %t, actul: %t", false, c.DisableStopInstance)
 	}
 }
+
+func TestRunConfigPrepare_Spot(t *testing.T) {
+	c := testConfig()
+	c.SpotStrategy = SpotStrategyAsPriceGo
+	c.SpotDuration = intPtr(2)
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.SpotDuration = intPtr(0)
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.SpotDuration = nil
+	c.SpotStrategy = "Spot"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("bad spot_strategy should have error: %s", err)
+	}
+
+	c.SpotStrategy = SpotStrategyWithPriceLimit
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("missing spot_price_limit should have error: %s", err)
+	}
+
+	c.SpotPriceLimit = 0.1
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.SpotStrategy = SpotStrategyAsPriceGo
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("spot_price_limit without SpotWithPriceLimit should have error: %s", err)
+	}
+
+	c.SpotPriceLimit = 0
+	c.SpotDuration = intPtr(7)
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("bad spot_duration should have error: %s", err)
+	}
+
+	c.SpotStrategy = SpotStrategyNoSpot
+	c.SpotDuration = intPtr(0)
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("spot_duration without spot instance should have error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_InstanceTypes(t *testing.T) {
+	c := testConfig()
+	c.InstanceType = ""
+	c.InstanceTypes = []string{"ecs.g6.large", "ecs.g5.large"}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if types := c.candidateInstanceTypes(); len(types) != 2 || types[0] != "ecs.g6.large" {
+		t.Fatalf("bad: %v", types)
+	}
+
+	c.InstanceType = "ecs.n1.tiny"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("instance_type with instance_types should have error: %s", err)
+	}
+
+	c.InstanceTypes = nil
+	if types := c.candidateInstanceTypes(); len(types) != 1 || types[0] != "ecs.n1.tiny" {
+		t.Fatalf("bad: %v", types)
+	}
+
+	c.InstanceType = ""
+	c.InstanceTypes = []string{"ecs.g6.large", ""}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("empty instance type should have error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_JournalFile(t *testing.T) {
+	c := testConfig()
+	c.JournalFile = "build.journal.json"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("journal_file without resume should have error: %s", err)
+	}
+
+	c.Resume = true
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_TemporarySecurityGroupSourceCidrs(t *testing.T) {
+	c := testConfig()
+	c.TemporarySecurityGroupSourceCidrs = []string{"10.0.0.0/8", "203.0.113.7"}
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("invalid CIDR block should have error: %s", err)
+	}
+
+	c.TemporarySecurityGroupSourceCidrs = nil
+	c.Comm.SSHBastionHost = "bastion.example.com"
+	c.Comm.SSHBastionPassword = "password"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("ssh_bastion_host without source CIDR blocks should have error: %s", err)
+	}
+
+	c.TemporarySecurityGroupSourceCidrs = []string{"10.0.0.0/8"}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+
+	c.TemporarySecurityGroupSourceCidrs = nil
+	c.Comm.SSHBastionHost = ""
+	c.Comm.SSHBastionPassword = ""
+	c.Comm.SSHProxyHost = "proxy.example.com"
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("ssh_proxy_host without source CIDR blocks should have error: %s", err)
+	}
+
+	c.TemporarySecurityGroupSourceCidrs = []string{"10.0.0.0/8"}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_Sweep(t *testing.T) {
+	c := testConfig()
+	c.SweepOlderThan = time.Hour
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("sweep_older_than without sweep should have error: %s", err)
+	}
+
+	c = &RunConfig{Sweep: true}
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("sweep should not need the build options: %s", err)
+	}
+	if c.SweepOlderThan != 24*time.Hour {
+		t.Fatalf("bad: expected default sweep_older_than of 24h, actual %s", c.SweepOlderThan)
+	}
+
+	c.SweepOlderThan = -time.Hour
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("negative sweep_older_than should have error: %s", err)
+	}
+}
+
+func TestRunConfigPrepare_CloudAssistant(t *testing.T) {
+	c := testConfig()
+	c.Comm.Type = CloudAssistantCommunicator
+	if err := c.Prepare(nil); len(err) != 0 {
+		t.Fatalf("err: %s", err)
+	}
+	if c.Comm.Type != CloudAssistantCommunicator {
+		t.Fatalf("bad: communicator should be kept, actual %s", c.Comm.Type)
+	}
+	if c.Comm.SSHTemporaryKeyPairName != "" {
+		t.Fatalf("bad: no temporary key pair should be created, actual %s", c.Comm.SSHTemporaryKeyPairName)
+	}
+	if c.CloudAssistantCommandTimeout != time.Hour {
+		t.Fatalf("bad: expected default cloud_assistant_command_timeout of 1h, actual %s", c.CloudAssistantCommandTimeout)
+	}
+
+	c.AssociatePublicIpAddress = true
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("associate_public_ip_address with cloud-assistant should have error: %s", err)
+	}
+
+	c = testConfig()
+	c.CloudAssistantCommandTimeout = time.Hour
+	if err := c.Prepare(nil); len(err) != 1 {
+		t.Fatalf("cloud_assistant_command_timeout without cloud-assistant should have error: %s", err)
+	}
+}
+
+func intPtr(value int) *int {
+	return &value
+}
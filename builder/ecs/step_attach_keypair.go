@@ -34,6 +34,7 @@ func (s *stepAttachKeyPair) Run(ctx context.Context, state multistep.StateBag) m
 	}
 
 	_, err := client.WaitForExpected(&WaitForExpectArgs{
+		Context: ctx,
 		RequestFunc: func() (responses.AcsResponse, error) {
 			request := ecs.CreateAttachKeyPairRequest()
 			request.RegionId = config.AlicloudRegion
@@ -10,10 +10,12 @@ import (
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
 )
 
 type stepCheckAlicloudImageFamily struct {
-	ImageFamily string
+	ImageFamily   string
+	GeneratedData *packerbuilderdata.GeneratedData
 }
 
 func (s *stepCheckAlicloudImageFamily) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
@@ -39,6 +41,9 @@ func (s *stepCheckAlicloudImageFamily) Run(ctx context.Context, state multistep.
 
 	ui.Message(fmt.Sprintf("Found lastest image: %s by image family: %s", imageId, config.AlicloudImageFamily))
 
+	state.Put("source_image", &imagesResponse.Image)
+	putSourceImageGeneratedData(s.GeneratedData, &imagesResponse.Image)
+
 	return multistep.ActionContinue
 }
 
@@ -10,10 +10,12 @@ import (
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
 )
 
 type stepCheckAlicloudSourceImage struct {
 	SourceECSImageId string
+	GeneratedData    *packerbuilderdata.GeneratedData
 }
 
 func (s *stepCheckAlicloudSourceImage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
@@ -54,7 +56,16 @@ func (s *stepCheckAlicloudSourceImage) Run(ctx context.Context, state multistep.
 	ui.Message(fmt.Sprintf("Found image ID: %s", images[0].ImageId))
 
 	state.Put("source_image", &images[0])
+	putSourceImageGeneratedData(s.GeneratedData, &images[0])
 	return multistep.ActionContinue
 }
 
 func (s *stepCheckAlicloudSourceImage) Cleanup(multistep.StateBag) {}
+
+func putSourceImageGeneratedData(generatedData *packerbuilderdata.GeneratedData, image *ecs.Image) {
+	generatedData.Put("SourceImage", image.ImageId)
+	generatedData.Put("SourceImageName", image.ImageName)
+	generatedData.Put("SourceImageOSName", image.OSName)
+	generatedData.Put("SourceImageOSType", image.OSType)
+	generatedData.Put("SourceImageArchitecture", image.Architecture)
+}
@@ -38,52 +38,71 @@ func (s *stepConfigAlicloudEIP) Run(ctx context.Context, state multistep.StateBa
 	var ipaddress string
 
 	if s.AssociatePublicIpAddress {
-		ui.Say("Allocating eip...")
-
-		allocateEipAddressRequest := s.buildAllocateEipAddressRequest(state)
-		allocateEipAddressResponse, err := client.WaitForExpected(&WaitForExpectArgs{
-			RequestFunc: func() (responses.AcsResponse, error) {
-				return client.AllocateEipAddress(allocateEipAddressRequest)
-			},
-			EvalFunc: client.EvalCouldRetryResponse(allocateEipAddressRetryErrors, EvalRetryErrorType),
-		})
-
+		eip, err := s.describeJournaledEip(state, instance.RegionId)
 		if err != nil {
-			return halt(state, err, "Error allocating eip")
+			return halt(state, err, "Error querying eip")
 		}
 
-		ipaddress = allocateEipAddressResponse.(*ecs.AllocateEipAddressResponse).EipAddress
-		ui.Message(fmt.Sprintf("Allocated eip: %s", ipaddress))
+		if eip != nil {
+			ipaddress = eip.IpAddress
+			ui.Message(fmt.Sprintf("Resuming with eip: %s", ipaddress))
+			s.allocatedId = eip.AllocationId
+			if eip.Status == EipStatusInUse && eip.InstanceId == instance.InstanceId {
+				s.associatedId = instance.InstanceId
+			}
+		} else {
+			ui.Say("Allocating eip...")
+
+			allocateEipAddressRequest := s.buildAllocateEipAddressRequest(state)
+			allocateEipAddressResponse, err := client.WaitForExpected(&WaitForExpectArgs{
+				Context: ctx,
+				RequestFunc: func() (responses.AcsResponse, error) {
+					return client.AllocateEipAddress(allocateEipAddressRequest)
+				},
+				EvalFunc: client.EvalCouldRetryResponse(allocateEipAddressRetryErrors, EvalRetryErrorType),
+			})
 
-		allocateId := allocateEipAddressResponse.(*ecs.AllocateEipAddressResponse).AllocationId
-		s.allocatedId = allocateId
+			if err != nil {
+				return halt(state, err, "Error allocating eip")
+			}
 
-		err = s.waitForEipStatus(client, instance.RegionId, s.allocatedId, EipStatusAvailable)
-		if err != nil {
-			return halt(state, err, "Error wait eip available timeout")
+			ipaddress = allocateEipAddressResponse.(*ecs.AllocateEipAddressResponse).EipAddress
+			ui.Message(fmt.Sprintf("Allocated eip: %s", ipaddress))
+
+			allocateId := allocateEipAddressResponse.(*ecs.AllocateEipAddressResponse).AllocationId
+			s.allocatedId = allocateId
+			recordResource(state, journalEip, allocateId)
 		}
 
-		associateEipAddressRequest := ecs.CreateAssociateEipAddressRequest()
-		associateEipAddressRequest.AllocationId = allocateId
-		associateEipAddressRequest.InstanceId = instance.InstanceId
-		if _, err := client.AssociateEipAddress(associateEipAddressRequest); err != nil {
-			e, ok := err.(errors.Error)
-			if !ok || e.ErrorCode() != "TaskConflict" {
-				return halt(state, err, "Error associating eip")
+		if len(s.associatedId) == 0 {
+			err = s.waitForEipStatus(ctx, client, instance.RegionId, s.allocatedId, EipStatusAvailable)
+			if err != nil {
+				return halt(state, err, "Error wait eip available timeout")
 			}
 
-			ui.Error(fmt.Sprintf("Error associate eip: %s", err))
-		}
+			associateEipAddressRequest := ecs.CreateAssociateEipAddressRequest()
+			associateEipAddressRequest.AllocationId = s.allocatedId
+			associateEipAddressRequest.InstanceId = instance.InstanceId
+			if _, err := client.AssociateEipAddress(associateEipAddressRequest); err != nil {
+				e, ok := err.(errors.Error)
+				if !ok || e.ErrorCode() != "TaskConflict" {
+					return halt(state, err, "Error associating eip")
+				}
 
-		err = s.waitForEipStatus(client, instance.RegionId, s.allocatedId, EipStatusInUse)
-		if err != nil {
-			return halt(state, err, "Error wait eip associated timeout")
+				ui.Error(fmt.Sprintf("Error associate eip: %s", err))
+			}
+
+			err = s.waitForEipStatus(ctx, client, instance.RegionId, s.allocatedId, EipStatusInUse)
+			if err != nil {
+				return halt(state, err, "Error wait eip associated timeout")
+			}
+			s.associatedId = instance.InstanceId
 		}
-		s.associatedId = instance.InstanceId
 	}
 
 	if s.SSHPrivateIp {
 		_, err := client.WaitForExpected(&WaitForExpectArgs{
+			Context: ctx,
 			RequestFunc: func() (responses.AcsResponse, error) {
 				describeInstancesRequest := ecs.CreateDescribeInstancesRequest()
 				describeInstancesRequest.InstanceIds = fmt.Sprintf("[\"%s\"]", instance.InstanceId)
@@ -117,6 +136,9 @@ func (s *stepConfigAlicloudEIP) Cleanup(state multistep.StateBag) {
 	if len(s.allocatedId) == 0 {
 		return
 	}
+	if keepForResume(state, "EIP", s.allocatedId) {
+		return
+	}
 
 	cleanUpMessage(state, "EIP")
 
@@ -133,7 +155,7 @@ func (s *stepConfigAlicloudEIP) Cleanup(state multistep.StateBag) {
 			ui.Say(fmt.Sprintf("Failed to unassociate eip: %s", err))
 		}
 
-		if err := s.waitForEipStatus(client, instance.RegionId, s.allocatedId, EipStatusAvailable); err != nil {
+		if err := s.waitForEipStatus(context.Background(), client, instance.RegionId, s.allocatedId, EipStatusAvailable); err != nil {
 			ui.Say(fmt.Sprintf("Timeout while unassociating eip: %s", err))
 		}
 	}
@@ -145,12 +167,43 @@ func (s *stepConfigAlicloudEIP) Cleanup(state multistep.StateBag) {
 	}
 }
 
-func (s *stepConfigAlicloudEIP) waitForEipStatus(client *ClientWrapper, regionId string, allocationId string, expectedStatus string) error {
+// describeJournaledEip returns the eip recorded by a former run, or nil when
+// there is none.
+func (s *stepConfigAlicloudEIP) describeJournaledEip(state multistep.StateBag, regionId string) (*ecs.EipAddress, error) {
+	allocationId := getJournal(state).Resource(journalEip)
+	if allocationId == "" {
+		return nil, nil
+	}
+
+	client := state.Get("client").(*ClientWrapper)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	describeEipAddressesRequest := ecs.CreateDescribeEipAddressesRequest()
+	describeEipAddressesRequest.RegionId = regionId
+	describeEipAddressesRequest.AllocationId = allocationId
+	eipAddressesResponse, err := client.DescribeEipAddresses(describeEipAddressesRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, eipAddress := range eipAddressesResponse.EipAddresses.EipAddress {
+		if eipAddress.AllocationId == allocationId {
+			return &eipAddress, nil
+		}
+	}
+
+	ui.Say(fmt.Sprintf("The recorded eip {%s} doesn't exist any more.", allocationId))
+	forgetResource(state, journalEip)
+	return nil, nil
+}
+
+func (s *stepConfigAlicloudEIP) waitForEipStatus(ctx context.Context, client *ClientWrapper, regionId string, allocationId string, expectedStatus string) error {
 	describeEipAddressesRequest := ecs.CreateDescribeEipAddressesRequest()
 	describeEipAddressesRequest.RegionId = regionId
 	describeEipAddressesRequest.AllocationId = s.allocatedId
 
 	_, err := client.WaitForExpected(&WaitForExpectArgs{
+		Context: ctx,
 		RequestFunc: func() (responses.AcsResponse, error) {
 			response, err := client.DescribeEipAddresses(describeEipAddressesRequest)
 			if err == nil && len(response.EipAddresses.EipAddress) == 0 {
@@ -189,6 +242,7 @@ func (s *stepConfigAlicloudEIP) buildAllocateEipAddressRequest(state multistep.S
 	request.RegionId = instance.RegionId
 	request.InternetChargeType = s.InternetChargeType
 	request.Bandwidth = convertNumber(s.InternetMaxBandwidthOut)
+	setCreationTags(request.QueryParams, temporaryResourceTags(state, nil))
 
 	return request
 }
@@ -55,23 +55,44 @@ func (s *stepConfigAlicloudKeyPair) Run(ctx context.Context, state multistep.Sta
 		return multistep.ActionContinue
 	}
 
-	client := state.Get("client").(*ClientWrapper)
-	ui.Say(fmt.Sprintf("Creating temporary keypair: %s", s.Comm.SSHTemporaryKeyPairName))
-
-	createKeyPairRequest := ecs.CreateCreateKeyPairRequest()
-	createKeyPairRequest.RegionId = s.RegionId
-	createKeyPairRequest.KeyPairName = s.Comm.SSHTemporaryKeyPairName
-	keyResp, err := client.CreateKeyPair(createKeyPairRequest)
+	// 恢复构建时沿用上次的密钥对，运行中的实例不会重启，新绑定的密钥对不会生效
+	keyPairName, privateKey, err := s.describeJournaledKeyPair(state)
 	if err != nil {
-		return halt(state, err, "Error creating temporary keypair")
+		return halt(state, err, "Failed querying keypairs")
+	}
+
+	if keyPairName != "" {
+		ui.Say(fmt.Sprintf("Resuming with keypair: %s", keyPairName))
+	} else {
+		client := state.Get("client").(*ClientWrapper)
+		ui.Say(fmt.Sprintf("Creating temporary keypair: %s", s.Comm.SSHTemporaryKeyPairName))
+
+		createKeyPairRequest := ecs.CreateCreateKeyPairRequest()
+		createKeyPairRequest.RegionId = s.RegionId
+		createKeyPairRequest.KeyPairName = s.Comm.SSHTemporaryKeyPairName
+		var tags []ecs.CreateKeyPairTag
+		for key, value := range temporaryResourceTags(state, nil) {
+			tags = append(tags, ecs.CreateKeyPairTag{Key: key, Value: value})
+		}
+		createKeyPairRequest.Tag = &tags
+		keyResp, err := client.CreateKeyPair(createKeyPairRequest)
+		if err != nil {
+			return halt(state, err, "Error creating temporary keypair")
+		}
+
+		keyPairName = s.Comm.SSHTemporaryKeyPairName
+		privateKey = keyResp.PrivateKeyBody
+		if err := getJournal(state).RecordKeyPair(keyPairName, privateKey); err != nil {
+			ui.Error(err.Error())
+		}
 	}
 
 	// Set the keyname so we know to delete it later
-	s.keyName = s.Comm.SSHTemporaryKeyPairName
+	s.keyName = keyPairName
 
 	// Set some state data for use in future steps
 	s.Comm.SSHKeyPairName = s.keyName
-	s.Comm.SSHPrivateKey = []byte(keyResp.PrivateKeyBody)
+	s.Comm.SSHPrivateKey = []byte(privateKey)
 
 	// If we're in debug mode, output the private key to the working
 	// directory.
@@ -85,7 +106,7 @@ func (s *stepConfigAlicloudKeyPair) Run(ctx context.Context, state multistep.Sta
 		defer f.Close()
 
 		// Write the key out
-		if _, err := f.Write([]byte(keyResp.PrivateKeyBody)); err != nil {
+		if _, err := f.Write([]byte(privateKey)); err != nil {
 			state.Put("error", fmt.Errorf("Error saving debug key: %s", err))
 			return multistep.ActionHalt
 		}
@@ -110,6 +131,10 @@ func (s *stepConfigAlicloudKeyPair) Cleanup(state multistep.StateBag) {
 		return
 	}
 
+	if keepForResume(state, "keypair", s.keyName) {
+		return
+	}
+
 	client := state.Get("client").(*ClientWrapper)
 	ui := state.Get("ui").(packersdk.Ui)
 
@@ -133,3 +158,32 @@ func (s *stepConfigAlicloudKeyPair) Cleanup(state multistep.StateBag) {
 		}
 	}
 }
+
+// describeJournaledKeyPair returns the name and the private key of the key
+// pair recorded by a former run, or empty strings when there is none.
+func (s *stepConfigAlicloudKeyPair) describeJournaledKeyPair(state multistep.StateBag) (string, string, error) {
+	journal := getJournal(state)
+	keyPairName := journal.Resource(journalKeyPair)
+	if keyPairName == "" {
+		return "", "", nil
+	}
+
+	client := state.Get("client").(*ClientWrapper)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	describeKeyPairsRequest := ecs.CreateDescribeKeyPairsRequest()
+	describeKeyPairsRequest.RegionId = s.RegionId
+	describeKeyPairsRequest.KeyPairName = keyPairName
+	keyPairsResponse, err := client.DescribeKeyPairs(describeKeyPairsRequest)
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(keyPairsResponse.KeyPairs.KeyPair) > 0 && journal.PrivateKey != "" {
+		return keyPairName, journal.PrivateKey, nil
+	}
+
+	ui.Say(fmt.Sprintf("The recorded keypair {%s} doesn't exist any more.", keyPairName))
+	forgetResource(state, journalKeyPair)
+	return "", "", nil
+}
@@ -6,9 +6,15 @@ package ecs
 import (
 	"context"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"github.com/hashicorp/packer-plugin-sdk/communicator"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/uuid"
@@ -20,9 +26,26 @@ type stepConfigAlicloudSecurityGroup struct {
 	Description       string
 	VpcId             string
 	RegionId          string
-	isCreate          bool
+	// SourceCidrs are allowed to reach the communicator port of the instance.
+	// They default to the address of the machine running Packer.
+	SourceCidrs  []string
+	Comm         *communicator.Config
+	SSHPrivateIp bool
+	isCreate     bool
 }
 
+// publicIPServices return the public IP address of the caller, and are tried
+// in order to detect the address of the machine running Packer.
+var publicIPServices = []string{
+	"https://checkip.amazonaws.com",
+	"https://ifconfig.me/ip",
+}
+
+// privateRouteAddress is only used to find the local address routed to the
+// private network of the instance. It is the address of the metadata service,
+// and no packet is sent to it.
+const privateRouteAddress = "100.100.100.200:80"
+
 var createSecurityGroupRetryErrors = []string{
 	"IdempotentProcessing",
 }
@@ -64,10 +87,35 @@ func (s *stepConfigAlicloudSecurityGroup) Run(ctx context.Context, state multist
 		return halt(state, err, "")
 	}
 
+	if securityGroupId := getJournal(state).Resource(journalSecurityGroup); securityGroupId != "" {
+		describeSecurityGroupsRequest := ecs.CreateDescribeSecurityGroupsRequest()
+		describeSecurityGroupsRequest.RegionId = s.RegionId
+		describeSecurityGroupsRequest.SecurityGroupId = securityGroupId
+
+		securityGroupsResponse, err := client.DescribeSecurityGroups(describeSecurityGroupsRequest)
+		if err != nil {
+			return halt(state, err, "Failed querying security group")
+		}
+
+		for _, securityGroupItem := range securityGroupsResponse.SecurityGroups.SecurityGroup {
+			if securityGroupItem.SecurityGroupId == securityGroupId {
+				ui.Message(fmt.Sprintf("Resuming with security group: %s", securityGroupId))
+				state.Put("securitygroupid", securityGroupId)
+				s.isCreate = true
+				s.SecurityGroupId = securityGroupId
+				return multistep.ActionContinue
+			}
+		}
+
+		ui.Say(fmt.Sprintf("The recorded security group {%s} doesn't exist any more.", securityGroupId))
+		forgetResource(state, journalSecurityGroup)
+	}
+
 	ui.Say("Creating security group...")
 
 	createSecurityGroupRequest := s.buildCreateSecurityGroupRequest(state)
 	securityGroupResponse, err := client.WaitForExpected(&WaitForExpectArgs{
+		Context: ctx,
 		RequestFunc: func() (responses.AcsResponse, error) {
 			return client.CreateSecurityGroup(createSecurityGroupRequest)
 		},
@@ -79,6 +127,7 @@ func (s *stepConfigAlicloudSecurityGroup) Run(ctx context.Context, state multist
 	}
 
 	securityGroupId := securityGroupResponse.(*ecs.CreateSecurityGroupResponse).SecurityGroupId
+	recordResource(state, journalSecurityGroup, securityGroupId)
 
 	ui.Message(fmt.Sprintf("Created security group: %s", securityGroupId))
 	state.Put("securitygroupid", securityGroupId)
@@ -97,25 +146,116 @@ func (s *stepConfigAlicloudSecurityGroup) Run(ctx context.Context, state multist
 		return halt(state, err, "Failed authorizing security group")
 	}
 
-	authorizeSecurityGroupRequest := ecs.CreateAuthorizeSecurityGroupRequest()
-	authorizeSecurityGroupRequest.SecurityGroupId = securityGroupId
-	authorizeSecurityGroupRequest.RegionId = s.RegionId
-	authorizeSecurityGroupRequest.IpProtocol = IpProtocolAll
-	authorizeSecurityGroupRequest.PortRange = DefaultPortRange
-	authorizeSecurityGroupRequest.NicType = NicTypeInternet
-	authorizeSecurityGroupRequest.SourceCidrIp = DefaultCidrIp
+	// 仅对通信端口开放入方向访问，无通信器时不开放
+	port := s.Comm.Port()
+	if port == 0 {
+		return multistep.ActionContinue
+	}
 
-	if _, err := client.AuthorizeSecurityGroup(authorizeSecurityGroupRequest); err != nil {
-		return halt(state, err, "Failed authorizing security group")
+	sourceCidrs, err := s.sourceCidrs(ctx)
+	if err != nil {
+		return halt(state, err, "Failed detecting the address of the machine running Packer, please set temporary_security_group_source_cidrs")
+	}
+
+	nicType := NicTypeInternet
+	if s.SSHPrivateIp {
+		nicType = NicTypeIntranet
+	}
+	for _, sourceCidr := range sourceCidrs {
+		ui.Message(fmt.Sprintf("Authorizing access to port %d from %s", port, sourceCidr))
+
+		authorizeSecurityGroupRequest := ecs.CreateAuthorizeSecurityGroupRequest()
+		authorizeSecurityGroupRequest.SecurityGroupId = securityGroupId
+		authorizeSecurityGroupRequest.RegionId = s.RegionId
+		authorizeSecurityGroupRequest.IpProtocol = IpProtocolTCP
+		authorizeSecurityGroupRequest.PortRange = fmt.Sprintf("%d/%d", port, port)
+		authorizeSecurityGroupRequest.NicType = nicType
+		authorizeSecurityGroupRequest.SourceCidrIp = sourceCidr
+
+		if _, err := client.AuthorizeSecurityGroup(authorizeSecurityGroupRequest); err != nil {
+			return halt(state, err, "Failed authorizing security group")
+		}
 	}
 
 	return multistep.ActionContinue
 }
 
+// sourceCidrs returns the CIDR blocks allowed to reach the communicator port:
+// SourceCidrs when set, otherwise the address of the machine running Packer
+// on the network Packer connects through.
+func (s *stepConfigAlicloudSecurityGroup) sourceCidrs(ctx context.Context) ([]string, error) {
+	if len(s.SourceCidrs) > 0 {
+		return s.SourceCidrs, nil
+	}
+
+	var address string
+	var err error
+	if s.SSHPrivateIp {
+		address, err = detectPrivateIP()
+	} else {
+		address, err = detectPublicIP(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{address + "/32"}, nil
+}
+
+// detectPublicIP returns the public IPv4 address of the machine running
+// Packer, as seen by the first publicIPServices answering.
+func detectPublicIP(ctx context.Context) (string, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	var errs []string
+	for _, service := range publicIPServices {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, service, nil)
+		if err != nil {
+			return "", err
+		}
+
+		response, err := client.Do(request)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		body, err := io.ReadAll(io.LimitReader(response.Body, 64))
+		response.Body.Close()
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		address := net.ParseIP(strings.TrimSpace(string(body)))
+		if response.StatusCode != http.StatusOK || address == nil || address.To4() == nil {
+			errs = append(errs, fmt.Sprintf("%s returned an invalid address %q", service, body))
+			continue
+		}
+		return address.String(), nil
+	}
+
+	return "", fmt.Errorf("no public IP address detected: %s", strings.Join(errs, "; "))
+}
+
+// detectPrivateIP returns the local IPv4 address of the machine running
+// Packer routed to the private network.
+func detectPrivateIP() (string, error) {
+	conn, err := net.Dial("udp4", privateRouteAddress)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
+
 func (s *stepConfigAlicloudSecurityGroup) Cleanup(state multistep.StateBag) {
 	if !s.isCreate {
 		return
 	}
+	if keepForResume(state, "security group", s.SecurityGroupId) {
+		return
+	}
 
 	cleanUpMessage(state, "security group")
 
@@ -145,6 +285,11 @@ func (s *stepConfigAlicloudSecurityGroup) buildCreateSecurityGroupRequest(state
 	request.ClientToken = uuid.TimeOrderedUUID()
 	request.RegionId = s.RegionId
 	request.SecurityGroupName = s.SecurityGroupName
+	var tags []ecs.CreateSecurityGroupTag
+	for key, value := range temporaryResourceTags(state, nil) {
+		tags = append(tags, ecs.CreateSecurityGroupTag{Key: key, Value: value})
+	}
+	request.Tag = &tags
 
 	if networkType == InstanceNetworkVpc {
 		vpcId := state.Get("vpcid").(string)
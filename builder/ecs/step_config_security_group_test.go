@@ -0,0 +1,128 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ecs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/communicator"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func testSecurityGroupState(t *testing.T, api *fakeAlicloudAPI) multistep.StateBag {
+	client, vpcClient := api.Clients(t)
+
+	state := new(multistep.BasicStateBag)
+	state.Put("config", &Config{})
+	state.Put("client", client)
+	state.Put("vpcClient", vpcClient)
+	state.Put("ui", packersdk.TestUi(t))
+	state.Put("networktype", InstanceNetWork(InstanceNetworkClassic))
+	return state
+}
+
+func testIngressRules(api *fakeAlicloudAPI, securityGroupId string) []fakeSecurityGroupRule {
+	var ingress []fakeSecurityGroupRule
+	for _, rule := range api.Rules(securityGroupId) {
+		if rule.Direction == "ingress" {
+			ingress = append(ingress, rule)
+		}
+	}
+	return ingress
+}
+
+func TestStepConfigSecurityGroup_SourceCidrs(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	state := testSecurityGroupState(t, api)
+	step := &stepConfigAlicloudSecurityGroup{
+		RegionId:    fakeAPIRegion,
+		SourceCidrs: []string{"10.0.0.0/8", "192.168.1.0/24"},
+		Comm:        &communicator.Config{Type: "winrm", WinRM: communicator.WinRM{WinRMPort: 5986}},
+	}
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("should not have error: %s", state.Get("error"))
+	}
+
+	ingress := testIngressRules(api, state.Get("securitygroupid").(string))
+	if len(ingress) != 2 {
+		t.Fatalf("bad: expected an ingress rule per source CIDR, actual: %v", ingress)
+	}
+	for i, rule := range ingress {
+		if rule.IpProtocol != IpProtocolTCP || rule.PortRange != "5986/5986" || rule.CidrIp != step.SourceCidrs[i] {
+			t.Fatalf("bad: ingress should only open the WinRM port to %s, actual: %v", step.SourceCidrs[i], rule)
+		}
+	}
+}
+
+func TestStepConfigSecurityGroup_DetectPublicIP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "203.0.113.7")
+	}))
+	defer server.Close()
+	defer func(services []string) { publicIPServices = services }(publicIPServices)
+	publicIPServices = []string{"http://127.0.0.1:1", server.URL}
+
+	api := newFakeAlicloudAPI(t)
+	state := testSecurityGroupState(t, api)
+	step := &stepConfigAlicloudSecurityGroup{
+		RegionId: fakeAPIRegion,
+		Comm:     &communicator.Config{Type: "ssh", SSH: communicator.SSH{SSHPort: 22}},
+	}
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("should not have error: %s", state.Get("error"))
+	}
+
+	ingress := testIngressRules(api, state.Get("securitygroupid").(string))
+	if len(ingress) != 1 || ingress[0].PortRange != "22/22" || ingress[0].CidrIp != "203.0.113.7/32" {
+		t.Fatalf("bad: ingress should only open SSH to the detected address, actual: %v", ingress)
+	}
+}
+
+func TestStepConfigSecurityGroup_DetectPublicIPFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "not an address")
+	}))
+	defer server.Close()
+	defer func(services []string) { publicIPServices = services }(publicIPServices)
+	publicIPServices = []string{server.URL}
+
+	api := newFakeAlicloudAPI(t)
+	state := testSecurityGroupState(t, api)
+	step := &stepConfigAlicloudSecurityGroup{
+		RegionId: fakeAPIRegion,
+		Comm:     &communicator.Config{Type: "ssh", SSH: communicator.SSH{SSHPort: 22}},
+	}
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatal("should have error")
+	}
+	step.Cleanup(state)
+	if leftovers := api.Leftovers(); len(leftovers) > 0 {
+		t.Fatalf("the security group should have been deleted, actual: %v", leftovers)
+	}
+}
+
+func TestStepConfigSecurityGroup_NoCommunicator(t *testing.T) {
+	api := newFakeAlicloudAPI(t)
+	state := testSecurityGroupState(t, api)
+	step := &stepConfigAlicloudSecurityGroup{
+		RegionId: fakeAPIRegion,
+		Comm:     &communicator.Config{Type: "none"},
+	}
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("should not have error: %s", state.Get("error"))
+	}
+
+	if ingress := testIngressRules(api, state.Get("securitygroupid").(string)); len(ingress) > 0 {
+		t.Fatalf("bad: no ingress should be opened without a communicator, actual: %v", ingress)
+	}
+}
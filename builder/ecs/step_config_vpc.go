@@ -61,10 +61,33 @@ func (s *stepConfigAlicloudVPC) Run(ctx context.Context, state multistep.StateBa
 		return halt(state, errorsNew.New(message), "")
 	}
 
+	if vpcId := getJournal(state).Resource(journalVpc); vpcId != "" {
+		describeVpcsRequest := ecs.CreateDescribeVpcsRequest()
+		describeVpcsRequest.VpcId = vpcId
+		describeVpcsRequest.RegionId = config.AlicloudRegion
+
+		vpcsResponse, err := client.DescribeVpcs(describeVpcsRequest)
+		if err != nil {
+			return halt(state, err, "Failed querying vpcs")
+		}
+
+		if len(vpcsResponse.Vpcs.Vpc) > 0 {
+			ui.Message(fmt.Sprintf("Resuming with vpc: %s", vpcId))
+			state.Put("vpcid", vpcId)
+			s.isCreate = true
+			s.VpcId = vpcId
+			return multistep.ActionContinue
+		}
+
+		ui.Say(fmt.Sprintf("The recorded vpc {%s} doesn't exist any more.", vpcId))
+		forgetResource(state, journalVpc)
+	}
+
 	ui.Say("Creating vpc...")
 
 	createVpcRequest := s.buildCreateVpcRequest(state)
 	createVpcResponse, err := client.WaitForExpected(&WaitForExpectArgs{
+		Context: ctx,
 		RequestFunc: func() (responses.AcsResponse, error) {
 			return client.CreateVpc(createVpcRequest)
 		},
@@ -75,7 +98,9 @@ func (s *stepConfigAlicloudVPC) Run(ctx context.Context, state multistep.StateBa
 	}
 
 	vpcId := createVpcResponse.(*ecs.CreateVpcResponse).VpcId
+	recordResource(state, journalVpc, vpcId)
 	_, err = client.WaitForExpected(&WaitForExpectArgs{
+		Context: ctx,
 		RequestFunc: func() (responses.AcsResponse, error) {
 			request := ecs.CreateDescribeVpcsRequest()
 			request.RegionId = config.AlicloudRegion
@@ -117,6 +142,9 @@ func (s *stepConfigAlicloudVPC) Cleanup(state multistep.StateBag) {
 	if !s.isCreate {
 		return
 	}
+	if keepForResume(state, "VPC", s.VpcId) {
+		return
+	}
 
 	cleanUpMessage(state, "VPC")
 
@@ -146,6 +174,7 @@ func (s *stepConfigAlicloudVPC) buildCreateVpcRequest(state multistep.StateBag)
 	request.RegionId = config.AlicloudRegion
 	request.CidrBlock = s.CidrBlock
 	request.VpcName = s.VpcName
+	setCreationTags(request.QueryParams, temporaryResourceTags(state, nil))
 
 	return request
 }
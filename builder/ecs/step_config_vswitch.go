@@ -70,30 +70,29 @@ func (s *stepConfigAlicloudVSwitch) Run(ctx context.Context, state multistep.Sta
 	zones := []string{s.ZoneId}
 	if len(s.ZoneId) == 0 {
 		ui.Say("Searching zones...")
-		availableResourceRequest := ecs.CreateDescribeAvailableResourceRequest()
-		availableResourceRequest.RegionId = config.AlicloudRegion
-		availableResourceRequest.DestinationResource = "InstanceType"
-		availableResourceRequest.IoOptimized = "optimized"
-		availableResourceRequest.ResourceType = "instance"
-		availableResourceRequest.InstanceType = config.InstanceType
-
-		resourceResponse, err := client.DescribeAvailableResource(availableResourceRequest)
+		instanceTypes := config.candidateInstanceTypes()
+		instanceTypeZones, err := describeInstanceTypeZones(client, config.AlicloudRegion, instanceTypes)
 		if err != nil {
 			return halt(state, err, "Query for available instance zones failed")
 		}
-
 		zones = make([]string, 0)
-		for _, zone := range resourceResponse.AvailableZones.AvailableZone {
-			if zone.Status == "Available" &&
-				zone.AvailableResources.AvailableResource[0].SupportedResources.SupportedResource[0].Status == "Available" {
-				zones = append(zones, zone.ZoneId)
+		for _, instanceType := range instanceTypes {
+			if len(instanceTypeZones[instanceType]) == 0 {
+				ui.Say(fmt.Sprintf("实例类型 %s 没有在售可用区", instanceType))
+			}
+			// 按机型顺序排列可用区，优先使用首选机型的可用区
+			for _, zoneId := range instanceTypeZones[instanceType] {
+				if !slices.Contains(zones, zoneId) {
+					zones = append(zones, zoneId)
+				}
 			}
 		}
 		if len(zones) == 0 {
-			ui.Say(fmt.Sprintf("实例类型 %s 没有在售可用区", config.InstanceType))
-			state.Put("error", fmt.Errorf("实例类型 %s 没有在售可用区", config.InstanceType))
+			ui.Say(fmt.Sprintf("实例类型 %s 没有在售可用区", strings.Join(instanceTypes, ", ")))
+			state.Put("error", fmt.Errorf("实例类型 %s 没有在售可用区", strings.Join(instanceTypes, ", ")))
 			return multistep.ActionHalt
 		}
+		state.Put("instance_type_zones", instanceTypeZones)
 		ui.Say("Candidate zones are: " + strings.Join(zones, ", "))
 	}
 
@@ -126,6 +125,27 @@ func (s *stepConfigAlicloudVSwitch) Run(ctx context.Context, state multistep.Sta
 		return halt(state, fmt.Errorf("the specified vswitch {%s} doesn't exist", s.VSwitchName), "")
 	}
 
+	if vSwitchId := getJournal(state).Resource(journalVSwitch); vSwitchId != "" {
+		describeVSwitchesRequest := vpc.CreateDescribeVSwitchesRequest()
+		describeVSwitchesRequest.VpcId = vpcId
+		describeVSwitchesRequest.VSwitchId = vSwitchId
+
+		vSwitchesResponse, err := vpcClient.DescribeVSwitches(describeVSwitchesRequest)
+		if err != nil {
+			return halt(state, err, "Failed querying vswitch")
+		}
+
+		if len(vSwitchesResponse.VSwitches.VSwitch) > 0 {
+			ui.Message(fmt.Sprintf("Resuming with vswitch: %s", vSwitchId))
+			s.createdVSwitchId = vSwitchId
+			state.Put("vswitches", vSwitchesResponse.VSwitches.VSwitch[:1])
+			return multistep.ActionContinue
+		}
+
+		ui.Say(fmt.Sprintf("The recorded vswitch {%s} doesn't exist any more.", vSwitchId))
+		forgetResource(state, journalVSwitch)
+	}
+
 	if config.CidrBlock == "" {
 		s.CidrBlock = DefaultCidrBlock //use the default CirdBlock
 	}
@@ -140,7 +160,9 @@ func (s *stepConfigAlicloudVSwitch) Run(ctx context.Context, state multistep.Sta
 		createVSwitchRequest.ZoneId = zoneId
 		createVSwitchRequest.VpcId = vpcId
 		createVSwitchRequest.VSwitchName = s.VSwitchName
+		setCreationTags(createVSwitchRequest.QueryParams, temporaryResourceTags(state, nil))
 		createVSwitchResponse, err := client.WaitForExpected(&WaitForExpectArgs{
+			Context: ctx,
 			RequestFunc: func() (responses.AcsResponse, error) {
 				return vpcClient.CreateVSwitch(createVSwitchRequest)
 			},
@@ -152,6 +174,7 @@ func (s *stepConfigAlicloudVSwitch) Run(ctx context.Context, state multistep.Sta
 		}
 
 		s.createdVSwitchId = createVSwitchResponse.(*vpc.CreateVSwitchResponse).VSwitchId
+		recordResource(state, journalVSwitch, s.createdVSwitchId)
 
 		describeVSwitchesRequest := vpc.CreateDescribeVSwitchesRequest()
 		describeVSwitchesRequest.VpcId = vpcId
@@ -159,6 +182,7 @@ func (s *stepConfigAlicloudVSwitch) Run(ctx context.Context, state multistep.Sta
 
 		var vswitch vpc.VSwitch
 		_, err = client.WaitForExpected(&WaitForExpectArgs{
+			Context: ctx,
 			RequestFunc: func() (responses.AcsResponse, error) {
 				return vpcClient.DescribeVSwitches(describeVSwitchesRequest)
 			},
@@ -197,6 +221,9 @@ func (s *stepConfigAlicloudVSwitch) Cleanup(state multistep.StateBag) {
 	if len(s.createdVSwitchId) == 0 {
 		return
 	}
+	if keepForResume(state, "vSwitch", s.createdVSwitchId) {
+		return
+	}
 
 	cleanUpMessage(state, "vSwitch")
 
@@ -218,3 +245,31 @@ func (s *stepConfigAlicloudVSwitch) Cleanup(state multistep.StateBag) {
 	}
 
 }
+
+// describeInstanceTypeZones returns the zones where each of the instance types
+// is available.
+func describeInstanceTypeZones(client *ClientWrapper, regionId string, instanceTypes []string) (map[string][]string, error) {
+	instanceTypeZones := make(map[string][]string, len(instanceTypes))
+	for _, instanceType := range instanceTypes {
+		availableResourceRequest := ecs.CreateDescribeAvailableResourceRequest()
+		availableResourceRequest.RegionId = regionId
+		availableResourceRequest.DestinationResource = "InstanceType"
+		availableResourceRequest.IoOptimized = "optimized"
+		availableResourceRequest.ResourceType = "instance"
+		availableResourceRequest.InstanceType = instanceType
+
+		resourceResponse, err := client.DescribeAvailableResource(availableResourceRequest)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, zone := range resourceResponse.AvailableZones.AvailableZone {
+			if zone.Status == "Available" &&
+				zone.AvailableResources.AvailableResource[0].SupportedResources.SupportedResource[0].Status == "Available" {
+				instanceTypeZones[instanceType] = append(instanceTypeZones[instanceType], zone.ZoneId)
+			}
+		}
+	}
+
+	return instanceTypeZones, nil
+}
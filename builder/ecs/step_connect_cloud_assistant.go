@@ -0,0 +1,83 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ecs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// cloudAssistantOnlineTimeout is how long the Cloud Assistant agent of a new
+// instance is waited for.
+const cloudAssistantOnlineTimeout = 10 * time.Minute
+
+// stepConnectCloudAssistant waits for the Cloud Assistant agent of the
+// instance to be online, and provides the communicator running the commands
+// through it.
+type stepConnectCloudAssistant struct {
+	RegionId       string
+	CommandTimeout time.Duration
+}
+
+func (s *stepConnectCloudAssistant) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*ClientWrapper)
+	ui := state.Get("ui").(packersdk.Ui)
+	instance := state.Get("instance").(*ecs.Instance)
+
+	ui.Say("Waiting for the Cloud Assistant agent to be online...")
+	response, err := client.WaitForExpected(&WaitForExpectArgs{
+		Context: ctx,
+		RequestFunc: func() (responses.AcsResponse, error) {
+			request := ecs.CreateDescribeCloudAssistantStatusRequest()
+			request.RegionId = s.RegionId
+			request.InstanceId = &[]string{instance.InstanceId}
+			return client.DescribeCloudAssistantStatus(request)
+		},
+		EvalFunc: func(response responses.AcsResponse, err error) WaitForExpectEvalResult {
+			if err != nil {
+				return WaitForExpectToRetry
+			}
+
+			statuses := response.(*ecs.DescribeCloudAssistantStatusResponse).InstanceCloudAssistantStatusSet.InstanceCloudAssistantStatus
+			for _, status := range statuses {
+				if status.CloudAssistantStatus == "true" {
+					return WaitForExpectSuccess
+				}
+			}
+			return WaitForExpectToRetry
+		},
+		RetryTimeout: cloudAssistantOnlineTimeout,
+	})
+	if err != nil {
+		return halt(state, err, "Error waiting for the Cloud Assistant agent to be online")
+	}
+
+	status := response.(*ecs.DescribeCloudAssistantStatusResponse).InstanceCloudAssistantStatusSet.InstanceCloudAssistantStatus[0]
+	ui.Message(fmt.Sprintf("Cloud Assistant agent %s is online", status.CloudAssistantVersion))
+
+	state.Put("communicator", &cloudAssistantCommunicator{
+		client:     client,
+		regionId:   s.RegionId,
+		instanceId: instance.InstanceId,
+		windows:    strings.EqualFold(status.OSType, "windows"),
+		timeout:    s.CommandTimeout,
+	})
+
+	return multistep.ActionContinue
+}
+
+func (s *stepConnectCloudAssistant) Cleanup(state multistep.StateBag) {}
+
+// cloudAssistantHost names the instance the cloud-assistant communicator
+// connects to, which has no address.
+func cloudAssistantHost(state multistep.StateBag) (string, error) {
+	return state.Get("instance_id").(string), nil
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	confighelper "github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/uuid"
 )
 
@@ -32,43 +33,65 @@ func (s *stepCreateAlicloudImage) Run(ctx context.Context, state multistep.State
 	client := state.Get("client").(*ClientWrapper)
 	ui := state.Get("ui").(packersdk.Ui)
 
-	tempImageName := config.AlicloudImageName
-	if config.ImageEncrypted.True() {
-		tempImageName = fmt.Sprintf("packer_%s", random.AlphaNum(7))
-		ui.Say(fmt.Sprintf("Creating temporary image for encryption: %s", tempImageName))
-	} else {
-		ui.Say(fmt.Sprintf("Creating image: %s", tempImageName))
+	imageId, err := s.describeJournaledImage(state)
+	if err != nil {
+		return halt(state, err, "Error querying image")
 	}
 
-	createImageRequest := s.buildCreateImageRequest(state, tempImageName)
-	createImageResponse, err := client.WaitForExpected(&WaitForExpectArgs{
-		RequestFunc: func() (responses.AcsResponse, error) {
-			return client.CreateImage(createImageRequest)
-		},
-		EvalFunc: client.EvalCouldRetryResponse(createImageRetryErrors, EvalRetryErrorType),
-	})
+	if imageId != "" {
+		ui.Say(fmt.Sprintf("Resuming with image: %s", imageId))
+	} else {
+		tempImageName := config.AlicloudImageName
+		if config.ImageEncrypted.True() {
+			tempImageName = fmt.Sprintf("packer_%s", random.AlphaNum(7))
+			ui.Say(fmt.Sprintf("Creating temporary image for encryption: %s", tempImageName))
+		} else {
+			ui.Say(fmt.Sprintf("Creating image: %s", tempImageName))
+		}
 
-	if err != nil {
-		return halt(state, err, "Error creating image")
-	}
+		createImageRequest := s.buildCreateImageRequest(state, tempImageName)
+		createImageResponse, err := client.WaitForExpected(&WaitForExpectArgs{
+			Context: ctx,
+			RequestFunc: func() (responses.AcsResponse, error) {
+				return client.CreateImage(createImageRequest)
+			},
+			EvalFunc: client.EvalCouldRetryResponse(createImageRetryErrors, EvalRetryErrorType),
+		})
+
+		if err != nil {
+			return halt(state, err, "Error creating image")
+		}
 
-	imageId := createImageResponse.(*ecs.CreateImageResponse).ImageId
+		imageId = createImageResponse.(*ecs.CreateImageResponse).ImageId
+		recordResource(state, journalImage, imageId)
+	}
 
-	imagesResponse, err := client.WaitForImageStatus(config.AlicloudRegion, imageId, ImageStatusAvailable, time.Duration(s.WaitSnapshotReadyTimeout)*time.Second)
+	imagesResponse, err := client.WaitForImageStatus(ctx, config.AlicloudRegion, imageId, ImageStatusAvailable, time.Duration(s.WaitSnapshotReadyTimeout)*time.Second)
 
-	// save image first for cleaning up if timeout
-	images := imagesResponse.(*ecs.DescribeImagesResponse).Images.Image
-	if len(images) == 0 {
-		return halt(state, err, "Unable to find created image")
+	// save image first for cleaning up if timeout or cancelled, the image may
+	// not have been described yet when the build is cancelled
+	s.image = &ecs.Image{ImageId: imageId}
+	if imagesResponse, ok := imagesResponse.(*ecs.DescribeImagesResponse); ok && imagesResponse != nil && len(imagesResponse.Images.Image) > 0 {
+		s.image = &imagesResponse.Images.Image[0]
 	}
-	s.image = &images[0]
 
+	if IsWaitForExpectCancelled(err) {
+		return halt(state, err, "Cancelled waiting for image to be created")
+	}
 	if err != nil {
 		return halt(state, err, "Timeout waiting for image to be created")
 	}
 
+	// CreateImage 不支持设置启动模式和 NVMe 支持，在镜像创建完成后修改
+	if request := buildModifyImageAttributeRequest(config, config.AlicloudRegion, imageId, false); request != nil {
+		ui.Say(fmt.Sprintf("Setting the features of image: %s", imageId))
+		if _, err := client.ModifyImageAttribute(request); err != nil {
+			return halt(state, err, "Error setting the features of image")
+		}
+	}
+
 	var snapshotIds []string
-	for _, device := range images[0].DiskDeviceMappings.DiskDeviceMapping {
+	for _, device := range s.image.DiskDeviceMappings.DiskDeviceMapping {
 		snapshotIds = append(snapshotIds, device.SnapshotId)
 	}
 
@@ -76,7 +99,7 @@ func (s *stepCreateAlicloudImage) Run(ctx context.Context, state multistep.State
 	state.Put("alicloudsnapshots", snapshotIds)
 
 	alicloudImages := make(map[string]string)
-	alicloudImages[config.AlicloudRegion] = images[0].ImageId
+	alicloudImages[config.AlicloudRegion] = imageId
 	state.Put("alicloudimages", alicloudImages)
 
 	return multistep.ActionContinue
@@ -97,6 +120,10 @@ func (s *stepCreateAlicloudImage) Cleanup(state multistep.StateBag) {
 		return
 	}
 
+	if keepForResume(state, "image", s.image.ImageId) {
+		return
+	}
+
 	client := state.Get("client").(*ClientWrapper)
 	ui := state.Get("ui").(packersdk.Ui)
 
@@ -106,6 +133,17 @@ func (s *stepCreateAlicloudImage) Cleanup(state multistep.StateBag) {
 		ui.Say("Deleting the image and related snapshots because of cancellation or error...")
 	}
 
+	// 构建取消时镜像可能还没有查询到，删除前先找到它的快照
+	if len(s.image.DiskDeviceMappings.DiskDeviceMapping) == 0 {
+		describeImagesRequest := ecs.CreateDescribeImagesRequest()
+		describeImagesRequest.RegionId = config.AlicloudRegion
+		describeImagesRequest.ImageId = s.image.ImageId
+		describeImagesRequest.Status = ImageStatusQueried
+		if imagesResponse, err := client.DescribeImages(describeImagesRequest); err == nil && len(imagesResponse.Images.Image) > 0 {
+			s.image = &imagesResponse.Images.Image[0]
+		}
+	}
+
 	deleteImageRequest := ecs.CreateDeleteImageRequest()
 	deleteImageRequest.RegionId = config.AlicloudRegion
 	deleteImageRequest.ImageId = s.image.ImageId
@@ -125,6 +163,36 @@ func (s *stepCreateAlicloudImage) Cleanup(state multistep.StateBag) {
 	}
 }
 
+// describeJournaledImage returns the ID of the image recorded by a former run,
+// or an empty string when there is none.
+func (s *stepCreateAlicloudImage) describeJournaledImage(state multistep.StateBag) (string, error) {
+	imageId := getJournal(state).Resource(journalImage)
+	if imageId == "" {
+		return "", nil
+	}
+
+	config := state.Get("config").(*Config)
+	client := state.Get("client").(*ClientWrapper)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	describeImagesRequest := ecs.CreateDescribeImagesRequest()
+	describeImagesRequest.RegionId = config.AlicloudRegion
+	describeImagesRequest.ImageId = imageId
+	describeImagesRequest.Status = ImageStatusQueried
+	imagesResponse, err := client.DescribeImages(describeImagesRequest)
+	if err != nil {
+		return "", err
+	}
+
+	if len(imagesResponse.Images.Image) > 0 {
+		return imageId, nil
+	}
+
+	ui.Say(fmt.Sprintf("The recorded image {%s} doesn't exist any more.", imageId))
+	forgetResource(state, journalImage)
+	return "", nil
+}
+
 func (s *stepCreateAlicloudImage) buildCreateImageRequest(state multistep.StateBag, imageName string) *ecs.CreateImageRequest {
 	config := state.Get("config").(*Config)
 
@@ -135,6 +203,11 @@ func (s *stepCreateAlicloudImage) buildCreateImageRequest(state multistep.StateB
 	request.ImageVersion = config.AlicloudImageVersion
 	request.Description = config.AlicloudImageDescription
 	request.ResourceGroupId = config.AlicloudResourceGroupId
+	request.Architecture = config.ImageArchitecture
+	// 加密时该镜像只是临时镜像，由加密后的副本加入镜像族系
+	if !config.ImageEncrypted.True() {
+		request.ImageFamily = config.TargetImageFamily
+	}
 
 	if s.AlicloudImageIgnoreDataDisks {
 		snapshotId := state.Get("alicloudsnapshot").(string)
@@ -146,3 +219,32 @@ func (s *stepCreateAlicloudImage) buildCreateImageRequest(state multistep.StateB
 
 	return request
 }
+
+// buildModifyImageAttributeRequest returns the request setting the features
+// of an image which CreateImage and CopyImage do not take, and the image
+// family too when withFamily is true. It returns nil when there is nothing to
+// set.
+func buildModifyImageAttributeRequest(config *Config, regionId string, imageId string, withFamily bool) *ecs.ModifyImageAttributeRequest {
+	request := ecs.CreateModifyImageAttributeRequest()
+	request.RegionId = regionId
+	request.ImageId = imageId
+	request.BootMode = config.ImageBootMode
+	if withFamily {
+		request.ImageFamily = config.TargetImageFamily
+	}
+
+	// The SDK does not know the features of images yet.
+	setNvmeSupport := config.ImageNvmeSupport != confighelper.TriUnset
+	if setNvmeSupport {
+		nvmeSupport := ImageNvmeUnsupported
+		if config.ImageNvmeSupport.True() {
+			nvmeSupport = ImageNvmeSupported
+		}
+		request.QueryParams["Features.NvmeSupport"] = nvmeSupport
+	}
+
+	if request.BootMode == "" && request.ImageFamily == "" && !setNvmeSupport {
+		return nil
+	}
+	return request
+}
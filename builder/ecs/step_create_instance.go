@@ -8,21 +8,24 @@ import (
 	"encoding/base64"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/vpc"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
 	confighelper "github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/uuid"
 )
 
 type stepCreateAlicloudInstance struct {
 	IOOptimized                 confighelper.Trilean
-	InstanceType                string
+	InstanceTypes               []string
 	UserData                    string
 	UserDataFile                string
 	RamRoleName                 string
@@ -33,6 +36,10 @@ type stepCreateAlicloudInstance struct {
 	InstanceName                string
 	SecurityEnhancementStrategy string
 	AlicloudImageFamily         string
+	SpotStrategy                string
+	SpotPriceLimit              float64
+	SpotDuration                *int
+	GeneratedData               *packerbuilderdata.GeneratedData
 	createdInstanceId           string
 }
 
@@ -40,66 +47,163 @@ var createInstanceRetryErrors = []string{
 	"IdempotentProcessing",
 }
 
+// The errors of CreateInstance meaning that no spot instance is available,
+// after which a pay-as-you-go instance is tried.
+var spotNoStockErrors = []string{
+	"OperationDenied.NoStock",
+	"Zone.NotOnSale",
+	"InvalidResourceType.NotSupported",
+}
+
 var deleteInstanceRetryErrors = []string{
 	"IncorrectInstanceStatus.Initializing",
 }
 
-func (s *stepCreateAlicloudInstance) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+func (s *stepCreateAlicloudInstance) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	client := state.Get("client").(*ClientWrapper)
 	ui := state.Get("ui").(packersdk.Ui)
 
-	ui.Say("Creating instance...")
-	vSwitches := state.Get("vswitches").([]vpc.VSwitch)
-	for _, vSwitch := range vSwitches {
-		ui.Say(fmt.Sprintf("Try to create instance in zone: %s ...", vSwitch.ZoneId))
-		createInstanceRequest, err := s.buildCreateInstanceRequest(state, vSwitch)
+	if instanceId := getJournal(state).Resource(journalInstance); instanceId != "" {
+		describeInstancesRequest := ecs.CreateDescribeInstancesRequest()
+		describeInstancesRequest.InstanceIds = fmt.Sprintf("[\"%s\"]", instanceId)
+		instances, err := client.DescribeInstances(describeInstancesRequest)
 		if err != nil {
-			return halt(state, err, "")
+			return halt(state, err, "Failed querying instance")
 		}
 
-		createInstanceResponse, err := client.WaitForExpected(&WaitForExpectArgs{
-			RequestFunc: func() (responses.AcsResponse, error) {
-				return client.CreateInstance(createInstanceRequest)
-			},
-			EvalFunc: client.EvalCouldRetryResponse(createInstanceRetryErrors, EvalRetryErrorType),
-		})
-
-		if err != nil {
-			// halt会记录error，影响最终执行status code。这里只需要提示
-			ui.Say(fmt.Sprintf("Error creating instance: %s", err))
-			continue
+		if len(instances.Instances.Instance) > 0 {
+			ui.Message(fmt.Sprintf("Resuming with instance: %s", instanceId))
+			s.createdInstanceId = instanceId
+			instance := &instances.Instances.Instance[0]
+			s.putInstance(state, instance, instance.InstanceType)
+			return multistep.ActionContinue
 		}
 
-		s.createdInstanceId = createInstanceResponse.(*ecs.CreateInstanceResponse).InstanceId
+		ui.Say(fmt.Sprintf("The recorded instance {%s} doesn't exist any more.", instanceId))
+		forgetResource(state, journalInstance)
+	}
 
-		_, err = client.WaitForInstanceStatus(s.RegionId, s.createdInstanceId, InstanceStatusStopped)
-		if err != nil {
-			return halt(state, fmt.Errorf("zone: %s \n err: %v", vSwitch.ZoneId, err), "Error waiting created instance")
+	ui.Say("Creating instance...")
+	instanceType, vSwitch, err := s.createInstance(ctx, state)
+	if err != nil {
+		return halt(state, err, "Error creating instance")
+	}
+
+	_, err = client.WaitForInstanceStatus(ctx, s.RegionId, s.createdInstanceId, InstanceStatusStopped)
+	if err != nil {
+		return halt(state, fmt.Errorf("zone: %s \n err: %v", vSwitch.ZoneId, err), "Error waiting created instance")
+	}
+
+	describeInstancesRequest := ecs.CreateDescribeInstancesRequest()
+	describeInstancesRequest.InstanceIds = fmt.Sprintf("[\"%s\"]", s.createdInstanceId)
+	instances, err := client.DescribeInstances(describeInstancesRequest)
+	if err != nil {
+		return halt(state, err, "")
+	}
+
+	ui.Message(fmt.Sprintf("Created instance: %s", s.createdInstanceId))
+	s.putInstance(state, &instances.Instances.Instance[0], instanceType)
+
+	return multistep.ActionContinue
+}
+
+// putInstance shares the created or resumed instance with the next steps.
+func (s *stepCreateAlicloudInstance) putInstance(state multistep.StateBag, instance *ecs.Instance, instanceType string) {
+	state.Put("instance", instance)
+	state.Put("instance_type", instanceType)
+	// instance_id is the generic term used so that users can have access to the
+	// instance id inside of the provisioners, used in step_provision.
+	state.Put("instance_id", s.createdInstanceId)
+	s.GeneratedData.Put("InstanceId", s.createdInstanceId)
+	s.GeneratedData.Put("InstanceType", instanceType)
+	s.GeneratedData.Put("ZoneId", instance.ZoneId)
+	s.GeneratedData.Put("VSwitchId", instance.VpcAttributes.VSwitchId)
+}
+
+// createInstance tries the spot strategies, the instance types and the
+// vswitches in order, until an instance is created. It returns the instance
+// type and the vswitch of the created instance.
+func (s *stepCreateAlicloudInstance) createInstance(ctx context.Context, state multistep.StateBag) (string, vpc.VSwitch, error) {
+	client := state.Get("client").(*ClientWrapper)
+	ui := state.Get("ui").(packersdk.Ui)
+	vSwitches := state.Get("vswitches").([]vpc.VSwitch)
+
+	// 可用区查询结果，不存在时在所有交换机中尝试
+	var instanceTypeZones map[string][]string
+	if zones, ok := state.GetOk("instance_type_zones"); ok {
+		instanceTypeZones = zones.(map[string][]string)
+	}
+
+	spotStrategies := []string{s.SpotStrategy}
+	if s.SpotStrategy == SpotStrategyWithPriceLimit || s.SpotStrategy == SpotStrategyAsPriceGo {
+		// 竞价实例在所有可用区都无法创建时，回退到按量付费实例
+		spotStrategies = append(spotStrategies, SpotStrategyNoSpot)
+	}
+
+	var lastErr error
+	for i, spotStrategy := range spotStrategies {
+		if i > 0 {
+			// 只有库存不足时才回退，其它错误（价格、配额、权限）直接返回
+			if lastErr != nil {
+				return "", vpc.VSwitch{}, lastErr
+			}
+			ui.Say("No spot instance available in all candidate zones, falling back to pay-as-you-go instance...")
 		}
 
-		describeInstancesRequest := ecs.CreateDescribeInstancesRequest()
-		describeInstancesRequest.InstanceIds = fmt.Sprintf("[\"%s\"]", s.createdInstanceId)
-		instances, err := client.DescribeInstances(describeInstancesRequest)
-		if err != nil {
-			return halt(state, err, "")
+		for _, instanceType := range s.InstanceTypes {
+			for _, vSwitch := range vSwitches {
+				if instanceTypeZones != nil && !slices.Contains(instanceTypeZones[instanceType], vSwitch.ZoneId) {
+					continue
+				}
+
+				ui.Say(fmt.Sprintf("Try to create instance %s in zone: %s ...", instanceType, vSwitch.ZoneId))
+				createInstanceRequest, err := s.buildCreateInstanceRequest(state, vSwitch, instanceType, spotStrategy)
+				if err != nil {
+					return "", vSwitch, err
+				}
+
+				createInstanceResponse, err := client.WaitForExpected(&WaitForExpectArgs{
+					Context: ctx,
+					RequestFunc: func() (responses.AcsResponse, error) {
+						return client.CreateInstance(createInstanceRequest)
+					},
+					EvalFunc: client.EvalCouldRetryResponse(createInstanceRetryErrors, EvalRetryErrorType),
+				})
+
+				if IsWaitForExpectCancelled(err) {
+					return "", vSwitch, err
+				}
+				if err != nil {
+					// halt会记录error，影响最终执行status code。这里只需要提示
+					ui.Say(fmt.Sprintf("Error creating instance: %s", err))
+					if spotStrategy != SpotStrategyNoSpot && !isSpotNoStockError(err) {
+						lastErr = err
+					}
+					continue
+				}
+
+				s.createdInstanceId = createInstanceResponse.(*ecs.CreateInstanceResponse).InstanceId
+				recordResource(state, journalInstance, s.createdInstanceId)
+				return instanceType, vSwitch, nil
+			}
 		}
+	}
 
-		ui.Message(fmt.Sprintf("Created instance: %s", s.createdInstanceId))
-		instance := &instances.Instances.Instance[0]
-		state.Put("instance", instance)
-		// instance_id is the generic term used so that users can have access to the
-		// instance id inside of the provisioners, used in step_provision.
-		state.Put("instance_id", s.createdInstanceId)
+	return "", vpc.VSwitch{}, fmt.Errorf("no instance available in all candidate zones")
+}
 
-		return multistep.ActionContinue
-	}
-	return halt(state, fmt.Errorf("no instance available in all candidate zones"), "Error creating instance")
+func isSpotNoStockError(err error) bool {
+	e, ok := err.(errors.Error)
+	return ok && ContainsInArray(spotNoStockErrors, e.ErrorCode())
 }
 
 func (s *stepCreateAlicloudInstance) Cleanup(state multistep.StateBag) {
 	if len(s.createdInstanceId) == 0 {
 		return
 	}
+	if keepForResume(state, "instance", s.createdInstanceId) {
+		return
+	}
 	cleanUpMessage(state, "instance")
 
 	client := state.Get("client").(*ClientWrapper)
@@ -121,16 +225,25 @@ func (s *stepCreateAlicloudInstance) Cleanup(state multistep.StateBag) {
 	}
 }
 
-func (s *stepCreateAlicloudInstance) buildCreateInstanceRequest(state multistep.StateBag, vSwitch vpc.VSwitch) (*ecs.CreateInstanceRequest, error) {
+func (s *stepCreateAlicloudInstance) buildCreateInstanceRequest(state multistep.StateBag, vSwitch vpc.VSwitch, instanceType string, spotStrategy string) (*ecs.CreateInstanceRequest, error) {
 	request := ecs.CreateCreateInstanceRequest()
 	request.ClientToken = uuid.TimeOrderedUUID()
 	request.RegionId = s.RegionId
-	request.InstanceType = s.InstanceType
+	request.InstanceType = instanceType
 	request.InstanceName = s.InstanceName
 	request.RamRoleName = s.RamRoleName
-	request.Tag = buildCreateInstanceTags(s.Tags)
+	// The tags are added to the disks created with the instance too.
+	request.Tag = buildCreateInstanceTags(temporaryResourceTags(state, s.Tags))
 	request.ZoneId = vSwitch.ZoneId
 	request.SecurityEnhancementStrategy = s.SecurityEnhancementStrategy
+	request.SpotStrategy = spotStrategy
+	if spotStrategy == SpotStrategyWithPriceLimit {
+		request.SpotPriceLimit = requests.NewFloat(s.SpotPriceLimit)
+	}
+	// 0 is sent too, as the API defaults to 1 hour when it is missing.
+	if spotStrategy != SpotStrategyNoSpot && s.SpotDuration != nil {
+		request.SpotDuration = requests.NewInteger(*s.SpotDuration)
+	}
 	if s.AlicloudImageFamily != "" {
 		request.ImageFamily = s.AlicloudImageFamily
 	} else {
@@ -180,6 +293,13 @@ func (s *stepCreateAlicloudInstance) buildCreateInstanceRequest(state multistep.
 	request.SystemDiskCategory = systemDisk.DiskCategory
 	request.SystemDiskSize = requests.Integer(convertNumber(systemDisk.DiskSize))
 	request.SystemDiskDescription = systemDisk.Description
+	// The SDK does not know the encryption of the system disk yet.
+	if systemDisk.Encrypted != confighelper.TriUnset {
+		request.QueryParams["SystemDisk.Encrypted"] = strconv.FormatBool(systemDisk.Encrypted.True())
+	}
+	if systemDisk.KMSKeyId != "" {
+		request.QueryParams["SystemDisk.KMSKeyId"] = systemDisk.KMSKeyId
+	}
 
 	imageDisks := config.AlicloudImageConfig.ECSImagesDiskMappings
 	var dataDisks []ecs.CreateInstanceDataDisk
@@ -195,6 +315,7 @@ func (s *stepCreateAlicloudInstance) buildCreateInstanceRequest(state multistep.
 		if imageDisk.Encrypted != confighelper.TriUnset {
 			dataDisk.Encrypted = strconv.FormatBool(imageDisk.Encrypted.True())
 		}
+		dataDisk.KMSKeyId = imageDisk.KMSKeyId
 
 		dataDisks = append(dataDisks, dataDisk)
 	}
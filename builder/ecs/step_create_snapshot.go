@@ -49,7 +49,7 @@ func (s *stepCreateAlicloudSnapshot) Run(ctx context.Context, state multistep.St
 	// Create the alicloud snapshot
 	ui.Say(fmt.Sprintf("Creating snapshot from system disk %s: %s", disks[0].DiskId, snapshot.SnapshotId))
 
-	snapshotsResponse, err := client.WaitForSnapshotStatus(config.AlicloudRegion, snapshot.SnapshotId, SnapshotStatusAccomplished, time.Duration(s.WaitSnapshotReadyTimeout)*time.Second)
+	snapshotsResponse, err := client.WaitForSnapshotStatus(ctx, config.AlicloudRegion, snapshot.SnapshotId, SnapshotStatusAccomplished, time.Duration(s.WaitSnapshotReadyTimeout)*time.Second)
 	if err != nil {
 		_, ok := err.(errors.Error)
 		if ok {
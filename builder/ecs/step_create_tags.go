@@ -28,35 +28,13 @@ func (s *stepCreateTags) Run(ctx context.Context, state multistep.StateBag) mult
 	}
 
 	ui.Say(fmt.Sprintf("Adding tags(%s) to image: %s", s.Tags, imageId))
-
-	var tags []ecs.AddTagsTag
-	for key, value := range s.Tags {
-		var tag ecs.AddTagsTag
-		tag.Key = key
-		tag.Value = value
-		tags = append(tags, tag)
-	}
-
-	addTagsRequest := ecs.CreateAddTagsRequest()
-	addTagsRequest.RegionId = config.AlicloudRegion
-	addTagsRequest.ResourceId = imageId
-	addTagsRequest.ResourceType = TagResourceImage
-	addTagsRequest.Tag = &tags
-
-	if _, err := client.AddTags(addTagsRequest); err != nil {
+	if err := client.AddResourceTags(config.AlicloudRegion, TagResourceImage, imageId, s.Tags); err != nil {
 		return halt(state, err, "Error Adding tags to image")
 	}
 
 	for _, snapshotId := range snapshotIds {
 		ui.Say(fmt.Sprintf("Adding tags(%s) to snapshot: %s", s.Tags, snapshotId))
-		addTagsRequest := ecs.CreateAddTagsRequest()
-
-		addTagsRequest.RegionId = config.AlicloudRegion
-		addTagsRequest.ResourceId = snapshotId
-		addTagsRequest.ResourceType = TagResourceSnapshot
-		addTagsRequest.Tag = &tags
-
-		if _, err := client.AddTags(addTagsRequest); err != nil {
+		if err := client.AddResourceTags(config.AlicloudRegion, TagResourceSnapshot, snapshotId, s.Tags); err != nil {
 			return halt(state, err, "Error Adding tags to snapshot")
 		}
 	}
@@ -66,3 +44,23 @@ func (s *stepCreateTags) Run(ctx context.Context, state multistep.StateBag) mult
 func (s *stepCreateTags) Cleanup(state multistep.StateBag) {
 	// Nothing need to do, tags will be cleaned when the resource is cleaned
 }
+
+// AddResourceTags adds the tags to the image or snapshot in the region.
+func (c *ClientWrapper) AddResourceTags(regionId string, resourceType string, resourceId string, tags map[string]string) error {
+	var addTags []ecs.AddTagsTag
+	for key, value := range tags {
+		var tag ecs.AddTagsTag
+		tag.Key = key
+		tag.Value = value
+		addTags = append(addTags, tag)
+	}
+
+	addTagsRequest := ecs.CreateAddTagsRequest()
+	addTagsRequest.RegionId = regionId
+	addTagsRequest.ResourceId = resourceId
+	addTagsRequest.ResourceType = resourceType
+	addTagsRequest.Tag = &addTags
+
+	_, err := c.AddTags(addTagsRequest)
+	return err
+}
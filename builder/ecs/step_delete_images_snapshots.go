@@ -17,8 +17,7 @@ type stepDeleteAlicloudImageSnapshots struct {
 	AlicloudImageForceDelete          bool
 	AlicloudImageForceDeleteSnapshots bool
 	AlicloudImageName                 string
-	AlicloudImageDestinationRegions   []string
-	AlicloudImageDestinationNames     []string
+	AlicloudImageCopyRegions          []AlicloudImageCopyRegion
 }
 
 func (s *stepDeleteAlicloudImageSnapshots) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
@@ -31,23 +30,14 @@ func (s *stepDeleteAlicloudImageSnapshots) Run(ctx context.Context, state multis
 			return halt(state, err, "")
 		}
 
-		numberOfName := len(s.AlicloudImageDestinationNames)
-		if numberOfName == 0 {
-			return multistep.ActionContinue
-		}
-
-		for index, destinationRegion := range s.AlicloudImageDestinationRegions {
-			if destinationRegion == config.AlicloudRegion {
+		for _, copyRegion := range s.AlicloudImageCopyRegions {
+			if copyRegion.Region == config.AlicloudRegion || copyRegion.Name == "" {
 				continue
 			}
 
-			if index < numberOfName {
-				err = s.deleteImageAndSnapshots(state, s.AlicloudImageDestinationNames[index], destinationRegion)
-				if err != nil {
-					return halt(state, err, "")
-				}
-			} else {
-				break
+			err = s.deleteImageAndSnapshots(state, copyRegion.Name, copyRegion.Region)
+			if err != nil {
+				return halt(state, err, "")
 			}
 		}
 	}
@@ -72,29 +62,19 @@ func (s *stepDeleteAlicloudImageSnapshots) deleteImageAndSnapshots(state multist
 	ui.Say(fmt.Sprintf("Deleting duplicated image and snapshot in %s: %s", region, imageName))
 
 	for _, image := range images {
+		if image.ImageId == getJournal(state).Resource(journalImage) {
+			log.Printf("Keeping the image created by a former run to resume the build: %s ", image.ImageId)
+			continue
+		}
+
 		if image.ImageOwnerAlias != ImageOwnerSelf {
 			log.Printf("You can not delete non-customized images: %s ", image.ImageId)
 			continue
 		}
 
-		deleteImageRequest := ecs.CreateDeleteImageRequest()
-		deleteImageRequest.RegionId = region
-		deleteImageRequest.ImageId = image.ImageId
-		if _, err := client.DeleteImage(deleteImageRequest); err != nil {
-			err := fmt.Errorf("Failed to delete image: %s", err)
+		if err := client.DeleteImageAndSnapshots(region, &image, s.AlicloudImageForceDeleteSnapshots); err != nil {
 			return err
 		}
-
-		if s.AlicloudImageForceDeleteSnapshots {
-			for _, diskDevice := range image.DiskDeviceMappings.DiskDeviceMapping {
-				deleteSnapshotRequest := ecs.CreateDeleteSnapshotRequest()
-				deleteSnapshotRequest.SnapshotId = diskDevice.SnapshotId
-				if _, err := client.DeleteSnapshot(deleteSnapshotRequest); err != nil {
-					err := fmt.Errorf("Deleting ECS snapshot failed: %s", err)
-					return err
-				}
-			}
-		}
 	}
 
 	return nil
@@ -102,3 +82,33 @@ func (s *stepDeleteAlicloudImageSnapshots) deleteImageAndSnapshots(state multist
 
 func (s *stepDeleteAlicloudImageSnapshots) Cleanup(state multistep.StateBag) {
 }
+
+// DeleteImageAndSnapshots deletes a customized image, and the snapshots of its
+// disks when deleteSnapshots is set.
+func (c *ClientWrapper) DeleteImageAndSnapshots(regionId string, image *ecs.Image, deleteSnapshots bool) error {
+	deleteImageRequest := ecs.CreateDeleteImageRequest()
+	deleteImageRequest.RegionId = regionId
+	deleteImageRequest.ImageId = image.ImageId
+	if _, err := c.DeleteImage(deleteImageRequest); err != nil {
+		err := fmt.Errorf("Failed to delete image: %s", err)
+		return err
+	}
+
+	if deleteSnapshots {
+		for _, diskDevice := range image.DiskDeviceMappings.DiskDeviceMapping {
+			if diskDevice.SnapshotId == "" {
+				continue
+			}
+
+			deleteSnapshotRequest := ecs.CreateDeleteSnapshotRequest()
+			deleteSnapshotRequest.RegionId = regionId
+			deleteSnapshotRequest.SnapshotId = diskDevice.SnapshotId
+			if _, err := c.DeleteSnapshot(deleteSnapshotRequest); err != nil {
+				err := fmt.Errorf("Deleting ECS snapshot failed: %s", err)
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,340 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ecs
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/vpc"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// stepDryRun checks the resources a build would use against the account,
+// with read-only calls and a DryRun instance creation, and reports what the
+// build would create. It replaces all the steps creating resources.
+type stepDryRun struct {
+	CreateInstance *stepCreateAlicloudInstance
+
+	report []string
+}
+
+// The error code returned when a DryRun request would have succeeded.
+const dryRunOperation = "DryRunOperation"
+
+func (s *stepDryRun) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+	networkType := state.Get("networktype").(InstanceNetWork)
+
+	ui.Say("Dry run, checking the resources of the build...")
+
+	var errs *packersdk.MultiError
+	if err := s.checkKeyPair(state); err != nil {
+		errs = packersdk.MultiErrorAppend(errs, err)
+	}
+
+	zones, err := s.checkZones(state)
+	if err != nil {
+		errs = packersdk.MultiErrorAppend(errs, err)
+	}
+
+	// 已存在的网络资源，为空时表示构建会创建
+	var vpcId string
+	var vSwitches []vpc.VSwitch
+	if networkType == InstanceNetworkVpc {
+		vpcId, err = s.checkVpc(state)
+		if err != nil {
+			errs = packersdk.MultiErrorAppend(errs, err)
+		}
+
+		vSwitches, err = s.checkVSwitches(state, vpcId, zones)
+		if err != nil {
+			errs = packersdk.MultiErrorAppend(errs, err)
+		}
+	} else {
+		s.reportf("Network: classic")
+	}
+
+	securityGroupId, err := s.checkSecurityGroup(state, vpcId)
+	if err != nil {
+		errs = packersdk.MultiErrorAppend(errs, err)
+	}
+
+	if errs == nil {
+		if err := s.checkInstance(state, zones, vSwitches, securityGroupId); err != nil {
+			errs = packersdk.MultiErrorAppend(errs, err)
+		}
+	}
+
+	switch {
+	case config.SSHPrivateIp:
+		s.reportf("Public IP: none, connecting through the private IP")
+	case networkType == InstanceNetworkVpc && config.AssociatePublicIpAddress:
+		s.reportf("Public IP: would allocate an EIP")
+	case networkType == InstanceNetworkClassic:
+		s.reportf("Public IP: would allocate a public IP address")
+	}
+
+	if !config.SkipCreateImage {
+		s.reportf("Image: would create %s in %s", config.AlicloudImageName, config.AlicloudRegion)
+		for _, copyRegion := range config.AlicloudImageCopyRegions {
+			if copyRegion.Region == config.AlicloudRegion {
+				continue
+			}
+			imageName := config.AlicloudImageName
+			if copyRegion.Name != "" {
+				imageName = copyRegion.Name
+			}
+			s.reportf("Image: would copy to %s as %s", copyRegion.Region, imageName)
+		}
+	}
+
+	ui.Say("Dry run report:")
+	for _, line := range s.report {
+		ui.Message(line)
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return halt(state, errs, "Dry run failed")
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepDryRun) Cleanup(multistep.StateBag) {}
+
+func (s *stepDryRun) reportf(format string, args ...interface{}) {
+	s.report = append(s.report, fmt.Sprintf(format, args...))
+}
+
+func (s *stepDryRun) checkKeyPair(state multistep.StateBag) error {
+	config := state.Get("config").(*Config)
+	client := state.Get("client").(*ClientWrapper)
+
+	switch {
+	case config.Comm.SSHPrivateKeyFile != "":
+		if _, err := config.Comm.ReadSSHPrivateKeyFile(); err != nil {
+			return err
+		}
+		s.reportf("Key pair: using the private key file %s", config.Comm.SSHPrivateKeyFile)
+	case config.Comm.SSHKeyPairName != "":
+		describeKeyPairsRequest := ecs.CreateDescribeKeyPairsRequest()
+		describeKeyPairsRequest.RegionId = config.AlicloudRegion
+		describeKeyPairsRequest.KeyPairName = config.Comm.SSHKeyPairName
+		keyPairsResponse, err := client.DescribeKeyPairs(describeKeyPairsRequest)
+		if err != nil {
+			return fmt.Errorf("Failed querying key pair: %s", err)
+		}
+		if len(keyPairsResponse.KeyPairs.KeyPair) == 0 {
+			return fmt.Errorf("The specified key pair {%s} doesn't exist.", config.Comm.SSHKeyPairName)
+		}
+		s.reportf("Key pair: %s (existing)", config.Comm.SSHKeyPairName)
+	case config.Comm.SSHTemporaryKeyPairName != "":
+		s.reportf("Key pair: would create %s", config.Comm.SSHTemporaryKeyPairName)
+	}
+
+	return nil
+}
+
+// checkZones returns the candidate zones of the instance, in the order they
+// would be tried.
+func (s *stepDryRun) checkZones(state multistep.StateBag) ([]string, error) {
+	config := state.Get("config").(*Config)
+	client := state.Get("client").(*ClientWrapper)
+
+	instanceTypes := config.candidateInstanceTypes()
+	instanceTypeZones, err := describeInstanceTypeZones(client, config.AlicloudRegion, instanceTypes)
+	if err != nil {
+		return nil, fmt.Errorf("Query for available instance zones failed: %s", err)
+	}
+	state.Put("instance_type_zones", instanceTypeZones)
+
+	var zones []string
+	for _, instanceType := range instanceTypes {
+		typeZones := instanceTypeZones[instanceType]
+		if config.ZoneId != "" {
+			if slices.Contains(typeZones, config.ZoneId) {
+				typeZones = []string{config.ZoneId}
+			} else {
+				typeZones = nil
+			}
+		}
+		if len(typeZones) == 0 {
+			s.reportf("Instance type %s: sold out", instanceType)
+			continue
+		}
+
+		s.reportf("Instance type %s: available in %s", instanceType, strings.Join(typeZones, ", "))
+		for _, zoneId := range typeZones {
+			if !slices.Contains(zones, zoneId) {
+				zones = append(zones, zoneId)
+			}
+		}
+	}
+
+	if len(zones) == 0 {
+		return nil, fmt.Errorf("实例类型 %s 没有在售可用区", strings.Join(instanceTypes, ", "))
+	}
+
+	return zones, nil
+}
+
+// checkVpc returns the ID of the existing vpc, or an empty string when the
+// build would create it.
+func (s *stepDryRun) checkVpc(state multistep.StateBag) (string, error) {
+	config := state.Get("config").(*Config)
+	client := state.Get("client").(*ClientWrapper)
+
+	if config.VpcId == "" {
+		s.reportf("%s", strings.TrimSpace("VPC: would create "+config.VpcName))
+		return "", nil
+	}
+
+	describeVpcsRequest := ecs.CreateDescribeVpcsRequest()
+	describeVpcsRequest.VpcId = config.VpcId
+	describeVpcsRequest.RegionId = config.AlicloudRegion
+	vpcsResponse, err := client.DescribeVpcs(describeVpcsRequest)
+	if err != nil {
+		return "", fmt.Errorf("Failed querying vpcs: %s", err)
+	}
+	if len(vpcsResponse.Vpcs.Vpc) == 0 {
+		return "", fmt.Errorf("The specified vpc {%s} doesn't exist.", config.VpcId)
+	}
+
+	s.reportf("VPC: %s (existing)", config.VpcId)
+	return config.VpcId, nil
+}
+
+// checkVSwitches returns the existing vswitches the instance could be created
+// in, or nothing when the build would create the vswitch.
+func (s *stepDryRun) checkVSwitches(state multistep.StateBag, vpcId string, zones []string) ([]vpc.VSwitch, error) {
+	config := state.Get("config").(*Config)
+	vpcClient := state.Get("vpcClient").(*VPCClientWrapper)
+
+	if config.VSwitchId == "" && config.VSwitchName == "" {
+		if len(zones) > 0 {
+			s.reportf("VSwitch: would create in %s", zones[0])
+		}
+		return nil, nil
+	}
+	if config.VSwitchId == "" && vpcId == "" {
+		return nil, fmt.Errorf("the specified vswitch {%s} can't be in the vpc created by the build", config.VSwitchName)
+	}
+
+	describeVSwitchesRequest := vpc.CreateDescribeVSwitchesRequest()
+	describeVSwitchesRequest.VpcId = vpcId
+	describeVSwitchesRequest.VSwitchId = config.VSwitchId
+	describeVSwitchesRequest.VSwitchName = config.VSwitchName
+	vSwitchesResponse, err := vpcClient.DescribeVSwitches(describeVSwitchesRequest)
+	if err != nil {
+		return nil, fmt.Errorf("Failed querying vswitch: %s", err)
+	}
+
+	var vSwitches []vpc.VSwitch
+	for _, vSwitch := range vSwitchesResponse.VSwitches.VSwitch {
+		if !slices.Contains(zones, vSwitch.ZoneId) {
+			s.reportf("VSwitch: %s in %s (existing, no instance type available)", vSwitch.VSwitchId, vSwitch.ZoneId)
+			continue
+		}
+		s.reportf("VSwitch: %s in %s (existing)", vSwitch.VSwitchId, vSwitch.ZoneId)
+		vSwitches = append(vSwitches, vSwitch)
+	}
+
+	vSwitchName := config.VSwitchId
+	if vSwitchName == "" {
+		vSwitchName = config.VSwitchName
+	}
+	if len(vSwitchesResponse.VSwitches.VSwitch) == 0 {
+		if vpcId != "" {
+			return nil, fmt.Errorf("the specified vswitch {%s} doesn't exist in vpc {%s}", vSwitchName, vpcId)
+		}
+		return nil, fmt.Errorf("the specified vswitch {%s} doesn't exist", vSwitchName)
+	}
+	if len(vSwitches) == 0 {
+		return nil, fmt.Errorf("no candidate instance type is available in the zone of the vswitch {%s}", vSwitchName)
+	}
+
+	return vSwitches, nil
+}
+
+// checkSecurityGroup returns the ID of the existing security group, or an
+// empty string when the build would create it.
+func (s *stepDryRun) checkSecurityGroup(state multistep.StateBag, vpcId string) (string, error) {
+	config := state.Get("config").(*Config)
+	client := state.Get("client").(*ClientWrapper)
+
+	if config.SecurityGroupId == "" {
+		s.reportf("%s", strings.TrimSpace("Security group: would create "+config.SecurityGroupName))
+		return "", nil
+	}
+
+	describeSecurityGroupsRequest := ecs.CreateDescribeSecurityGroupsRequest()
+	describeSecurityGroupsRequest.RegionId = config.AlicloudRegion
+	describeSecurityGroupsRequest.SecurityGroupId = config.SecurityGroupId
+	describeSecurityGroupsRequest.VpcId = vpcId
+	securityGroupsResponse, err := client.DescribeSecurityGroups(describeSecurityGroupsRequest)
+	if err != nil {
+		return "", fmt.Errorf("Failed querying security group: %s", err)
+	}
+
+	for _, securityGroup := range securityGroupsResponse.SecurityGroups.SecurityGroup {
+		if securityGroup.SecurityGroupId == config.SecurityGroupId {
+			s.reportf("Security group: %s (existing)", config.SecurityGroupId)
+			return config.SecurityGroupId, nil
+		}
+	}
+
+	if vpcId != "" {
+		return "", fmt.Errorf("The specified security group {%s} doesn't exist in vpc {%s}.", config.SecurityGroupId, vpcId)
+	}
+	return "", fmt.Errorf("The specified security group {%s} doesn't exist.", config.SecurityGroupId)
+}
+
+// checkInstance dry-runs the creation of the instance in the first candidate
+// zone, when its network already exists.
+func (s *stepDryRun) checkInstance(state multistep.StateBag, zones []string, vSwitches []vpc.VSwitch, securityGroupId string) error {
+	client := state.Get("client").(*ClientWrapper)
+	networkType := state.Get("networktype").(InstanceNetWork)
+	instanceTypeZones := state.Get("instance_type_zones").(map[string][]string)
+
+	if securityGroupId == "" || (networkType == InstanceNetworkVpc && len(vSwitches) == 0) {
+		s.reportf("Instance: would create in %s, not dry-run as its network would be created by the build", zones[0])
+		return nil
+	}
+
+	vSwitch := vpc.VSwitch{ZoneId: zones[0]}
+	if len(vSwitches) > 0 {
+		vSwitch = vSwitches[0]
+	}
+
+	instanceType := s.CreateInstance.InstanceTypes[0]
+	for _, candidate := range s.CreateInstance.InstanceTypes {
+		if slices.Contains(instanceTypeZones[candidate], vSwitch.ZoneId) {
+			instanceType = candidate
+			break
+		}
+	}
+
+	state.Put("securitygroupid", securityGroupId)
+	createInstanceRequest, err := s.CreateInstance.buildCreateInstanceRequest(state, vSwitch, instanceType, s.CreateInstance.SpotStrategy)
+	if err != nil {
+		return err
+	}
+	createInstanceRequest.DryRun = requests.NewBoolean(true)
+
+	_, err = client.CreateInstance(createInstanceRequest)
+	if e, ok := err.(errors.Error); ok && e.ErrorCode() == dryRunOperation {
+		s.reportf("Instance: would create %s in %s", instanceType, vSwitch.ZoneId)
+		return nil
+	}
+
+	return fmt.Errorf("Dry run of creating instance %s in %s failed: %v", instanceType, vSwitch.ZoneId, err)
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/kms"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
@@ -24,6 +25,10 @@ func (s *stepPreValidate) Run(ctx context.Context, state multistep.StateBag) mul
 		return halt(state, err, "")
 	}
 
+	if err := s.validateKMSKeys(state); err != nil {
+		return halt(state, err, "")
+	}
+
 	if err := s.validateDestImageName(state); err != nil {
 		return halt(state, err, "")
 	}
@@ -46,8 +51,8 @@ func (s *stepPreValidate) validateRegions(state multistep.StateBag) error {
 	if err := config.ValidateRegion(config.AlicloudRegion); err != nil {
 		errs = packersdk.MultiErrorAppend(errs, err)
 	}
-	for _, region := range config.AlicloudImageDestinationRegions {
-		if err := config.ValidateRegion(region); err != nil {
+	for _, copyRegion := range config.AlicloudImageCopyRegions {
+		if err := config.ValidateRegion(copyRegion.Region); err != nil {
 			errs = packersdk.MultiErrorAppend(errs, err)
 		}
 	}
@@ -59,6 +64,69 @@ func (s *stepPreValidate) validateRegions(state multistep.StateBag) error {
 	return nil
 }
 
+// validateKMSKeys checks that the KMS keys encrypting the disks, the image
+// and its copies exist and are enabled in their regions.
+func (s *stepPreValidate) validateKMSKeys(state multistep.StateBag) error {
+	ui := state.Get("ui").(packersdk.Ui)
+	config := state.Get("config").(*Config)
+
+	type regionKey struct {
+		regionId string
+		keyId    string
+	}
+	var keys []regionKey
+	seen := make(map[regionKey]bool)
+	addKey := func(regionId string, keyId string) {
+		key := regionKey{regionId, keyId}
+		if keyId != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	addKey(config.AlicloudRegion, config.ECSSystemDiskMapping.KMSKeyId)
+	for _, imageDisk := range config.ECSImagesDiskMappings {
+		addKey(config.AlicloudRegion, imageDisk.KMSKeyId)
+	}
+	addKey(config.AlicloudRegion, config.ImageKMSKeyId)
+	for _, copyRegion := range config.AlicloudImageCopyRegions {
+		addKey(copyRegion.Region, copyRegion.KMSKeyId)
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	ui.Say("Prevalidating KMS keys...")
+
+	client, err := config.KMSClient()
+	if err != nil {
+		return fmt.Errorf("Error creating KMS client: %s", err)
+	}
+
+	var errs *packersdk.MultiError
+	for _, key := range keys {
+		request := kms.CreateDescribeKeyRequest()
+		request.RegionId = key.regionId
+		request.KeyId = key.keyId
+
+		response, err := client.DescribeKey(request)
+		if err != nil {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("Error querying KMS key %s in %s: %s", key.keyId, key.regionId, err))
+			continue
+		}
+		if response.KeyMetadata.KeyState != KMSKeyStateEnabled {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("KMS key %s in %s is %s, expected %s", key.keyId, key.regionId, response.KeyMetadata.KeyState, KMSKeyStateEnabled))
+		}
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
 func (s *stepPreValidate) validateDestImageName(state multistep.StateBag) error {
 	ui := state.Get("ui").(packersdk.Ui)
 	client := state.Get("client").(*ClientWrapper)
@@ -81,9 +149,12 @@ func (s *stepPreValidate) validateDestImageName(state multistep.StateBag) error
 		return fmt.Errorf("Error querying alicloud image: %s", err)
 	}
 
-	images := imagesResponse.Images.Image
-	if len(images) > 0 {
-		return ImageExistsError
+	// 恢复构建时，上次运行创建的镜像不算重名
+	journaledImageId := getJournal(state).Resource(journalImage)
+	for _, image := range imagesResponse.Images.Image {
+		if image.ImageId != journaledImageId {
+			return ImageExistsError
+		}
 	}
 
 	return nil
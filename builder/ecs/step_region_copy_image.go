@@ -5,10 +5,13 @@ package ecs
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
@@ -16,68 +19,255 @@ import (
 )
 
 type stepRegionCopyAlicloudImage struct {
-	AlicloudImageDestinationRegions []string
-	AlicloudImageDestinationNames   []string
-	RegionId                        string
-	WaitCopyingImageReadyTimeout    int
+	AlicloudImageCopyRegions     []AlicloudImageCopyRegion
+	RegionId                     string
+	WaitCopyingImageReadyTimeout int
+	WaitForCopiedImages          bool
+	Concurrency                  int
+	// SharedImage is set when the image is shared by another account, so
+	// that it is copied to its own region too.
+	SharedImage bool
+
+	// The SDK client is not safe for concurrent use, the requests of the
+	// copies are sent one at a time.
+	requestLock sync.Mutex
 }
 
 func (s *stepRegionCopyAlicloudImage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	config := state.Get("config").(*Config)
 
+	var copyRegions []AlicloudImageCopyRegion
 	if config.ImageEncrypted != confighelper.TriUnset {
-		s.AlicloudImageDestinationRegions = append(s.AlicloudImageDestinationRegions, s.RegionId)
-		s.AlicloudImageDestinationNames = append(s.AlicloudImageDestinationNames, config.AlicloudImageName)
+		copyRegions = append(copyRegions, AlicloudImageCopyRegion{
+			Region:      s.RegionId,
+			Name:        config.AlicloudImageName,
+			Description: config.AlicloudImageDescription,
+			Encrypted:   config.ImageEncrypted,
+			KMSKeyId:    config.ImageKMSKeyId,
+		})
+	}
+	for _, copyRegion := range s.AlicloudImageCopyRegions {
+		if copyRegion.Region != s.RegionId || s.SharedImage {
+			copyRegions = append(copyRegions, copyRegion)
+		}
 	}
 
-	if len(s.AlicloudImageDestinationRegions) == 0 {
+	if len(copyRegions) == 0 {
 		return multistep.ActionContinue
 	}
 
-	client := state.Get("client").(*ClientWrapper)
 	ui := state.Get("ui").(packersdk.Ui)
-
 	srcImageId := state.Get("alicloudimage").(string)
 	alicloudImages := state.Get("alicloudimages").(map[string]string)
-	numberOfName := len(s.AlicloudImageDestinationNames)
+
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultImageCopyConcurrency
+	}
 
 	ui.Say(fmt.Sprintf("Coping image %s from %s...", srcImageId, s.RegionId))
-	for index, destinationRegion := range s.AlicloudImageDestinationRegions {
-		if destinationRegion == s.RegionId && config.ImageEncrypted == confighelper.TriUnset {
-			continue
+
+	// 任一地域复制失败时取消其他地域的等待
+	copyCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, concurrency)
+	copyErrs := make([]error, len(copyRegions))
+	for index, copyRegion := range copyRegions {
+		wg.Add(1)
+		go func(index int, copyRegion AlicloudImageCopyRegion) {
+			defer wg.Done()
+
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-copyCtx.Done():
+				copyErrs[index] = copyCtx.Err()
+				return
+			}
+
+			copyErrs[index] = s.copyImage(copyCtx, state, srcImageId, copyRegion, func(imageId string) {
+				lock.Lock()
+				defer lock.Unlock()
+				alicloudImages[copyRegion.Region] = imageId
+			})
+			if copyErrs[index] != nil {
+				cancel()
+			}
+		}(index, copyRegion)
+	}
+	wg.Wait()
+
+	var errs *packersdk.MultiError
+	for index, copyRegion := range copyRegions {
+		err := copyErrs[index]
+		switch {
+		case err == nil:
+			ui.Message(fmt.Sprintf("Copied image to %s: %s", copyRegion.Region, alicloudImages[copyRegion.Region]))
+		case ctx.Err() == nil && errors.Is(err, context.Canceled):
+			ui.Message(fmt.Sprintf("Stopped copying image to %s because another copy failed", copyRegion.Region))
+		default:
+			ui.Error(fmt.Sprintf("Failed copying image to %s: %s", copyRegion.Region, err))
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("%s: %s", copyRegion.Region, err))
 		}
+	}
+	if errs != nil && len(errs.Errors) > 0 {
+		return halt(state, errs, "Error copying images")
+	}
+
+	return multistep.ActionContinue
+}
+
+// copyImage copies the image to the region, tags the copy once it appears
+// there, and waits for the copy to complete when needed. imageCopied is
+// called with the ID of the copy as soon as the copy starts.
+func (s *stepRegionCopyAlicloudImage) copyImage(ctx context.Context, state multistep.StateBag, srcImageId string, copyRegion AlicloudImageCopyRegion, imageCopied func(string)) error {
+	config := state.Get("config").(*Config)
+	client := state.Get("client").(*ClientWrapper)
+	ui := state.Get("ui").(packersdk.Ui)
 
-		ecsImageName := ""
-		if numberOfName > 0 && index < numberOfName {
-			ecsImageName = s.AlicloudImageDestinationNames[index]
+	copyImageRequest := ecs.CreateCopyImageRequest()
+	copyImageRequest.RegionId = s.RegionId
+	copyImageRequest.ImageId = srcImageId
+	copyImageRequest.DestinationRegionId = copyRegion.Region
+	copyImageRequest.DestinationImageName = copyRegion.Name
+	copyImageRequest.DestinationDescription = copyRegion.Description
+	copyImageRequest.ResourceGroupId = config.AlicloudResourceGroupId
+	if encrypted := copyRegion.encrypted(config.ImageEncrypted); encrypted != confighelper.TriUnset {
+		copyImageRequest.Encrypted = requests.NewBoolean(encrypted.True())
+	}
+	copyImageRequest.KMSKeyId = copyRegion.KMSKeyId
+
+	var imageResponse *ecs.CopyImageResponse
+	err := s.request(func() (err error) {
+		imageResponse, err = client.CopyImage(copyImageRequest)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	imageId := imageResponse.ImageId
+	imageCopied(imageId)
+	ui.Message(fmt.Sprintf("Copy image from %s(%s) to %s(%s)", s.RegionId, srcImageId, copyRegion.Region, imageId))
+
+	timeout := time.Duration(s.WaitCopyingImageReadyTimeout) * time.Second
+
+	// CopyImage 不复制标签，副本在目标地域出现后即打上标签
+	tags := config.regionImageTags(copyRegion.Region)
+	if len(tags) > 0 {
+		if _, err := s.waitForCopiedImage(ctx, client, ui, copyRegion.Region, imageId, timeout, false); err != nil {
+			return err
+		}
+		ui.Message(fmt.Sprintf("Adding tags(%s) to image %s in %s", tags, imageId, copyRegion.Region))
+		if err := s.request(func() error {
+			return client.AddResourceTags(copyRegion.Region, TagResourceImage, imageId, tags)
+		}); err != nil {
+			return fmt.Errorf("Error adding tags to copied image: %s", err)
 		}
+	}
+
+	// 快照、镜像族系和特性在副本创建完成后设置；加密的副本取代源镜像，须等待其完成
+	modifyImageAttributeRequest := buildModifyImageAttributeRequest(config, copyRegion.Region, imageId, true)
+	if !s.WaitForCopiedImages && copyRegion.Region != s.RegionId && len(tags) == 0 && modifyImageAttributeRequest == nil {
+		return nil
+	}
 
-		copyImageRequest := ecs.CreateCopyImageRequest()
-		copyImageRequest.RegionId = s.RegionId
-		copyImageRequest.ImageId = srcImageId
-		copyImageRequest.DestinationRegionId = destinationRegion
-		copyImageRequest.DestinationImageName = ecsImageName
-		copyImageRequest.ResourceGroupId = config.AlicloudResourceGroupId
-		if config.ImageEncrypted != confighelper.TriUnset {
-			copyImageRequest.Encrypted = requests.NewBoolean(config.ImageEncrypted.True())
+	image, err := s.waitForCopiedImage(ctx, client, ui, copyRegion.Region, imageId, timeout, true)
+	if err != nil {
+		return err
+	}
+
+	if len(tags) > 0 {
+		for _, device := range image.DiskDeviceMappings.DiskDeviceMapping {
+			if device.SnapshotId == "" {
+				continue
+			}
+			ui.Message(fmt.Sprintf("Adding tags(%s) to snapshot %s in %s", tags, device.SnapshotId, copyRegion.Region))
+			if err := s.request(func() error {
+				return client.AddResourceTags(copyRegion.Region, TagResourceSnapshot, device.SnapshotId, tags)
+			}); err != nil {
+				return fmt.Errorf("Error adding tags to snapshot of copied image: %s", err)
+			}
 		}
+	}
 
-		imageResponse, err := client.CopyImage(copyImageRequest)
-		if err != nil {
-			return halt(state, err, "Error copying images")
+	if modifyImageAttributeRequest != nil {
+		if err := s.request(func() error {
+			_, err := client.ModifyImageAttribute(modifyImageAttributeRequest)
+			return err
+		}); err != nil {
+			return fmt.Errorf("Error setting the family and features of copied image: %s", err)
 		}
+	}
+
+	return nil
+}
+
+// waitForCopiedImage waits for the copy of the image to appear in the region
+// or, when available is set, to be available, reporting its progress. It
+// fails as soon as the copy fails.
+func (s *stepRegionCopyAlicloudImage) waitForCopiedImage(ctx context.Context, client *ClientWrapper, ui packersdk.Ui, regionId string, imageId string, timeout time.Duration, available bool) (*ecs.Image, error) {
+	progress := ""
+	response, err := client.WaitForExpected(&WaitForExpectArgs{
+		Context: ctx,
+		RequestFunc: func() (responses.AcsResponse, error) {
+			request := ecs.CreateDescribeImagesRequest()
+			request.RegionId = regionId
+			request.ImageId = imageId
+			request.Status = ImageStatusQueried
+
+			var response responses.AcsResponse
+			err := s.request(func() (err error) {
+				response, err = client.DescribeImages(request)
+				return err
+			})
+			return response, err
+		},
+		EvalFunc: func(response responses.AcsResponse, err error) WaitForExpectEvalResult {
+			if err != nil {
+				return WaitForExpectToRetry
+			}
+
+			images := response.(*ecs.DescribeImagesResponse).Images.Image
+			if len(images) == 0 {
+				return WaitForExpectToRetry
+			}
 
-		alicloudImages[destinationRegion] = imageResponse.ImageId
-		ui.Message(fmt.Sprintf("Copy image from %s(%s) to %s(%s)", s.RegionId, srcImageId, destinationRegion, imageResponse.ImageId))
+			switch {
+			case images[0].Status == ImageStatusCreateFailed:
+				return WaitForExpectFailToStop
+			case images[0].Status == ImageStatusAvailable || !available:
+				return WaitForExpectSuccess
+			}
+
+			if images[0].Progress != progress {
+				progress = images[0].Progress
+				ui.Message(fmt.Sprintf("Copying image %s to %s: %s", imageId, regionId, progress))
+			}
+			return WaitForExpectToRetry
+		},
+		Backoff:      statusBackoff,
+		RetryTimeout: timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Timeout waiting image %s finish copying: %w", imageId, err)
 	}
 
-	if config.ImageEncrypted != confighelper.TriUnset {
-		if _, err := client.WaitForImageStatus(s.RegionId, alicloudImages[s.RegionId], ImageStatusAvailable, time.Duration(s.WaitCopyingImageReadyTimeout)*time.Second); err != nil {
-			return halt(state, err, fmt.Sprintf("Timeout waiting image %s finish copying", alicloudImages[s.RegionId]))
-		}
+	image := response.(*ecs.DescribeImagesResponse).Images.Image[0]
+	if image.Status == ImageStatusCreateFailed {
+		return nil, fmt.Errorf("Image %s failed to copy with status %s", imageId, image.Status)
 	}
+	return &image, nil
+}
 
-	return multistep.ActionContinue
+// request sends a request of a copy once the former ones are done.
+func (s *stepRegionCopyAlicloudImage) request(send func() error) error {
+	s.requestLock.Lock()
+	defer s.requestLock.Unlock()
+	return send()
 }
 
 func (s *stepRegionCopyAlicloudImage) Cleanup(state multistep.StateBag) {
@@ -21,6 +21,24 @@ func (s *stepRunAlicloudInstance) Run(ctx context.Context, state multistep.State
 	ui := state.Get("ui").(packersdk.Ui)
 	instance := state.Get("instance").(*ecs.Instance)
 
+	// 续建时实例可能仍在运行或正在停止
+	switch instance.Status {
+	case InstanceStatusRunning:
+		ui.Say(fmt.Sprintf("Instance %s is already running", instance.InstanceId))
+		return multistep.ActionContinue
+	case InstanceStatusStarting:
+		ui.Say(fmt.Sprintf("Waiting for instance %s to start...", instance.InstanceId))
+		if _, err := client.WaitForInstanceStatus(ctx, instance.RegionId, instance.InstanceId, InstanceStatusRunning); err != nil {
+			return halt(state, err, "Timeout waiting for instance to start")
+		}
+		return multistep.ActionContinue
+	case InstanceStatusStopping:
+		ui.Say(fmt.Sprintf("Waiting for instance %s to stop before starting it...", instance.InstanceId))
+		if _, err := client.WaitForInstanceStatus(ctx, instance.RegionId, instance.InstanceId, InstanceStatusStopped); err != nil {
+			return halt(state, err, "Timeout waiting for instance to stop")
+		}
+	}
+
 	startInstanceRequest := ecs.CreateStartInstanceRequest()
 	startInstanceRequest.InstanceId = instance.InstanceId
 	if _, err := client.StartInstance(startInstanceRequest); err != nil {
@@ -29,7 +47,7 @@ func (s *stepRunAlicloudInstance) Run(ctx context.Context, state multistep.State
 
 	ui.Say(fmt.Sprintf("Starting instance: %s", instance.InstanceId))
 
-	_, err := client.WaitForInstanceStatus(instance.RegionId, instance.InstanceId, InstanceStatusRunning)
+	_, err := client.WaitForInstanceStatus(ctx, instance.RegionId, instance.InstanceId, InstanceStatusRunning)
 	if err != nil {
 		return halt(state, err, "Timeout waiting for instance to start")
 	}
@@ -67,7 +85,7 @@ func (s *stepRunAlicloudInstance) Cleanup(state multistep.StateBag) {
 			return
 		}
 
-		_, err := client.WaitForInstanceStatus(instance.RegionId, instance.InstanceId, InstanceStatusStopped)
+		_, err := client.WaitForInstanceStatus(context.Background(), instance.RegionId, instance.InstanceId, InstanceStatusStopped)
 		if err != nil {
 			ui.Say(fmt.Sprintf("Error stopping instance %s, it may still be around %s", instance.InstanceId, err))
 		}
@@ -25,7 +25,20 @@ func (s *stepStopAlicloudInstance) Run(ctx context.Context, state multistep.Stat
 	instance := state.Get("instance").(*ecs.Instance)
 	ui := state.Get("ui").(packersdk.Ui)
 
-	if !s.DisableStop {
+	// 恢复构建时，实例可能已经被上次运行停止
+	stopped := false
+	if getJournal(state) != nil {
+		describeInstancesRequest := ecs.CreateDescribeInstancesRequest()
+		describeInstancesRequest.InstanceIds = fmt.Sprintf("[\"%s\"]", instance.InstanceId)
+		instancesResponse, err := client.DescribeInstances(describeInstancesRequest)
+		if err != nil {
+			return halt(state, err, "Error querying alicloud instance")
+		}
+		instances := instancesResponse.Instances.Instance
+		stopped = len(instances) > 0 && instances[0].Status == InstanceStatusStopped
+	}
+
+	if !s.DisableStop && !stopped {
 		ui.Say(fmt.Sprintf("Stopping instance: %s", instance.InstanceId))
 
 		stopInstanceRequest := ecs.CreateStopInstanceRequest()
@@ -38,7 +51,7 @@ func (s *stepStopAlicloudInstance) Run(ctx context.Context, state multistep.Stat
 
 	ui.Say(fmt.Sprintf("Waiting instance stopped: %s", instance.InstanceId))
 
-	_, err := client.WaitForInstanceStatus(instance.RegionId, instance.InstanceId, InstanceStatusStopped)
+	_, err := client.WaitForInstanceStatus(ctx, instance.RegionId, instance.InstanceId, InstanceStatusStopped)
 	if err != nil {
 		return halt(state, err, "Error waiting for alicloud instance to stop")
 	}
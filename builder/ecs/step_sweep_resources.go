@@ -0,0 +1,418 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package ecs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/vpc"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// The kinds of the resources swept, in the order they are deleted: a
+// resource is always deleted before the ones it depends on.
+const (
+	sweepEip           = "eip"
+	sweepInstance      = "instance"
+	sweepKeyPair       = "key pair"
+	sweepSecurityGroup = "security group"
+	sweepVSwitch       = "vswitch"
+	sweepVpc           = "vpc"
+)
+
+// The number of resources requested per page when listing them.
+const sweepPageSize = 50
+
+// orphanedResource is a resource carrying the ownership tag of a build.
+type orphanedResource struct {
+	Kind         string
+	Id           string
+	CreationTime time.Time
+	// InstanceId is the instance an eip is associated with, if any.
+	InstanceId string
+}
+
+// stepSweepResources deletes the temporary resources left behind by
+// interrupted builds in the region: the ones carrying BuildOwnershipTagKey
+// and created more than OlderThan ago. With DryRun, it only reports them.
+type stepSweepResources struct {
+	OlderThan time.Duration
+	DryRun    bool
+}
+
+func (s *stepSweepResources) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+
+	ui.Say(fmt.Sprintf("Sweeping the build resources older than %s in %s...", s.OlderThan, config.AlicloudRegion))
+
+	listers := []func(state multistep.StateBag) ([]orphanedResource, error){
+		s.listEips,
+		s.listInstances,
+		s.listKeyPairs,
+		s.listSecurityGroups,
+		s.listVSwitches,
+		s.listVpcs,
+	}
+
+	deadline := time.Now().Add(-s.OlderThan)
+	var report []string
+	var errs *packersdk.MultiError
+	for _, list := range listers {
+		resources, err := list(state)
+		if err != nil {
+			errs = packersdk.MultiErrorAppend(errs, err)
+			continue
+		}
+
+		for _, resource := range resources {
+			if resource.CreationTime.After(deadline) {
+				continue
+			}
+
+			created := resource.CreationTime.Format(time.RFC3339)
+			if s.DryRun {
+				report = append(report, fmt.Sprintf("%s %s, created %s: would delete", resource.Kind, resource.Id, created))
+				continue
+			}
+
+			ui.Message(fmt.Sprintf("Deleting %s %s...", resource.Kind, resource.Id))
+			if err := s.deleteResource(ctx, state, resource); err != nil {
+				errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("Failed to delete %s %s: %s", resource.Kind, resource.Id, err))
+				report = append(report, fmt.Sprintf("%s %s, created %s: failed, %s", resource.Kind, resource.Id, created, err))
+				continue
+			}
+			report = append(report, fmt.Sprintf("%s %s, created %s: deleted", resource.Kind, resource.Id, created))
+		}
+	}
+
+	ui.Say("Sweep report:")
+	if len(report) == 0 {
+		ui.Message("No orphaned build resource found")
+	}
+	for _, line := range report {
+		ui.Message(line)
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return halt(state, errs, "Sweep failed")
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepSweepResources) Cleanup(multistep.StateBag) {}
+
+func (s *stepSweepResources) listEips(state multistep.StateBag) ([]orphanedResource, error) {
+	config := state.Get("config").(*Config)
+	vpcClient := state.Get("vpcClient").(*VPCClientWrapper)
+
+	var resources []orphanedResource
+	for page := 1; ; page++ {
+		request := vpc.CreateDescribeEipAddressesRequest()
+		request.RegionId = config.AlicloudRegion
+		request.Tag = &[]vpc.DescribeEipAddressesTag{{Key: BuildOwnershipTagKey}}
+		request.PageNumber = requests.NewInteger(page)
+		request.PageSize = requests.NewInteger(sweepPageSize)
+		response, err := vpcClient.DescribeEipAddresses(request)
+		if err != nil {
+			return nil, fmt.Errorf("Failed querying eips: %s", err)
+		}
+
+		for _, eip := range response.EipAddresses.EipAddress {
+			resource, err := newOrphanedResource(sweepEip, eip.AllocationId, eip.AllocationTime)
+			if err != nil {
+				return nil, err
+			}
+			resource.InstanceId = eip.InstanceId
+			resources = append(resources, resource)
+		}
+
+		if len(response.EipAddresses.EipAddress) == 0 || page*sweepPageSize >= response.TotalCount {
+			return resources, nil
+		}
+	}
+}
+
+func (s *stepSweepResources) listInstances(state multistep.StateBag) ([]orphanedResource, error) {
+	config := state.Get("config").(*Config)
+	client := state.Get("client").(*ClientWrapper)
+
+	var resources []orphanedResource
+	for page := 1; ; page++ {
+		request := ecs.CreateDescribeInstancesRequest()
+		request.RegionId = config.AlicloudRegion
+		request.Tag = &[]ecs.DescribeInstancesTag{{Key: BuildOwnershipTagKey}}
+		request.PageNumber = requests.NewInteger(page)
+		request.PageSize = requests.NewInteger(sweepPageSize)
+		response, err := client.DescribeInstances(request)
+		if err != nil {
+			return nil, fmt.Errorf("Failed querying instances: %s", err)
+		}
+
+		for _, instance := range response.Instances.Instance {
+			resource, err := newOrphanedResource(sweepInstance, instance.InstanceId, instance.CreationTime)
+			if err != nil {
+				return nil, err
+			}
+			resources = append(resources, resource)
+		}
+
+		if len(response.Instances.Instance) == 0 || page*sweepPageSize >= response.TotalCount {
+			return resources, nil
+		}
+	}
+}
+
+func (s *stepSweepResources) listKeyPairs(state multistep.StateBag) ([]orphanedResource, error) {
+	config := state.Get("config").(*Config)
+	client := state.Get("client").(*ClientWrapper)
+
+	var resources []orphanedResource
+	for page := 1; ; page++ {
+		request := ecs.CreateDescribeKeyPairsRequest()
+		request.RegionId = config.AlicloudRegion
+		request.Tag = &[]ecs.DescribeKeyPairsTag{{Key: BuildOwnershipTagKey}}
+		request.PageNumber = requests.NewInteger(page)
+		request.PageSize = requests.NewInteger(sweepPageSize)
+		response, err := client.DescribeKeyPairs(request)
+		if err != nil {
+			return nil, fmt.Errorf("Failed querying key pairs: %s", err)
+		}
+
+		for _, keyPair := range response.KeyPairs.KeyPair {
+			resource, err := newOrphanedResource(sweepKeyPair, keyPair.KeyPairName, keyPair.CreationTime)
+			if err != nil {
+				return nil, err
+			}
+			resources = append(resources, resource)
+		}
+
+		if len(response.KeyPairs.KeyPair) == 0 || page*sweepPageSize >= response.TotalCount {
+			return resources, nil
+		}
+	}
+}
+
+func (s *stepSweepResources) listSecurityGroups(state multistep.StateBag) ([]orphanedResource, error) {
+	config := state.Get("config").(*Config)
+	client := state.Get("client").(*ClientWrapper)
+
+	var resources []orphanedResource
+	for page := 1; ; page++ {
+		request := ecs.CreateDescribeSecurityGroupsRequest()
+		request.RegionId = config.AlicloudRegion
+		request.Tag = &[]ecs.DescribeSecurityGroupsTag{{Key: BuildOwnershipTagKey}}
+		request.PageNumber = requests.NewInteger(page)
+		request.PageSize = requests.NewInteger(sweepPageSize)
+		response, err := client.DescribeSecurityGroups(request)
+		if err != nil {
+			return nil, fmt.Errorf("Failed querying security groups: %s", err)
+		}
+
+		for _, securityGroup := range response.SecurityGroups.SecurityGroup {
+			resource, err := newOrphanedResource(sweepSecurityGroup, securityGroup.SecurityGroupId, securityGroup.CreationTime)
+			if err != nil {
+				return nil, err
+			}
+			resources = append(resources, resource)
+		}
+
+		if len(response.SecurityGroups.SecurityGroup) == 0 || page*sweepPageSize >= response.TotalCount {
+			return resources, nil
+		}
+	}
+}
+
+func (s *stepSweepResources) listVSwitches(state multistep.StateBag) ([]orphanedResource, error) {
+	config := state.Get("config").(*Config)
+	vpcClient := state.Get("vpcClient").(*VPCClientWrapper)
+
+	var resources []orphanedResource
+	for page := 1; ; page++ {
+		request := vpc.CreateDescribeVSwitchesRequest()
+		request.RegionId = config.AlicloudRegion
+		request.Tag = &[]vpc.DescribeVSwitchesTag{{Key: BuildOwnershipTagKey}}
+		request.PageNumber = requests.NewInteger(page)
+		request.PageSize = requests.NewInteger(sweepPageSize)
+		response, err := vpcClient.DescribeVSwitches(request)
+		if err != nil {
+			return nil, fmt.Errorf("Failed querying vswitches: %s", err)
+		}
+
+		for _, vSwitch := range response.VSwitches.VSwitch {
+			resource, err := newOrphanedResource(sweepVSwitch, vSwitch.VSwitchId, vSwitch.CreationTime)
+			if err != nil {
+				return nil, err
+			}
+			resources = append(resources, resource)
+		}
+
+		if len(response.VSwitches.VSwitch) == 0 || page*sweepPageSize >= response.TotalCount {
+			return resources, nil
+		}
+	}
+}
+
+func (s *stepSweepResources) listVpcs(state multistep.StateBag) ([]orphanedResource, error) {
+	config := state.Get("config").(*Config)
+	vpcClient := state.Get("vpcClient").(*VPCClientWrapper)
+
+	var resources []orphanedResource
+	for page := 1; ; page++ {
+		request := vpc.CreateDescribeVpcsRequest()
+		request.RegionId = config.AlicloudRegion
+		request.Tag = &[]vpc.DescribeVpcsTag{{Key: BuildOwnershipTagKey}}
+		request.PageNumber = requests.NewInteger(page)
+		request.PageSize = requests.NewInteger(sweepPageSize)
+		response, err := vpcClient.DescribeVpcs(request)
+		if err != nil {
+			return nil, fmt.Errorf("Failed querying vpcs: %s", err)
+		}
+
+		for _, v := range response.Vpcs.Vpc {
+			resource, err := newOrphanedResource(sweepVpc, v.VpcId, v.CreationTime)
+			if err != nil {
+				return nil, err
+			}
+			resources = append(resources, resource)
+		}
+
+		if len(response.Vpcs.Vpc) == 0 || page*sweepPageSize >= response.TotalCount {
+			return resources, nil
+		}
+	}
+}
+
+func (s *stepSweepResources) deleteResource(ctx context.Context, state multistep.StateBag, resource orphanedResource) error {
+	config := state.Get("config").(*Config)
+	client := state.Get("client").(*ClientWrapper)
+
+	var requestFunc func() (responses.AcsResponse, error)
+	var retryErrors []string
+	switch resource.Kind {
+	case sweepEip:
+		return s.releaseEip(ctx, state, resource)
+	case sweepInstance:
+		requestFunc = func() (responses.AcsResponse, error) {
+			request := ecs.CreateDeleteInstanceRequest()
+			request.InstanceId = resource.Id
+			request.Force = requests.NewBoolean(true)
+			return client.DeleteInstance(request)
+		}
+		retryErrors = deleteInstanceRetryErrors
+	case sweepKeyPair:
+		request := ecs.CreateDeleteKeyPairsRequest()
+		request.RegionId = config.AlicloudRegion
+		request.KeyPairNames = fmt.Sprintf("[\"%s\"]", resource.Id)
+		_, err := client.DeleteKeyPairs(request)
+		return err
+	case sweepSecurityGroup:
+		requestFunc = func() (responses.AcsResponse, error) {
+			request := ecs.CreateDeleteSecurityGroupRequest()
+			request.RegionId = config.AlicloudRegion
+			request.SecurityGroupId = resource.Id
+			return client.DeleteSecurityGroup(request)
+		}
+		retryErrors = deleteSecurityGroupRetryErrors
+	case sweepVSwitch:
+		requestFunc = func() (responses.AcsResponse, error) {
+			request := ecs.CreateDeleteVSwitchRequest()
+			request.VSwitchId = resource.Id
+			return client.DeleteVSwitch(request)
+		}
+		retryErrors = deleteVSwitchRetryErrors
+	case sweepVpc:
+		requestFunc = func() (responses.AcsResponse, error) {
+			request := ecs.CreateDeleteVpcRequest()
+			request.VpcId = resource.Id
+			return client.DeleteVpc(request)
+		}
+		retryErrors = deleteVpcRetryErrors
+	default:
+		return fmt.Errorf("unknown resource kind %s", resource.Kind)
+	}
+
+	_, err := client.WaitForExpected(&WaitForExpectArgs{
+		Context:     ctx,
+		RequestFunc: requestFunc,
+		EvalFunc:    client.EvalCouldRetryResponse(retryErrors, EvalRetryErrorType),
+		RetryTimes:  shortRetryTimes,
+	})
+	return err
+}
+
+// releaseEip unassociates the eip from its instance, if any, before
+// releasing it.
+func (s *stepSweepResources) releaseEip(ctx context.Context, state multistep.StateBag, resource orphanedResource) error {
+	config := state.Get("config").(*Config)
+	client := state.Get("client").(*ClientWrapper)
+
+	if resource.InstanceId != "" {
+		unassociateEipAddressRequest := ecs.CreateUnassociateEipAddressRequest()
+		unassociateEipAddressRequest.AllocationId = resource.Id
+		unassociateEipAddressRequest.InstanceId = resource.InstanceId
+		if _, err := client.UnassociateEipAddress(unassociateEipAddressRequest); err != nil {
+			return err
+		}
+
+		_, err := client.WaitForExpected(&WaitForExpectArgs{
+			Context: ctx,
+			RequestFunc: func() (responses.AcsResponse, error) {
+				request := ecs.CreateDescribeEipAddressesRequest()
+				request.RegionId = config.AlicloudRegion
+				request.AllocationId = resource.Id
+				return client.DescribeEipAddresses(request)
+			},
+			EvalFunc: func(response responses.AcsResponse, err error) WaitForExpectEvalResult {
+				if err != nil {
+					return WaitForExpectToRetry
+				}
+
+				for _, eipAddress := range response.(*ecs.DescribeEipAddressesResponse).EipAddresses.EipAddress {
+					if eipAddress.Status == EipStatusAvailable {
+						return WaitForExpectSuccess
+					}
+				}
+				return WaitForExpectToRetry
+			},
+			RetryTimes: shortRetryTimes,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	releaseEipAddressRequest := ecs.CreateReleaseEipAddressRequest()
+	releaseEipAddressRequest.AllocationId = resource.Id
+	_, err := client.ReleaseEipAddress(releaseEipAddressRequest)
+	return err
+}
+
+func newOrphanedResource(kind string, id string, creationTime string) (orphanedResource, error) {
+	created, err := parseCreationTime(creationTime)
+	if err != nil {
+		return orphanedResource{}, fmt.Errorf("Failed parsing the creation time of %s %s: %s", kind, id, err)
+	}
+
+	return orphanedResource{Kind: kind, Id: id, CreationTime: created}, nil
+}
+
+// parseCreationTime parses the creation times returned by the APIs, which
+// come with or without seconds depending on the resource.
+func parseCreationTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unknown time format %q", value)
+}
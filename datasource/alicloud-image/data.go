@@ -0,0 +1,207 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type DatasourceOutput,Config
+//go:generate packer-sdc struct-markdown
+
+package alicloudimage
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	packerecs "github.com/hashicorp/packer-plugin-alicloud/builder/ecs"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/hcl2helper"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const describeImagesPageSize = 100
+
+type Config struct {
+	common.PackerConfig            `mapstructure:",squash"`
+	packerecs.AlicloudAccessConfig `mapstructure:",squash"`
+
+	// Filters the images by their owner. Valid values are `system`, `self`,
+	// `others` and `marketplace`. If this option is not set, the images of
+	// all owners are searched.
+	ImageOwnerAlias string `mapstructure:"owner_alias" required:"false"`
+	// A regular expression the image name must match, e.g.
+	// `^ubuntu_22_04_x64_20G_alibase_.*`.
+	NameRegex string `mapstructure:"name_regex" required:"false"`
+	// Filters the images by the type of their operating system, `linux` or
+	// `windows`.
+	OSType string `mapstructure:"os_type" required:"false"`
+	// Filters the images by their architecture, `i386`, `x86_64` or `arm64`.
+	Architecture string `mapstructure:"architecture" required:"false"`
+	// Key/value pair tags the image must carry.
+	Tags map[string]string `mapstructure:"tags" required:"false"`
+	// Same as [`tags`](#tags) but defined as a singular repeatable block
+	// containing a `key` and a `value` field. In HCL2 mode the
+	// [`dynamic_block`](/packer/docs/templates/hcl_templates/expressions#dynamic-blocks)
+	// will allow you to create those programatically.
+	Tag config.KeyValues `mapstructure:"tag" required:"false"`
+	// Selects the newest created image when the filters match more than one
+	// image. Otherwise the data source fails on an ambiguous result. The
+	// default value is false.
+	MostRecent bool `mapstructure:"most_recent" required:"false"`
+
+	nameRegex *regexp.Regexp
+}
+
+type Datasource struct {
+	config Config
+}
+
+type DatasourceOutput struct {
+	// The ID of the image.
+	ID string `mapstructure:"id"`
+	// The name of the image.
+	Name string `mapstructure:"name"`
+	// The IDs of the snapshots backing the disks of the image.
+	SnapshotIds []string `mapstructure:"snapshot_ids"`
+	// The time the image was created, in UTC and ISO 8601 format.
+	CreationTime string `mapstructure:"creation_time"`
+}
+
+func (d *Datasource) ConfigSpec() hcldec.ObjectSpec {
+	return d.config.FlatMapstructure().HCL2Spec()
+}
+
+func (d *Datasource) Configure(raws ...interface{}) error {
+	err := config.Decode(&d.config, nil, raws...)
+	if err != nil {
+		return err
+	}
+
+	var errs *packersdk.MultiError
+	errs = packersdk.MultiErrorAppend(errs, d.config.AlicloudAccessConfig.Prepare(nil)...)
+	errs = packersdk.MultiErrorAppend(errs, d.config.Tag.CopyOn(&d.config.Tags)...)
+
+	if d.config.ImageOwnerAlias != "" && !packerecs.ContainsInArray([]string{
+		packerecs.ImageOwnerSystem,
+		packerecs.ImageOwnerSelf,
+		packerecs.ImageOwnerOthers,
+		packerecs.ImageOwnerMarketplace,
+	}, d.config.ImageOwnerAlias) {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("owner_alias must be one of system, self, others or marketplace"))
+	}
+
+	if d.config.NameRegex != "" {
+		nameRegex, err := regexp.Compile(d.config.NameRegex)
+		if err != nil {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("Error parsing name_regex: %s", err))
+		}
+		d.config.nameRegex = nameRegex
+	}
+
+	if d.config.ImageOwnerAlias == "" && d.config.NameRegex == "" && d.config.OSType == "" &&
+		d.config.Architecture == "" && len(d.config.Tags) == 0 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("At least one filter must be specified"))
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+
+	packersdk.LogSecretFilter.Set(d.config.AlicloudAccessKey, d.config.AlicloudSecretKey)
+	return nil
+}
+
+func (d *Datasource) OutputSpec() hcldec.ObjectSpec {
+	return (&DatasourceOutput{}).FlatMapstructure().HCL2Spec()
+}
+
+func (d *Datasource) Execute() (cty.Value, error) {
+	client, err := d.config.Client()
+	if err != nil {
+		return cty.NullVal(cty.EmptyObject), err
+	}
+
+	images, err := d.describeImages(client)
+	if err != nil {
+		return cty.NullVal(cty.EmptyObject), fmt.Errorf("Error querying alicloud images: %s", err)
+	}
+
+	image, err := d.selectImage(images)
+	if err != nil {
+		return cty.NullVal(cty.EmptyObject), err
+	}
+
+	output := DatasourceOutput{
+		ID:           image.ImageId,
+		Name:         image.ImageName,
+		CreationTime: image.CreationTime,
+	}
+	for _, device := range image.DiskDeviceMappings.DiskDeviceMapping {
+		output.SnapshotIds = append(output.SnapshotIds, device.SnapshotId)
+	}
+
+	return hcl2helper.HCL2ValueFromConfig(output, d.OutputSpec()), nil
+}
+
+func (d *Datasource) describeImages(client *packerecs.ClientWrapper) ([]ecs.Image, error) {
+	var tags []ecs.DescribeImagesTag
+	for key, value := range d.config.Tags {
+		tags = append(tags, ecs.DescribeImagesTag{Key: key, Value: value})
+	}
+
+	var images []ecs.Image
+	for pageNumber := 1; ; pageNumber++ {
+		request := ecs.CreateDescribeImagesRequest()
+		request.RegionId = d.config.AlicloudRegion
+		request.ImageOwnerAlias = d.config.ImageOwnerAlias
+		request.OSType = d.config.OSType
+		request.Architecture = d.config.Architecture
+		request.PageNumber = requests.NewInteger(pageNumber)
+		request.PageSize = requests.NewInteger(describeImagesPageSize)
+		if len(tags) > 0 {
+			request.Tag = &tags
+		}
+
+		response, err := client.DescribeImages(request)
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, response.Images.Image...)
+		if len(response.Images.Image) < describeImagesPageSize || len(images) >= response.TotalCount {
+			break
+		}
+	}
+
+	log.Printf("[DEBUG] Found %d alicloud images before applying name_regex", len(images))
+	return images, nil
+}
+
+func (d *Datasource) selectImage(images []ecs.Image) (*ecs.Image, error) {
+	var filtered []ecs.Image
+	for _, image := range images {
+		if d.config.nameRegex != nil && !d.config.nameRegex.MatchString(image.ImageName) {
+			continue
+		}
+		filtered = append(filtered, image)
+	}
+
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("No alicloud image was found matching filters")
+	}
+
+	if len(filtered) > 1 && !d.config.MostRecent {
+		return nil, fmt.Errorf("Your query returned more than one result. Please try a more specific search, or set most_recent to true")
+	}
+
+	// CreationTime is formatted as ISO 8601 in UTC, so it sorts lexically.
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].CreationTime > filtered[j].CreationTime
+	})
+
+	return &filtered[0], nil
+}
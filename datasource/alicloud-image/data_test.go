@@ -0,0 +1,88 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package alicloudimage
+
+import (
+	"testing"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+)
+
+func testDatasourceConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"access_key":  "foo",
+		"secret_key":  "bar",
+		"region":      "cn-beijing",
+		"owner_alias": "system",
+		"name_regex":  "^ubuntu_22_04_x64_20G_alibase_.*",
+	}
+}
+
+func TestDatasourceConfigure(t *testing.T) {
+	d := &Datasource{}
+	if err := d.Configure(testDatasourceConfig()); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+}
+
+func TestDatasourceConfigure_NoFilter(t *testing.T) {
+	config := testDatasourceConfig()
+	delete(config, "owner_alias")
+	delete(config, "name_regex")
+
+	d := &Datasource{}
+	if err := d.Configure(config); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestDatasourceConfigure_BadOwnerAlias(t *testing.T) {
+	config := testDatasourceConfig()
+	config["owner_alias"] = "nobody"
+
+	d := &Datasource{}
+	if err := d.Configure(config); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestDatasourceConfigure_BadNameRegex(t *testing.T) {
+	config := testDatasourceConfig()
+	config["name_regex"] = "ubuntu_[0-9"
+
+	d := &Datasource{}
+	if err := d.Configure(config); err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestDatasourceSelectImage(t *testing.T) {
+	images := []ecs.Image{
+		{ImageId: "m-1", ImageName: "ubuntu_22_04_x64_20G_alibase_20230101.vhd", CreationTime: "2023-01-01T00:00:00Z"},
+		{ImageId: "m-2", ImageName: "ubuntu_22_04_x64_20G_alibase_20230301.vhd", CreationTime: "2023-03-01T00:00:00Z"},
+		{ImageId: "m-3", ImageName: "centos_7_9_x64_20G_alibase_20230401.vhd", CreationTime: "2023-04-01T00:00:00Z"},
+	}
+
+	d := &Datasource{}
+	if err := d.Configure(testDatasourceConfig()); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	if _, err := d.selectImage(images); err == nil {
+		t.Fatal("should have error when more than one image matches")
+	}
+
+	d.config.MostRecent = true
+	image, err := d.selectImage(images)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if image.ImageId != "m-2" {
+		t.Fatalf("bad: expected m-2, actual %s", image.ImageId)
+	}
+
+	if _, err := d.selectImage(images[2:]); err == nil {
+		t.Fatal("should have error when no image matches")
+	}
+}
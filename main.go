@@ -8,7 +8,11 @@ import (
 	"os"
 
 	ecsbuilder "github.com/hashicorp/packer-plugin-alicloud/builder/ecs"
+	imageds "github.com/hashicorp/packer-plugin-alicloud/datasource/alicloud-image"
+	exportpp "github.com/hashicorp/packer-plugin-alicloud/post-processor/alicloud-export"
 	importpp "github.com/hashicorp/packer-plugin-alicloud/post-processor/alicloud-import"
+	promotepp "github.com/hashicorp/packer-plugin-alicloud/post-processor/alicloud-promote"
+	retentionpp "github.com/hashicorp/packer-plugin-alicloud/post-processor/alicloud-retention"
 	version "github.com/hashicorp/packer-plugin-alicloud/version"
 	"github.com/hashicorp/packer-plugin-sdk/plugin"
 )
@@ -17,6 +21,10 @@ func main() {
 	pps := plugin.NewSet()
 	pps.RegisterBuilder("ecs", new(ecsbuilder.Builder))
 	pps.RegisterPostProcessor("import", new(importpp.PostProcessor))
+	pps.RegisterPostProcessor("retention", new(retentionpp.PostProcessor))
+	pps.RegisterPostProcessor("export", new(exportpp.PostProcessor))
+	pps.RegisterPostProcessor("promote", new(promotepp.PostProcessor))
+	pps.RegisterDatasource("image", new(imageds.Datasource))
 	pps.SetVersion(version.PluginVersion)
 	err := pps.Run()
 	if err != nil {
@@ -0,0 +1,77 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package alicloudexport
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// Artifact is the files an image was exported to, in OSS and, when they
+// were downloaded, on the local disk.
+type Artifact struct {
+	// The region and the ID of the exported image.
+	RegionId string
+	ImageId  string
+
+	// The bucket and the keys of the exported objects, unless they were
+	// deleted once downloaded.
+	Bucket  string
+	Objects []string
+
+	// The local paths of the downloaded files.
+	Paths []string
+}
+
+func (*Artifact) BuilderId() string {
+	return BuilderId
+}
+
+func (a *Artifact) Files() []string {
+	return a.Paths
+}
+
+func (a *Artifact) Id() string {
+	if len(a.Paths) > 0 {
+		return strings.Join(a.Paths, ",")
+	}
+	return strings.Join(a.urls(), ",")
+}
+
+func (a *Artifact) String() string {
+	if len(a.Paths) > 0 {
+		return fmt.Sprintf("Image %s (%s) exported to: %s", a.ImageId, a.RegionId, strings.Join(a.Paths, ", "))
+	}
+	return fmt.Sprintf("Image %s (%s) exported to: %s", a.ImageId, a.RegionId, strings.Join(a.urls(), ", "))
+}
+
+func (*Artifact) State(name string) interface{} {
+	return nil
+}
+
+// Destroy deletes the downloaded files. The objects in OSS are left alone.
+func (a *Artifact) Destroy() error {
+	errs := new(packersdk.MultiError)
+	for _, path := range a.Paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			errs = packersdk.MultiErrorAppend(errs, err)
+		}
+	}
+
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (a *Artifact) urls() []string {
+	urls := make([]string, 0, len(a.Objects))
+	for _, object := range a.Objects {
+		urls = append(urls, fmt.Sprintf("oss://%s/%s", a.Bucket, object))
+	}
+	return urls
+}
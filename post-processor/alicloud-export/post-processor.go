@@ -0,0 +1,280 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+//go:generate packer-sdc struct-markdown
+
+package alicloudexport
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	packerecs "github.com/hashicorp/packer-plugin-alicloud/builder/ecs"
+	alicloudimport "github.com/hashicorp/packer-plugin-alicloud/post-processor/alicloud-import"
+	alicloudpromote "github.com/hashicorp/packer-plugin-alicloud/post-processor/alicloud-promote"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+)
+
+const (
+	BuilderId = "packer.post-processor.alicloud-export"
+
+	// The files are downloaded in parts of 64 MiB, 4 parts at a time.
+	downloadPartSize    = 64 * 1024 * 1024
+	downloadConcurrency = 4
+)
+
+// The formats images can be exported to.
+var exportFormats = []string{
+	alicloudimport.RAWFileFormat,
+	alicloudimport.VHDFileFormat,
+	alicloudimport.QCOW2FileFormat,
+	alicloudimport.VMDKFileFormat,
+}
+
+// Configuration of this post processor
+type Config struct {
+	common.PackerConfig            `mapstructure:",squash"`
+	packerecs.AlicloudAccessConfig `mapstructure:",squash"`
+
+	// The name of the OSS bucket the image is exported to. The bucket must
+	// exist in the region of the image.
+	OSSBucket string `mapstructure:"oss_bucket_name" required:"true"`
+	// The prefix of the names of the exported objects. This is treated as a
+	// [template engine](/packer/docs/templates/legacy_json_templates/engine),
+	// and you may access any of the variables stored in the generated data
+	// using the [build](/packer/docs/templates/legacy_json_templates/engine)
+	// template function.
+	OSSPrefix string `mapstructure:"oss_prefix" required:"false"`
+	// The format of the exported files, `raw`, `vhd`, `qcow2` or `vmdk`. The
+	// default value is `raw`.
+	Format string `mapstructure:"format" required:"false"`
+	// The RAM role ECS assumes to write to the bucket. Defaults to
+	// `AliyunECSImageExportDefaultRole`, which must have been authorized in
+	// the ECS console.
+	RoleName string `mapstructure:"role_name" required:"false"`
+	// The directory the exported files are downloaded to, so that the
+	// artifact of the post-processor holds the local files. When it is not
+	// set, the files are left in OSS only.
+	DownloadDir string `mapstructure:"download_dir" required:"false"`
+	// Whether the exported objects are deleted from OSS once they have been
+	// downloaded. It can only be set with `download_dir`. The default value
+	// is false.
+	DeleteOSSObjects bool `mapstructure:"delete_oss_objects" required:"false"`
+
+	ctx interpolate.Context
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         BuilderId,
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{
+				"oss_prefix",
+			},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	errs := new(packersdk.MultiError)
+	errs = packersdk.MultiErrorAppend(errs, p.config.AlicloudAccessConfig.Prepare(&p.config.ctx)...)
+
+	if err = interpolate.Validate(p.config.OSSPrefix, &p.config.ctx); err != nil {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("Error parsing oss_prefix template: %s", err))
+	}
+
+	if p.config.OSSBucket == "" {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("oss_bucket_name must be set"))
+	}
+
+	p.config.Format = strings.ToLower(p.config.Format)
+	if p.config.Format == "" {
+		p.config.Format = alicloudimport.RAWFileFormat
+	}
+	if !packerecs.ContainsInArray(exportFormats, p.config.Format) {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("format must be one of %s", strings.Join(exportFormats, ", ")))
+	}
+
+	if p.config.DeleteOSSObjects && p.config.DownloadDir == "" {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("delete_oss_objects can only be specified with download_dir"))
+	}
+
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+
+	packersdk.LogSecretFilter.Set(p.config.AlicloudAccessKey, p.config.AlicloudSecretKey)
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, artifact packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
+	if !packerecs.ContainsInArray([]string{packerecs.BuilderId, alicloudimport.BuilderId, alicloudpromote.BuilderId}, artifact.BuilderId()) {
+		return nil, false, false, fmt.Errorf("Unknown artifact type: %s\nCan only export images of the alicloud-ecs builder or the alicloud-import and alicloud-promote post-processors", artifact.BuilderId())
+	}
+
+	imageId, err := artifactImage(artifact.Id(), p.config.AlicloudRegion)
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	generatedData := artifact.State("generated_data")
+	if generatedData == nil {
+		generatedData = make(map[string]interface{})
+	}
+	p.config.ctx.Data = generatedData
+
+	prefix, err := interpolate.Render(p.config.OSSPrefix, &p.config.ctx)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Error rendering oss_prefix template: %s", err)
+	}
+
+	client, err := p.config.Client()
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Failed to connect alicloud ecs %s", err)
+	}
+
+	ui.Say(fmt.Sprintf("Exporting image %s to oss://%s/%s as %s", imageId, p.config.OSSBucket, prefix, p.config.Format))
+
+	exportImageRequest := ecs.CreateExportImageRequest()
+	exportImageRequest.RegionId = p.config.AlicloudRegion
+	exportImageRequest.ImageId = imageId
+	exportImageRequest.ImageFormat = p.config.Format
+	exportImageRequest.OSSBucket = p.config.OSSBucket
+	exportImageRequest.OSSPrefix = prefix
+	exportImageRequest.RoleName = p.config.RoleName
+	exportImageResponse, err := client.ExportImage(exportImageRequest)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Failed to export image %s: %s", imageId, err)
+	}
+
+	ui.Say(fmt.Sprintf("Waiting for export task %s to finish...", exportImageResponse.TaskId))
+	_, err = client.WaitForTask(ctx, p.config.AlicloudRegion, exportImageResponse.TaskId,
+		time.Duration(packerecs.ALICLOUD_DEFAULT_LONG_TIMEOUT)*time.Second, func(progress string) {
+			ui.Message(fmt.Sprintf("Exported %s", progress))
+		})
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Failed to export image %s: %s", imageId, err)
+	}
+
+	ossClient, err := p.config.OSSClient(alicloudimport.GetEndPoint(p.config.AlicloudRegion, ""))
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Failed to create OSS client: %s", err)
+	}
+	bucket, err := ossClient.Bucket(p.config.OSSBucket)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Failed to open bucket %s: %s", p.config.OSSBucket, err)
+	}
+
+	objects, err := exportedObjects(bucket, prefix, imageId)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Failed to list the exported objects of image %s: %s", imageId, err)
+	}
+	if len(objects) == 0 {
+		return nil, false, false, fmt.Errorf("No object of image %s found in oss://%s/%s", imageId, p.config.OSSBucket, prefix)
+	}
+	for _, object := range objects {
+		ui.Message(fmt.Sprintf("Exported oss://%s/%s", p.config.OSSBucket, object))
+	}
+
+	exported := &Artifact{
+		RegionId: p.config.AlicloudRegion,
+		ImageId:  imageId,
+		Bucket:   p.config.OSSBucket,
+		Objects:  objects,
+	}
+
+	if p.config.DownloadDir != "" {
+		if err := os.MkdirAll(p.config.DownloadDir, 0755); err != nil {
+			return nil, false, false, fmt.Errorf("Failed to create download_dir %s: %s", p.config.DownloadDir, err)
+		}
+
+		for _, object := range objects {
+			target := filepath.Join(p.config.DownloadDir, path.Base(object))
+			ui.Say(fmt.Sprintf("Downloading oss://%s/%s to %s...", p.config.OSSBucket, object, target))
+
+			// 下载中断后从检查点续传
+			err := bucket.DownloadFile(object, target, downloadPartSize,
+				oss.Routines(downloadConcurrency), oss.Checkpoint(true, target+".cp"))
+			if err != nil {
+				return nil, false, false, fmt.Errorf("Failed to download oss://%s/%s: %s", p.config.OSSBucket, object, err)
+			}
+			exported.Paths = append(exported.Paths, target)
+		}
+
+		if p.config.DeleteOSSObjects {
+			for _, object := range objects {
+				ui.Message(fmt.Sprintf("Deleting oss://%s/%s", p.config.OSSBucket, object))
+				if err := bucket.DeleteObject(object); err != nil {
+					return nil, false, false, fmt.Errorf("Failed to delete oss://%s/%s: %s", p.config.OSSBucket, object, err)
+				}
+			}
+			exported.Objects = nil
+		}
+	}
+
+	// The images of the artifact are kept whatever keep_input_artifact says.
+	return exported, true, true, nil
+}
+
+// artifactImage returns the image of the artifact in the region. The
+// artifact may come through RPC, so its images are read from its ID
+// formatted as region:image-id,region:image-id.
+func artifactImage(artifactId string, regionId string) (string, error) {
+	for _, part := range strings.Split(artifactId, ",") {
+		imageRegionId, imageId, ok := strings.Cut(part, ":")
+		if !ok {
+			return "", fmt.Errorf("Unexpected image %q in artifact %s", part, artifactId)
+		}
+		if imageRegionId == regionId {
+			return imageId, nil
+		}
+	}
+
+	return "", fmt.Errorf("The artifact %s has no image in region %s", artifactId, regionId)
+}
+
+// exportedObjects lists the objects under the prefix holding the exported
+// disks of the image, whose names contain the ID of the image.
+func exportedObjects(bucket *oss.Bucket, prefix string, imageId string) ([]string, error) {
+	var objects []string
+	marker := ""
+	for {
+		result, err := bucket.ListObjects(oss.Prefix(prefix), oss.Marker(marker))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Objects {
+			if strings.Contains(strings.TrimPrefix(object.Key, prefix), imageId) {
+				objects = append(objects, object.Key)
+			}
+		}
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextMarker
+	}
+
+	return objects, nil
+}
@@ -0,0 +1,79 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package alicloudexport
+
+import (
+	"testing"
+)
+
+func testPostProcessorConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"access_key":      "foo",
+		"secret_key":      "bar",
+		"region":          "cn-beijing",
+		"oss_bucket_name": "images",
+		"oss_prefix":      "{{ build `SourceImage` }}/",
+	}
+}
+
+func TestPostProcessorConfigure(t *testing.T) {
+	p := &PostProcessor{}
+	if err := p.Configure(testPostProcessorConfig()); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if p.config.Format != "raw" {
+		t.Fatalf("bad: expected default format raw, actual %s", p.config.Format)
+	}
+}
+
+func TestPostProcessorConfigure_Invalid(t *testing.T) {
+	for name, override := range map[string]map[string]interface{}{
+		"no bucket":                 {"oss_bucket_name": ""},
+		"bad format":                {"format": "vdi"},
+		"bad prefix":                {"oss_prefix": "{{ bad }}"},
+		"delete_oss_objects no dir": {"delete_oss_objects": true},
+	} {
+		config := testPostProcessorConfig()
+		for key, value := range override {
+			config[key] = value
+		}
+
+		p := &PostProcessor{}
+		if err := p.Configure(config); err == nil {
+			t.Fatalf("%s should have error", name)
+		}
+	}
+}
+
+func TestArtifactImage(t *testing.T) {
+	imageId, err := artifactImage("cn-hangzhou:m-hz,cn-beijing:m-bj", "cn-beijing")
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if imageId != "m-bj" {
+		t.Fatalf("bad: expected m-bj, actual %s", imageId)
+	}
+
+	if _, err := artifactImage("cn-hangzhou:m-hz", "cn-beijing"); err == nil {
+		t.Fatalf("should have error: the artifact has no image in the region")
+	}
+	if _, err := artifactImage("m-hz", "cn-beijing"); err == nil {
+		t.Fatalf("should have error: the image has no region")
+	}
+}
+
+func TestArtifact(t *testing.T) {
+	a := &Artifact{RegionId: "cn-beijing", ImageId: "m-bj", Bucket: "images", Objects: []string{"web/m-bj_system.raw"}}
+	if len(a.Files()) != 0 {
+		t.Fatalf("bad: the artifact has no local file, actual %v", a.Files())
+	}
+	if a.Id() != "oss://images/web/m-bj_system.raw" {
+		t.Fatalf("bad: actual id %s", a.Id())
+	}
+
+	a.Paths = []string{"output/m-bj_system.raw"}
+	if a.Id() != "output/m-bj_system.raw" || len(a.Files()) != 1 {
+		t.Fatalf("bad: the artifact should hold the local file, actual %s", a.Id())
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package alicloudimport
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	packerecs "github.com/hashicorp/packer-plugin-alicloud/builder/ecs"
+)
+
+// The magic numbers identifying the disk image formats. RAW images have none.
+var (
+	qcow2Magic = []byte("QFI\xfb")
+	vmdkMagic  = []byte("KDMV")
+	vhdMagic   = []byte("conectix")
+
+	// A VMDK split in several extent files, the default output of VMware,
+	// starts with a text descriptor referencing its extents.
+	vmdkDescriptorMagic = []byte("# Disk DescriptorFile")
+)
+
+// vhdFooterSize is the size of the footer ending every VHD file, which a
+// dynamic VHD also copies to its start.
+const vhdFooterSize = 512
+
+// importDisk is a disk image file imported as a disk of the image.
+type importDisk struct {
+	Path   string
+	Format string
+	OSSKey string
+	Device string
+}
+
+// importDisks returns the disks to import, the system disk first, from
+// disk_files or the files of the artifact.
+func (p *PostProcessor) importDisks(artifactFiles []string) ([]importDisk, error) {
+	paths := p.config.DiskFiles
+	if len(paths) == 0 {
+		extents := make(map[string]bool)
+		for _, path := range artifactFiles {
+			descriptorExtents, _ := vmdkDescriptor(path)
+			for _, extent := range descriptorExtents {
+				extents[filepath.Join(filepath.Dir(path), extent)] = true
+			}
+		}
+
+		for _, path := range artifactFiles {
+			// 分片 VMDK 的数据文件不是独立的磁盘
+			if extents[filepath.Clean(path)] {
+				continue
+			}
+			if isDiskFile(path, p.config.Format == "") {
+				paths = append(paths, path)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("No qcow2, vmdk, raw or vhd file found in artifact from builder")
+	}
+	if len(paths) > maxDataDisks+1 {
+		return nil, fmt.Errorf("At most %d data disks can be imported, found %d disk files", maxDataDisks, len(paths)-1)
+	}
+
+	disks := make([]importDisk, 0, len(paths))
+	for index, path := range paths {
+		if extents, ok := vmdkDescriptor(path); ok {
+			return nil, fmt.Errorf("%s is the descriptor of a VMDK split into the extent files %s, which can't be imported. "+
+				"Build a monolithic or streamOptimized VMDK instead, or list converted disk images in disk_files",
+				path, strings.Join(extents, ", "))
+		}
+
+		format := p.config.Format
+		if format == "" {
+			var err error
+			if format, err = detectFormat(path); err != nil {
+				return nil, fmt.Errorf("Failed to detect the format of %s: %s", path, err)
+			}
+		}
+
+		disk := importDisk{
+			Path:   path,
+			Format: format,
+			OSSKey: p.config.OSSKey,
+			Device: fmt.Sprintf("/dev/xvd%c", 'a'+index),
+		}
+		if index > 0 {
+			disk.OSSKey = fmt.Sprintf("%s-data%d", p.config.OSSKey, index)
+		}
+		disks = append(disks, disk)
+	}
+
+	return disks, nil
+}
+
+// isDiskFile tells whether an artifact file is a disk image, by its
+// extension or, when sniff is set, by its header. Only RAW images need an
+// extension to be told from other files.
+func isDiskFile(path string, sniff bool) bool {
+	extension := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if extension == "img" || packerecs.ContainsInArray(importFormats, extension) {
+		return true
+	}
+	if !sniff {
+		return false
+	}
+
+	// QEMU 等构建器输出的镜像文件可能没有扩展名
+	format, err := detectFormat(path)
+	return err == nil && format != RAWFileFormat
+}
+
+// vmdkDescriptor reports whether the file is a VMDK descriptor, and returns
+// the extent files it references.
+func vmdkDescriptor(path string) ([]string, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer file.Close()
+
+	// 描述文件很小，只读取开头部分
+	data, err := io.ReadAll(io.LimitReader(file, 64*1024))
+	if err != nil || !bytes.HasPrefix(data, vmdkDescriptorMagic) {
+		return nil, false
+	}
+
+	// The extents are described by lines like RW 8323072 SPARSE "disk-s001.vmdk".
+	var extents []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !packerecs.ContainsInArray([]string{"RW", "RDONLY", "NOACCESS"}, fields[0]) {
+			continue
+		}
+		if _, extent, ok := strings.Cut(line, "\""); ok {
+			extent, _, _ = strings.Cut(extent, "\"")
+			extents = append(extents, extent)
+		}
+	}
+
+	return extents, true
+}
+
+// detectFormat reads the format of a disk image from its header, or its
+// footer for fixed VHD files. Files carrying no known magic number are RAW.
+func detectFormat(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	header := make([]byte, vhdFooterSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, qcow2Magic):
+		return QCOW2FileFormat, nil
+	case bytes.HasPrefix(header, vmdkMagic):
+		return VMDKFileFormat, nil
+	case bytes.HasPrefix(header, vhdMagic):
+		return VHDFileFormat, nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.Size() >= vhdFooterSize {
+		footer := make([]byte, len(vhdMagic))
+		if _, err := file.ReadAt(footer, info.Size()-vhdFooterSize); err != nil {
+			return "", err
+		}
+		if bytes.Equal(footer, vhdMagic) {
+			return VHDFileFormat, nil
+		}
+	}
+
+	return RAWFileFormat, nil
+}
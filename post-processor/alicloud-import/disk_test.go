@@ -0,0 +1,150 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package alicloudimport
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testDiskFile writes a disk image file starting with header and ending with
+// footer.
+func testDiskFile(t *testing.T, name string, header, footer string) string {
+	path := filepath.Join(t.TempDir(), name)
+	data := append([]byte(header), make([]byte, 2*vhdFooterSize)...)
+	data = append(data, footer...)
+	if footer != "" {
+		data = append(data, make([]byte, vhdFooterSize-len(footer))...)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	return path
+}
+
+func TestDetectFormat(t *testing.T) {
+	cases := map[string]struct {
+		header, footer string
+		expected       string
+	}{
+		"qcow2":       {header: "QFI\xfb", expected: QCOW2FileFormat},
+		"vmdk":        {header: "KDMV", expected: VMDKFileFormat},
+		"dynamic vhd": {header: "conectix", footer: "conectix", expected: VHDFileFormat},
+		"fixed vhd":   {footer: "conectix", expected: VHDFileFormat},
+		"raw":         {expected: RAWFileFormat},
+	}
+
+	for name, c := range cases {
+		format, err := detectFormat(testDiskFile(t, "disk", c.header, c.footer))
+		if err != nil {
+			t.Fatalf("should not have error: %s", err)
+		}
+		if format != c.expected {
+			t.Fatalf("bad: %s should be detected as %s, actual %s", name, c.expected, format)
+		}
+	}
+}
+
+func TestImportDisks(t *testing.T) {
+	system := testDiskFile(t, "packer-ubuntu", "QFI\xfb", "")
+	data := testDiskFile(t, "data.raw", "", "")
+	files := []string{
+		testDiskFile(t, "packer-ubuntu.vmx", "config.version", ""),
+		system,
+		data,
+	}
+
+	p := &PostProcessor{}
+	p.config.OSSKey = "images/ubuntu"
+	disks, err := p.importDisks(files)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if len(disks) != 2 {
+		t.Fatalf("bad: expected the system disk and a data disk, actual %v", disks)
+	}
+	if disks[0].Path != system || disks[0].Format != QCOW2FileFormat || disks[0].OSSKey != "images/ubuntu" || disks[0].Device != "/dev/xvda" {
+		t.Fatalf("bad system disk: %v", disks[0])
+	}
+	if disks[1].Path != data || disks[1].Format != RAWFileFormat || disks[1].OSSKey != "images/ubuntu-data1" || disks[1].Device != "/dev/xvdb" {
+		t.Fatalf("bad data disk: %v", disks[1])
+	}
+
+	// 指定 format 时不再探测文件头，没有扩展名的文件不会被选中
+	p.config.Format = RAWFileFormat
+	disks, err = p.importDisks(files)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if len(disks) != 1 || disks[0].Path != data || disks[0].Format != RAWFileFormat {
+		t.Fatalf("bad: %v", disks)
+	}
+
+	p.config.DiskFiles = []string{data, system}
+	disks, err = p.importDisks(nil)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if len(disks) != 2 || disks[0].Path != data || disks[1].Path != system {
+		t.Fatalf("bad: disk_files should be imported in order, actual %v", disks)
+	}
+
+	p.config.DiskFiles = nil
+	if _, err := p.importDisks([]string{files[0]}); err == nil {
+		t.Fatal("artifact without disk images should have error")
+	}
+}
+
+func TestImportDisks_SplitVMDK(t *testing.T) {
+	// The default output of the VMware builders: a text descriptor and its
+	// sparse extents.
+	dir := t.TempDir()
+	descriptor := filepath.Join(dir, "packer-ubuntu.vmdk")
+	content := `# Disk DescriptorFile
+version=1
+CID=fffffffe
+parentCID=ffffffff
+createType="twoGbMaxExtentSparse"
+
+# Extent description
+RW 4192256 SPARSE "packer-ubuntu-s001.vmdk"
+RW 4192256 SPARSE "packer-ubuntu-s002.vmdk"
+`
+	if err := os.WriteFile(descriptor, []byte(content), 0644); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	files := []string{
+		filepath.Join(dir, "packer-ubuntu.vmx"),
+		descriptor,
+		filepath.Join(dir, "packer-ubuntu-s001.vmdk"),
+		filepath.Join(dir, "packer-ubuntu-s002.vmdk"),
+	}
+	for _, path := range []string{files[0], files[2], files[3]} {
+		if err := os.WriteFile(path, append([]byte("KDMV"), make([]byte, vhdFooterSize)...), 0644); err != nil {
+			t.Fatalf("should not have error: %s", err)
+		}
+	}
+
+	extents, ok := vmdkDescriptor(descriptor)
+	if !ok || len(extents) != 2 || extents[0] != "packer-ubuntu-s001.vmdk" || extents[1] != "packer-ubuntu-s002.vmdk" {
+		t.Fatalf("bad: expected the extents of the descriptor, actual %v", extents)
+	}
+	if _, ok := vmdkDescriptor(files[2]); ok {
+		t.Fatal("bad: a sparse extent is not a descriptor")
+	}
+
+	p := &PostProcessor{}
+	p.config.OSSKey = "images/ubuntu"
+	_, err := p.importDisks(files)
+	if err == nil || !strings.Contains(err.Error(), "packer-ubuntu-s001.vmdk, packer-ubuntu-s002.vmdk") {
+		t.Fatalf("split VMDK should have error naming its extents, actual %v", err)
+	}
+
+	p.config.DiskFiles = []string{descriptor}
+	if _, err := p.importDisks(nil); err == nil {
+		t.Fatal("split VMDK in disk_files should have error")
+	}
+}
@@ -23,18 +23,27 @@ import (
 	"github.com/hashicorp/hcl/v2/hcldec"
 	packerecs "github.com/hashicorp/packer-plugin-alicloud/builder/ecs"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/random"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 )
 
 const (
-	Packer        = "HashiCorp-Packer"
-	BuilderId     = "packer.post-processor.alicloud-import"
-	OSSSuffix     = "oss-"
-	RAWFileFormat = "raw"
-	VHDFileFormat = "vhd"
+	Packer          = "HashiCorp-Packer"
+	BuilderId       = "packer.post-processor.alicloud-import"
+	OSSSuffix       = "oss-"
+	RAWFileFormat   = "raw"
+	VHDFileFormat   = "vhd"
+	QCOW2FileFormat = "qcow2"
+	VMDKFileFormat  = "vmdk"
 )
 
+// The formats images can be imported from.
+var importFormats = []string{QCOW2FileFormat, VMDKFileFormat, RAWFileFormat, VHDFileFormat}
+
+// maxDataDisks is the number of data disks an imported image can have.
+const maxDataDisks = 16
+
 const (
 	PolicyTypeSystem        = "System"
 	NoSetRoleError          = "NoSetRoletoECSServiceAcount"
@@ -89,9 +98,30 @@ type Config struct {
 	//   - cloud_ssd - 20 \~ 2048
 	//   - cloud_essd - 20 \~ 2048
 	Size string `mapstructure:"image_system_size"`
-	// The format of the image for import, now alicloud only support RAW and
-	// VHD.
-	Format string `mapstructure:"format" required:"true"`
+	// The format of the disk image files, `qcow2`, `vmdk`, `raw` or `vhd`.
+	// If this option is not set, the format of every file is detected from
+	// its header.
+	Format string `mapstructure:"format" required:"false"`
+	// The disk image files to import. The first file is the system disk,
+	// and the following files are the data disks, in order. Defaults to the
+	// files of the artifact with a `qcow2`, `vmdk`, `raw`, `img` or `vhd`
+	// extension, in the order of the artifact, plus the files without
+	// extension holding a qcow2, vmdk or vhd image when `format` is not set.
+	// A VMDK split into extent files, as the VMware builders output by
+	// default, can't be imported: build a monolithic or streamOptimized VMDK
+	// instead.
+	DiskFiles []string `mapstructure:"disk_files" required:"false"`
+	// The size of the parts the file is uploaded to OSS in, in MiB. It is
+	// raised when the file would otherwise be split into more than 10000
+	// parts. The default value is 64.
+	OSSPartSize int `mapstructure:"oss_part_size" required:"false"`
+	// The number of parts uploaded to OSS concurrently, from 1 to 100. The
+	// default value is 4.
+	OSSUploadConcurrency int `mapstructure:"oss_upload_concurrency" required:"false"`
+	// The directory the checkpoint of the upload is saved to, so that an
+	// interrupted upload is resumed by the next attempt or the next run of
+	// Packer. Defaults to the directory of the uploaded file.
+	OSSCheckpointDir string `mapstructure:"oss_checkpoint_dir" required:"false"`
 
 	ctx interpolate.Context
 }
@@ -129,7 +159,7 @@ func (p *PostProcessor) Configure(raws ...interface{}) error {
 			errs, fmt.Errorf("Error parsing oss_key_name template: %s", err))
 	}
 
-	errs = packersdk.MultiErrorAppend(errs, p.config.AlicloudImageTag.CopyOn(&p.config.AlicloudImageTags)...)
+	errs = packersdk.MultiErrorAppend(errs, p.config.AlicloudImageConfig.Prepare(&p.config.ctx)...)
 
 	// Check we have alicloud access variables defined somewhere
 	errs = packersdk.MultiErrorAppend(errs, p.config.AlicloudAccessConfig.Prepare(&p.config.ctx)...)
@@ -146,6 +176,33 @@ func (p *PostProcessor) Configure(raws ...interface{}) error {
 		}
 	}
 
+	p.config.Format = strings.ToLower(p.config.Format)
+	if p.config.Format != "" && !packerecs.ContainsInArray(importFormats, p.config.Format) {
+		errs = packersdk.MultiErrorAppend(
+			errs, fmt.Errorf("format must be one of %s", strings.Join(importFormats, ", ")))
+	}
+
+	if len(p.config.DiskFiles) > maxDataDisks+1 {
+		errs = packersdk.MultiErrorAppend(
+			errs, fmt.Errorf("disk_files must list at most %d files", maxDataDisks+1))
+	}
+
+	if p.config.OSSPartSize == 0 {
+		p.config.OSSPartSize = defaultOSSPartSize
+	}
+	if p.config.OSSPartSize < 1 || int64(p.config.OSSPartSize)*mib > oss.MaxPartSize {
+		errs = packersdk.MultiErrorAppend(
+			errs, fmt.Errorf("oss_part_size must be between 1 and %d", oss.MaxPartSize/mib))
+	}
+
+	if p.config.OSSUploadConcurrency == 0 {
+		p.config.OSSUploadConcurrency = defaultOSSUploadConcurrency
+	}
+	if p.config.OSSUploadConcurrency < 1 || p.config.OSSUploadConcurrency > 100 {
+		errs = packersdk.MultiErrorAppend(
+			errs, fmt.Errorf("oss_upload_concurrency must be between 1 and 100"))
+	}
+
 	// Anything which flagged return back up the stack
 	if len(errs.Errors) > 0 {
 		return errs
@@ -176,20 +233,14 @@ func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, artifa
 	}
 
 	ui.Say(fmt.Sprintf("Rendered oss_key_name as %s", p.config.OSSKey))
-	ui.Say("Looking for RAW or VHD in artifact")
+	ui.Say("Looking for disk images in artifact")
 
-	// Locate the files output from the builder
-	source := ""
-	for _, path := range artifact.Files() {
-		if strings.HasSuffix(path, VHDFileFormat) || strings.HasSuffix(path, RAWFileFormat) {
-			source = path
-			break
-		}
+	disks, err := p.importDisks(artifact.Files())
+	if err != nil {
+		return nil, false, false, err
 	}
-
-	// Hope we found something useful
-	if source == "" {
-		return nil, false, false, fmt.Errorf("No vhd or raw file found in artifact from builder")
+	for _, disk := range disks {
+		ui.Message(fmt.Sprintf("Importing %s as %s disk %s", disk.Path, disk.Format, disk.Device))
 	}
 
 	ecsClient, err := p.config.AlicloudAccessConfig.Client()
@@ -197,7 +248,7 @@ func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, artifa
 		return nil, false, false, fmt.Errorf("Failed to connect alicloud ecs  %s", err)
 	}
 
-	endpoint := getEndPoint(p.config.AlicloudRegion, p.config.OSSBucket)
+	endpoint := GetEndPoint(p.config.AlicloudRegion, p.config.OSSBucket)
 
 	describeImagesRequest := ecs.CreateDescribeImagesRequest()
 	describeImagesRequest.RegionId = p.config.AlicloudRegion
@@ -218,14 +269,20 @@ func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, artifa
 		return nil, false, false, fmt.Errorf("Failed to query or create bucket %s: %s", p.config.OSSBucket, err)
 	}
 
-	ui.Say(fmt.Sprintf("Waiting for uploading file %s to %s/%s...", source, endpoint, p.config.OSSKey))
+	for _, disk := range disks {
+		ui.Say(fmt.Sprintf("Waiting for uploading file %s to %s/%s...", disk.Path, endpoint, disk.OSSKey))
 
-	err = bucket.PutObjectFromFile(p.config.OSSKey, source)
-	if err != nil {
-		return nil, false, false, fmt.Errorf("Failed to upload image %s: %s", source, err)
-	}
+		if err = p.uploadFile(ctx, ui, bucket, disk.Path, disk.OSSKey); err != nil {
+			return nil, false, false, fmt.Errorf("Failed to upload image %s: %s", disk.Path, err)
+		}
 
-	ui.Say(fmt.Sprintf("Image file %s has been uploaded to OSS", source))
+		ui.Say(fmt.Sprintf("Verifying %s/%s against %s", endpoint, disk.OSSKey, disk.Path))
+		if err = verifyUpload(bucket, disk.OSSKey, disk.Path); err != nil {
+			return nil, false, false, fmt.Errorf("Failed to verify the upload of image %s: %s", disk.Path, err)
+		}
+
+		ui.Say(fmt.Sprintf("Image file %s has been uploaded to OSS", disk.Path))
+	}
 
 	if len(images) > 0 && p.config.AlicloudImageForceDelete {
 		deleteImageRequest := ecs.CreateDeleteImageRequest()
@@ -237,7 +294,7 @@ func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, artifa
 		}
 	}
 
-	importImageRequest := p.buildImportImageRequest()
+	importImageRequest := p.buildImportImageRequest(disks)
 	importImageResponse, err := ecsClient.ImportImage(importImageRequest)
 	if err != nil {
 		e, ok := err.(errors.Error)
@@ -251,6 +308,7 @@ func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, artifa
 		}
 
 		acsResponse, err := ecsClient.WaitForExpected(&packerecs.WaitForExpectArgs{
+			Context: ctx,
 			RequestFunc: func() (responses.AcsResponse, error) {
 				return ecsClient.ImportImage(importImageRequest)
 			},
@@ -285,53 +343,70 @@ func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, artifa
 	imageId := importImageResponse.ImageId
 
 	ui.Say(fmt.Sprintf("Waiting for importing %s/%s to alicloud...", endpoint, p.config.OSSKey))
-	_, err = ecsClient.WaitForImageStatus(p.config.AlicloudRegion, imageId, packerecs.ImageStatusAvailable, time.Duration(packerecs.ALICLOUD_DEFAULT_LONG_TIMEOUT)*time.Second)
+	_, err = ecsClient.WaitForImageStatus(ctx, p.config.AlicloudRegion, imageId, packerecs.ImageStatusAvailable, time.Duration(packerecs.ALICLOUD_DEFAULT_LONG_TIMEOUT)*time.Second)
 	if err != nil {
 		return nil, false, false, fmt.Errorf("Import image %s failed: %s", imageId, err)
 	}
 
-	// Add the reported Alicloud image ID to the artifact list
 	ui.Say(fmt.Sprintf("Importing created alicloud image ID %s in region %s Finished.", imageId, p.config.AlicloudRegion))
+
+	// 导入的镜像同样打标签、复制到其他地域、加密和共享
+	alicloudImages, err := packerecs.RunImagePipeline(ctx, ui, &p.config.Config, ecsClient, imageId)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Failed to process imported image %s: %s", imageId, err)
+	}
+
+	// Add the reported Alicloud image IDs to the artifact list
 	artifact = &packerecs.Artifact{
-		AlicloudImages: map[string]string{
-			p.config.AlicloudRegion: imageId,
-		},
+		AlicloudImages: alicloudImages,
 		BuilderIdValue: BuilderId,
+		ImageFamily:    p.config.TargetImageFamily,
+		Tags:           p.config.AlicloudImageTags,
 		Client:         ecsClient,
 	}
 
 	if !p.config.SkipClean {
-		ui.Message(fmt.Sprintf("Deleting import source %s/%s/%s", endpoint, p.config.OSSBucket, p.config.OSSKey))
-		if err = bucket.DeleteObject(p.config.OSSKey); err != nil {
-			return nil, false, false, fmt.Errorf("Failed to delete %s/%s/%s: %s", endpoint, p.config.OSSBucket, p.config.OSSKey, err)
+		for _, disk := range disks {
+			ui.Message(fmt.Sprintf("Deleting import source %s/%s/%s", endpoint, p.config.OSSBucket, disk.OSSKey))
+			if err = bucket.DeleteObject(disk.OSSKey); err != nil {
+				return nil, false, false, fmt.Errorf("Failed to delete %s/%s/%s: %s", endpoint, p.config.OSSBucket, disk.OSSKey, err)
+			}
 		}
 	}
 
 	return artifact, false, false, nil
 }
 
-func (p *PostProcessor) getOssClient() *oss.Client {
+func (p *PostProcessor) getOssClient() (*oss.Client, error) {
 	if p.ossClient == nil {
 		log.Println("Creating OSS Client")
-		ossClient, _ := oss.New(getEndPoint(p.config.AlicloudRegion, ""), p.config.AlicloudAccessKey,
-			p.config.AlicloudSecretKey)
+		ossClient, err := p.config.AlicloudAccessConfig.OSSClient(GetEndPoint(p.config.AlicloudRegion, ""))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create OSS client: %s", err)
+		}
 		p.ossClient = ossClient
 	}
 
-	return p.ossClient
+	return p.ossClient, nil
 }
 
-func (p *PostProcessor) getRamClient() *ram.Client {
+func (p *PostProcessor) getRamClient() (*ram.Client, error) {
 	if p.ramClient == nil {
-		ramClient, _ := ram.NewClientWithAccessKey(p.config.AlicloudRegion, p.config.AlicloudAccessKey, p.config.AlicloudSecretKey)
+		ramClient, err := p.config.AlicloudAccessConfig.RAMClient()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create RAM client: %s", err)
+		}
 		p.ramClient = ramClient
 	}
 
-	return p.ramClient
+	return p.ramClient, nil
 }
 
 func (p *PostProcessor) queryOrCreateBucket(bucketName string) (*oss.Bucket, error) {
-	ossClient := p.getOssClient()
+	ossClient, err := p.getOssClient()
+	if err != nil {
+		return nil, err
+	}
 
 	isExist, err := ossClient.IsBucketExist(bucketName)
 	if err != nil {
@@ -352,12 +427,15 @@ func (p *PostProcessor) queryOrCreateBucket(bucketName string) (*oss.Bucket, err
 }
 
 func (p *PostProcessor) prepareImportRole() error {
-	ramClient := p.getRamClient()
+	ramClient, err := p.getRamClient()
+	if err != nil {
+		return err
+	}
 
 	getRoleRequest := ram.CreateGetRoleRequest()
 	getRoleRequest.SetScheme(requests.HTTPS)
 	getRoleRequest.RoleName = DefaultImportRoleName
-	_, err := ramClient.GetRole(getRoleRequest)
+	_, err = ramClient.GetRole(getRoleRequest)
 	if err == nil {
 		if e := p.updateOrAttachPolicy(); e != nil {
 			return e
@@ -380,12 +458,15 @@ func (p *PostProcessor) prepareImportRole() error {
 }
 
 func (p *PostProcessor) updateOrAttachPolicy() error {
-	ramClient := p.getRamClient()
+	ramClient, err := p.getRamClient()
+	if err != nil {
+		return err
+	}
 
 	listPoliciesForRoleRequest := ram.CreateListPoliciesForRoleRequest()
 	listPoliciesForRoleRequest.SetScheme(requests.HTTPS)
 	listPoliciesForRoleRequest.RoleName = DefaultImportRoleName
-	policyListResponse, err := p.ramClient.ListPoliciesForRole(listPoliciesForRoleRequest)
+	policyListResponse, err := ramClient.ListPoliciesForRole(listPoliciesForRoleRequest)
 	if err != nil {
 		return fmt.Errorf("Failed to list policies: %s", err)
 	}
@@ -421,7 +502,10 @@ func (p *PostProcessor) updateOrAttachPolicy() error {
 }
 
 func (p *PostProcessor) createRoleAndAttachPolicy() error {
-	ramClient := p.getRamClient()
+	ramClient, err := p.getRamClient()
+	if err != nil {
+		return err
+	}
 
 	createRoleRequest := ram.CreateCreateRoleRequest()
 	createRoleRequest.SetScheme(requests.HTTPS)
@@ -442,27 +526,39 @@ func (p *PostProcessor) createRoleAndAttachPolicy() error {
 	return nil
 }
 
-func (p *PostProcessor) buildImportImageRequest() *ecs.ImportImageRequest {
+func (p *PostProcessor) buildImportImageRequest(disks []importDisk) *ecs.ImportImageRequest {
 	request := ecs.CreateImportImageRequest()
 	request.RegionId = p.config.AlicloudRegion
 	request.ImageName = p.config.AlicloudImageName
+	// 加密时导入的镜像只是临时镜像，由加密后的副本使用 image_name
+	if p.config.ImageEncrypted.True() {
+		request.ImageName = fmt.Sprintf("packer_%s", random.AlphaNum(7))
+	}
 	request.Description = p.config.AlicloudImageDescription
 	request.Architecture = p.config.Architecture
 	request.OSType = p.config.OSType
 	request.Platform = p.config.Platform
-	request.DiskDeviceMapping = &[]ecs.ImportImageDiskDeviceMapping{
-		{
-			DiskImageSize: p.config.Size,
-			Format:        p.config.Format,
-			OSSBucket:     p.config.OSSBucket,
-			OSSObject:     p.config.OSSKey,
-		},
+	mappings := make([]ecs.ImportImageDiskDeviceMapping, 0, len(disks))
+	for index, disk := range disks {
+		mapping := ecs.ImportImageDiskDeviceMapping{
+			Format:    disk.Format,
+			OSSBucket: p.config.OSSBucket,
+			OSSObject: disk.OSSKey,
+			Device:    disk.Device,
+		}
+		if index == 0 {
+			mapping.DiskImageSize = p.config.Size
+		}
+		mappings = append(mappings, mapping)
 	}
+	request.DiskDeviceMapping = &mappings
 	request.ResourceGroupId = p.config.AlicloudResourceGroupId
 	return request
 }
 
-func getEndPoint(region string, bucket string) string {
+// GetEndPoint returns the OSS endpoint of the region, or the one of the
+// bucket in the region when bucket is set.
+func GetEndPoint(region string, bucket string) string {
 	if bucket != "" {
 		return "https://" + bucket + "." + getOSSRegion(region) + ".aliyuncs.com"
 	}
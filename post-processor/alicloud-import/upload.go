@@ -0,0 +1,236 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package alicloudimport
+
+import (
+	"context"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const (
+	mib = 1024 * 1024
+
+	defaultOSSPartSize          = 64
+	defaultOSSUploadConcurrency = 4
+
+	// OSS accepts at most 10000 parts in a multipart upload.
+	ossMaxParts = 10000
+	// The upload is attempted again from its checkpoint when it fails.
+	ossUploadAttempts = 3
+	// How often the progress of the upload is reported.
+	ossProgressInterval = 30 * time.Second
+)
+
+// uploadFile uploads the file to the object key in parts, resuming from the
+// checkpoint left by a former attempt.
+func (p *PostProcessor) uploadFile(ctx context.Context, ui packersdk.Ui, bucket *oss.Bucket, source string, objectKey string) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+
+	partSize := ossPartSize(info.Size(), int64(p.config.OSSPartSize)*mib)
+	if partSize != int64(p.config.OSSPartSize)*mib {
+		log.Printf("Raising the part size to %d bytes to upload %d bytes in at most %d parts", partSize, info.Size(), ossMaxParts)
+	}
+
+	checkpointDir := p.config.OSSCheckpointDir
+	if checkpointDir == "" {
+		checkpointDir = filepath.Dir(source)
+	}
+
+	// 中断构建时停止正在上传的分片，检查点仍然可以用于恢复上传
+	bucket, err = contextBucket(ctx, bucket)
+	if err != nil {
+		return err
+	}
+
+	listener := &ossProgressListener{ui: ui, interval: ossProgressInterval}
+	options := []oss.Option{
+		oss.Routines(p.config.OSSUploadConcurrency),
+		oss.CheckpointDir(true, checkpointDir),
+		oss.Progress(listener),
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = bucket.UploadFile(objectKey, source, partSize, options...)
+		if err == nil || attempt == ossUploadAttempts {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		ui.Message(fmt.Sprintf("Upload interrupted, resuming from the checkpoint in %s: %s", checkpointDir, err))
+	}
+}
+
+// contextBucket returns a copy of bucket whose requests are cancelled with
+// ctx. The SDK takes no context for the parts uploaded by UploadFile, so the
+// copy is given a transport binding the requests to ctx, with the timeouts of
+// the transport the SDK creates.
+func contextBucket(ctx context.Context, bucket *oss.Bucket) (*oss.Bucket, error) {
+	config := bucket.Client.Config
+	timeout := config.HTTPTimeout
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialer := net.Dialer{
+				Timeout:   timeout.ConnectTimeout,
+				KeepAlive: 30 * time.Second,
+			}
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &ossConn{Conn: conn, timeout: timeout.ReadWriteTimeout}, nil
+		},
+		MaxIdleConns:          config.HTTPMaxConns.MaxIdleConns,
+		MaxIdleConnsPerHost:   config.HTTPMaxConns.MaxIdleConnsPerHost,
+		IdleConnTimeout:       timeout.IdleConnTimeout,
+		ResponseHeaderTimeout: timeout.HeaderTimeout,
+	}
+
+	client, err := oss.New(config.Endpoint, "", "",
+		oss.SetCredentialsProvider(config.CredentialsProvider),
+		oss.UserAgent(config.UserAgent),
+		oss.HTTPClient(&http.Client{Transport: &contextTransport{ctx: ctx, transport: transport}}))
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Bucket(bucket.BucketName)
+}
+
+// contextTransport sends the requests with ctx.
+type contextTransport struct {
+	ctx       context.Context
+	transport http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	return t.transport.RoundTrip(request.WithContext(t.ctx))
+}
+
+// ossConn fails the reads and writes stalled for longer than timeout.
+type ossConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *ossConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *ossConn) Write(b []byte) (int, error) {
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+// ossPartSize returns the part size uploading size bytes in at most
+// ossMaxParts parts, rounded up to a whole MiB.
+func ossPartSize(size, partSize int64) int64 {
+	if size <= partSize*ossMaxParts {
+		return partSize
+	}
+
+	minPartSize := (size + ossMaxParts - 1) / ossMaxParts
+	return (minPartSize + mib - 1) / mib * mib
+}
+
+// verifyUpload compares the size and the CRC64 of the uploaded object with
+// the ones of the local file.
+func verifyUpload(bucket *oss.Bucket, objectKey string, source string) error {
+	meta, err := bucket.GetObjectDetailedMeta(objectKey)
+	if err != nil {
+		return err
+	}
+
+	return verifyObjectMeta(meta, source)
+}
+
+// verifyObjectMeta compares the size and the CRC64 of the object meta with
+// the ones of the local file.
+func verifyObjectMeta(meta http.Header, source string) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := crc64.New(crc64.MakeTable(crc64.ECMA))
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+
+	objectSize, err := strconv.ParseInt(meta.Get(oss.HTTPHeaderContentLength), 10, 64)
+	if err != nil {
+		return fmt.Errorf("Unexpected object size %q: %s", meta.Get(oss.HTTPHeaderContentLength), err)
+	}
+	if objectSize != size {
+		return fmt.Errorf("The object has %d bytes while the file has %d bytes", objectSize, size)
+	}
+
+	// OSS 对分片上传的对象同样返回 CRC64
+	if value := meta.Get(oss.HTTPHeaderOssCRC64); value != "" {
+		objectCRC, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Unexpected object CRC64 %q: %s", value, err)
+		}
+		if objectCRC != hash.Sum64() {
+			return fmt.Errorf("The object CRC64 %d differs from the file CRC64 %d", objectCRC, hash.Sum64())
+		}
+	} else {
+		log.Printf("The object has no CRC64, only its size was verified")
+	}
+
+	return nil
+}
+
+// ossProgressListener reports the progress of an upload at most once per
+// interval.
+type ossProgressListener struct {
+	ui       packersdk.Ui
+	interval time.Duration
+
+	lock       sync.Mutex
+	lastReport time.Time
+}
+
+func (l *ossProgressListener) ProgressChanged(event *oss.ProgressEvent) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	switch event.EventType {
+	case oss.TransferStartedEvent:
+		l.lastReport = time.Now()
+	case oss.TransferDataEvent:
+		if time.Since(l.lastReport) < l.interval || event.TotalBytes == 0 {
+			return
+		}
+		l.lastReport = time.Now()
+		l.ui.Message(fmt.Sprintf("Uploaded %d of %d MiB (%d%%)",
+			event.ConsumedBytes/mib, event.TotalBytes/mib, event.ConsumedBytes*100/event.TotalBytes))
+	case oss.TransferCompletedEvent:
+		l.ui.Message(fmt.Sprintf("Uploaded %d MiB", event.TotalBytes/mib))
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package alicloudimport
+
+import (
+	"context"
+	"errors"
+	"hash/crc64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestOSSPartSize(t *testing.T) {
+	cases := []struct {
+		size     int64
+		partSize int64
+		expected int64
+	}{
+		{size: 0, partSize: 64 * mib, expected: 64 * mib},
+		{size: 40 * 1024 * mib, partSize: 64 * mib, expected: 64 * mib},
+		{size: ossMaxParts * 64 * mib, partSize: 64 * mib, expected: 64 * mib},
+		{size: ossMaxParts*64*mib + 1, partSize: 64 * mib, expected: 65 * mib},
+		{size: 1024 * 1024 * mib, partSize: 1 * mib, expected: 105 * mib},
+	}
+
+	for _, c := range cases {
+		if actual := ossPartSize(c.size, c.partSize); actual != c.expected {
+			t.Fatalf("bad: part size of %d bytes, expected %d, actual %d", c.size, c.expected, actual)
+		}
+	}
+}
+
+func TestVerifyObjectMeta(t *testing.T) {
+	content := []byte("packer disk image")
+	source := filepath.Join(t.TempDir(), "disk.raw")
+	if err := os.WriteFile(source, content, 0644); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	crc := crc64.Checksum(content, crc64.MakeTable(crc64.ECMA))
+
+	cases := []struct {
+		name  string
+		size  string
+		crc   string
+		error string
+	}{
+		{name: "matching", size: strconv.Itoa(len(content)), crc: strconv.FormatUint(crc, 10)},
+		{name: "no CRC64", size: strconv.Itoa(len(content))},
+		{name: "size mismatch", size: strconv.Itoa(len(content) - 1), crc: strconv.FormatUint(crc, 10), error: "bytes while the file has"},
+		{name: "CRC64 mismatch", size: strconv.Itoa(len(content)), crc: strconv.FormatUint(crc+1, 10), error: "differs from the file CRC64"},
+		{name: "bad size", size: "unknown", error: "Unexpected object size"},
+		{name: "bad CRC64", size: strconv.Itoa(len(content)), crc: "unknown", error: "Unexpected object CRC64"},
+	}
+
+	for _, c := range cases {
+		meta := http.Header{}
+		meta.Set(oss.HTTPHeaderContentLength, c.size)
+		if c.crc != "" {
+			meta.Set(oss.HTTPHeaderOssCRC64, c.crc)
+		}
+
+		err := verifyObjectMeta(meta, source)
+		if c.error == "" && err != nil {
+			t.Fatalf("%s: should not have error: %s", c.name, err)
+		}
+		if c.error != "" && (err == nil || !strings.Contains(err.Error(), c.error)) {
+			t.Fatalf("%s: expected error %q, actual %v", c.name, c.error, err)
+		}
+	}
+}
+
+func TestUploadFile_Cancelled(t *testing.T) {
+	uploading := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["uploads"]; ok {
+			w.Header().Set("Content-Type", "application/xml")
+			_, _ = w.Write([]byte("<InitiateMultipartUploadResult><Bucket>bucket</Bucket>" +
+				"<Key>disk.raw</Key><UploadId>upload</UploadId></InitiateMultipartUploadResult>"))
+			return
+		}
+
+		// The parts hang until their request is cancelled.
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case uploading <- struct{}{}:
+		default:
+		}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client, err := oss.New(server.URL, "access_key", "secret_key")
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	bucket, err := client.Bucket("bucket")
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	source := filepath.Join(t.TempDir(), "disk.raw")
+	if err := os.WriteFile(source, make([]byte, 2*mib), 0644); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	p := &PostProcessor{}
+	p.config.OSSPartSize = 1
+	p.config.OSSUploadConcurrency = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- p.uploadFile(ctx, packersdk.TestUi(t), bucket, source, "disk.raw")
+	}()
+
+	<-uploading
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("bad: expected the upload to be cancelled, actual: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the parts being uploaded should have been cancelled")
+	}
+}
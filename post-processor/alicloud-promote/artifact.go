@@ -0,0 +1,95 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package alicloudpromote
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Image is a promoted image, or one of its copies.
+type Image struct {
+	// The account owning the image, empty for the account of the
+	// post-processor.
+	AccountId string
+	RegionId  string
+	ImageId   string
+}
+
+// Artifact is the images promoted in the account of the post-processor and
+// copied into the other accounts.
+type Artifact struct {
+	Images []Image
+
+	// StateData should store data such as GeneratedData
+	// to be shared with post-processors
+	StateData map[string]interface{}
+}
+
+func (*Artifact) BuilderId() string {
+	return BuilderId
+}
+
+func (*Artifact) Files() []string {
+	// We have no files
+	return nil
+}
+
+// Id lists the images in the account of the post-processor, formatted as
+// region:image-id like the artifacts of the alicloud-ecs builder.
+func (a *Artifact) Id() string {
+	var parts []string
+	for _, image := range sortedImages(a.Images) {
+		if image.AccountId == "" {
+			parts = append(parts, fmt.Sprintf("%s:%s", image.RegionId, image.ImageId))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func (a *Artifact) String() string {
+	var lines []string
+	for _, image := range sortedImages(a.Images) {
+		if image.AccountId == "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", image.RegionId, image.ImageId))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s/%s: %s", image.AccountId, image.RegionId, image.ImageId))
+		}
+	}
+	return fmt.Sprintf("Alicloud images were promoted:\n\n%s", strings.Join(lines, "\n"))
+}
+
+func (a *Artifact) State(name string) interface{} {
+	return a.StateData[name]
+}
+
+// Destroy leaves the images alone: the promoted images were not created by
+// the build, and their copies are meant to outlive it.
+func (*Artifact) Destroy() error {
+	return nil
+}
+
+// addImages adds the images of every region of the account.
+func (a *Artifact) addImages(accountId string, images map[string]string) {
+	for regionId, imageId := range images {
+		a.Images = append(a.Images, Image{AccountId: accountId, RegionId: regionId, ImageId: imageId})
+	}
+}
+
+// sortedImages returns the images sorted by account, region and ID.
+func sortedImages(images []Image) []Image {
+	sorted := make([]Image, len(images))
+	copy(sorted, images)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].AccountId != sorted[j].AccountId {
+			return sorted[i].AccountId < sorted[j].AccountId
+		}
+		if sorted[i].RegionId != sorted[j].RegionId {
+			return sorted[i].RegionId < sorted[j].RegionId
+		}
+		return sorted[i].ImageId < sorted[j].ImageId
+	})
+	return sorted
+}
@@ -0,0 +1,293 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,AlicloudImageCopyAccount
+//go:generate packer-sdc struct-markdown
+
+package alicloudpromote
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	packerecs "github.com/hashicorp/packer-plugin-alicloud/builder/ecs"
+	alicloudimport "github.com/hashicorp/packer-plugin-alicloud/post-processor/alicloud-import"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+)
+
+const (
+	BuilderId = "packer.post-processor.alicloud-promote"
+
+	defaultRamSessionName = "packer-promote"
+)
+
+// AlicloudImageCopyAccount is an account the images are copied into, after
+// they have been shared with it, so that the account owns its images.
+type AlicloudImageCopyAccount struct {
+	// The ID of the account.
+	AccountId string `mapstructure:"account_id" required:"true"`
+	// The ARN of the RAM role of the account which copies the images, e.g.
+	// `acs:ram::123456:role/packer`. It is assumed with the access key of the
+	// post-processor.
+	RamRoleArn string `mapstructure:"ram_role_arn" required:"true"`
+	// The session name of the assumed role. The default value is
+	// `packer-promote`.
+	RamSessionName string `mapstructure:"ram_session_name" required:"false"`
+	// The regions of the account the images are copied to. Defaults to the
+	// region of the images.
+	Regions []string `mapstructure:"regions" required:"false"`
+	// The name of the copies. It can only be set when a single image is
+	// promoted.
+	Name string `mapstructure:"name" required:"false"`
+	// Key/value pair tags applied to the copies and their snapshots.
+	Tags map[string]string `mapstructure:"tags" required:"false"`
+}
+
+// Configuration of this post processor
+type Config struct {
+	common.PackerConfig            `mapstructure:",squash"`
+	packerecs.AlicloudAccessConfig `mapstructure:",squash"`
+
+	// The IDs of the images of `region` to promote. When they are set, the
+	// artifact is ignored, so that the post-processor can follow any
+	// builder. Defaults to the images of the artifact in `region`.
+	ImageIds []string `mapstructure:"image_ids" required:"false"`
+	// Key/value pair tags applied to the images, their copies and their
+	// snapshots.
+	Tags map[string]string `mapstructure:"tags" required:"false"`
+	// Same as [`tags`](#tags) but defined as a singular repeatable block
+	// containing a `key` and a `value` field. In HCL2 mode the
+	// [`dynamic_block`](/packer/docs/templates/hcl_templates/expressions#dynamic-blocks)
+	// will allow you to create those programatically.
+	Tag config.KeyValues `mapstructure:"tag" required:"false"`
+	// Key/value pair tags applied to the copies in a region, overriding the
+	// tags of the same keys of `tags`.
+	RegionTags map[string]map[string]string `mapstructure:"image_region_tags" required:"false"`
+	// The regions the images are copied to, as for the `alicloud-ecs`
+	// builder. The names of the copies can only be set when a single image
+	// is promoted.
+	CopyRegions []packerecs.AlicloudImageCopyRegion `mapstructure:"image_copy_region" required:"false"`
+	// Whether the post-processor waits for the copies to be available. The
+	// default value is false.
+	WaitForCopiedImages bool `mapstructure:"wait_for_copied_images" required:"false"`
+	// The number of regions the images are copied to at the same time. The
+	// default value is 4.
+	ImageCopyConcurrency int `mapstructure:"image_copy_concurrency" required:"false"`
+	// The IDs of the accounts the images and their copies are shared with.
+	ShareAccounts []string `mapstructure:"image_share_account" required:"false"`
+	// The IDs of the accounts the images and their copies are no longer
+	// shared with.
+	UnshareAccounts []string `mapstructure:"image_unshare_account" required:"false"`
+	// The accounts the images are copied into, after they have been shared
+	// with them.
+	CopyAccounts []AlicloudImageCopyAccount `mapstructure:"image_copy_account" required:"false"`
+
+	ctx interpolate.Context
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         BuilderId,
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	errs := new(packersdk.MultiError)
+	errs = packersdk.MultiErrorAppend(errs, p.config.AlicloudAccessConfig.Prepare(&p.config.ctx)...)
+	errs = packersdk.MultiErrorAppend(errs, p.config.Tag.CopyOn(&p.config.Tags)...)
+	errs = packersdk.MultiErrorAppend(errs, packerecs.PrepareCopyRegions(p.config.CopyRegions, config.TriUnset, "")...)
+
+	if p.config.ImageCopyConcurrency < 0 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("image_copy_concurrency can't be negative"))
+	}
+
+	accountIds := make(map[string]struct{})
+	for i := range p.config.CopyAccounts {
+		account := &p.config.CopyAccounts[i]
+		if account.AccountId == "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("account_id must be specified in image_copy_account"))
+			continue
+		}
+		if _, ok := accountIds[account.AccountId]; ok {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("image_copy_account %s is specified more than once", account.AccountId))
+		}
+		accountIds[account.AccountId] = struct{}{}
+
+		if account.RamRoleArn == "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("ram_role_arn must be specified in image_copy_account %s", account.AccountId))
+		}
+		if account.RamSessionName == "" {
+			account.RamSessionName = defaultRamSessionName
+		}
+	}
+
+	if len(p.config.ImageIds) > 1 && p.namedCopies() {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("The names of the copies can only be specified when a single image is promoted"))
+	}
+
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+
+	packersdk.LogSecretFilter.Set(p.config.AlicloudAccessKey, p.config.AlicloudSecretKey)
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, artifact packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
+	imageIds := p.config.ImageIds
+	if len(imageIds) == 0 {
+		var err error
+		if imageIds, err = p.artifactImages(artifact); err != nil {
+			return nil, false, false, err
+		}
+		if len(imageIds) > 1 && p.namedCopies() {
+			return nil, false, false, fmt.Errorf("The artifact has %d images in %s, while the names of the copies can only be specified when a single image is promoted", len(imageIds), p.config.AlicloudRegion)
+		}
+	}
+
+	client, err := p.config.Client()
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Failed to connect alicloud ecs %s", err)
+	}
+
+	promoted := &Artifact{
+		StateData: map[string]interface{}{"generated_data": artifact.State("generated_data")},
+	}
+	imageConfig := p.imageConfig()
+	for _, imageId := range imageIds {
+		ui.Say(fmt.Sprintf("Promoting image %s in %s", imageId, p.config.AlicloudRegion))
+
+		images, err := packerecs.PromoteImage(ctx, ui, imageConfig, client, imageId)
+		if err != nil {
+			return nil, false, false, fmt.Errorf("Failed to promote image %s: %s", imageId, err)
+		}
+		promoted.addImages("", images)
+
+		for i := range p.config.CopyAccounts {
+			account := &p.config.CopyAccounts[i]
+			ui.Say(fmt.Sprintf("Copying image %s into account %s", imageId, account.AccountId))
+
+			accountClient, err := p.config.AlicloudAccessConfig.AssumeRole(account.RamRoleArn, account.RamSessionName).Client()
+			if err != nil {
+				return nil, false, false, fmt.Errorf("Failed to connect alicloud ecs of account %s: %s", account.AccountId, err)
+			}
+
+			copies, err := packerecs.CopySharedImage(ctx, ui, p.accountImageConfig(account), accountClient, p.config.AlicloudRegion, imageId)
+			if err != nil {
+				return nil, false, false, fmt.Errorf("Failed to copy image %s into account %s: %s", imageId, account.AccountId, err)
+			}
+			promoted.addImages(account.AccountId, copies)
+		}
+	}
+
+	// The images of the artifact are kept whatever keep_input_artifact says.
+	return promoted, true, true, nil
+}
+
+// artifactImages returns the images of the artifact in the region. The
+// artifact may come through RPC, so its images are read from its ID
+// formatted as region:image-id,region:image-id.
+func (p *PostProcessor) artifactImages(artifact packersdk.Artifact) ([]string, error) {
+	if !packerecs.ContainsInArray([]string{packerecs.BuilderId, alicloudimport.BuilderId, BuilderId}, artifact.BuilderId()) {
+		return nil, fmt.Errorf("Unknown artifact type: %s\nCan only promote images of the alicloud-ecs builder or the alicloud-import and alicloud-promote post-processors, unless image_ids is specified", artifact.BuilderId())
+	}
+
+	var imageIds []string
+	for _, part := range strings.Split(artifact.Id(), ",") {
+		regionId, imageId, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("Unexpected image %q in artifact %s", part, artifact.Id())
+		}
+		if regionId == p.config.AlicloudRegion {
+			imageIds = append(imageIds, imageId)
+		}
+	}
+
+	if len(imageIds) == 0 {
+		return nil, fmt.Errorf("The artifact %s has no image in region %s", artifact.Id(), p.config.AlicloudRegion)
+	}
+	return imageIds, nil
+}
+
+// namedCopies reports whether the names of some copies are specified. The
+// names of the images of a region are unique, so that the copies of several
+// images cannot have the same name.
+func (p *PostProcessor) namedCopies() bool {
+	for _, copyRegion := range p.config.CopyRegions {
+		if copyRegion.Name != "" {
+			return true
+		}
+	}
+	for _, account := range p.config.CopyAccounts {
+		if account.Name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// imageConfig returns the image options of the builder promoting the images
+// in the account of the post-processor. The images are shared with the
+// accounts they are copied into too.
+func (p *PostProcessor) imageConfig() *packerecs.Config {
+	imageConfig := &packerecs.Config{PackerConfig: p.config.PackerConfig}
+	imageConfig.AlicloudRegion = p.config.AlicloudRegion
+	imageConfig.AlicloudImageTags = p.config.Tags
+	imageConfig.AlicloudImageRegionTags = p.config.RegionTags
+	imageConfig.AlicloudImageCopyRegions = p.config.CopyRegions
+	imageConfig.WaitForCopiedImages = p.config.WaitForCopiedImages
+	imageConfig.ImageCopyConcurrency = p.config.ImageCopyConcurrency
+	imageConfig.AlicloudImageShareAccounts = append([]string{}, p.config.ShareAccounts...)
+	imageConfig.AlicloudImageUNShareAccounts = p.config.UnshareAccounts
+	for _, account := range p.config.CopyAccounts {
+		if !packerecs.ContainsInArray(imageConfig.AlicloudImageShareAccounts, account.AccountId) {
+			imageConfig.AlicloudImageShareAccounts = append(imageConfig.AlicloudImageShareAccounts, account.AccountId)
+		}
+	}
+	return imageConfig
+}
+
+// accountImageConfig returns the image options of the builder copying the
+// shared images into the account.
+func (p *PostProcessor) accountImageConfig(account *AlicloudImageCopyAccount) *packerecs.Config {
+	regions := account.Regions
+	if len(regions) == 0 {
+		regions = []string{p.config.AlicloudRegion}
+	}
+
+	imageConfig := &packerecs.Config{PackerConfig: p.config.PackerConfig}
+	imageConfig.AlicloudRegion = p.config.AlicloudRegion
+	imageConfig.AlicloudImageTags = account.Tags
+	imageConfig.WaitForCopiedImages = p.config.WaitForCopiedImages
+	imageConfig.ImageCopyConcurrency = p.config.ImageCopyConcurrency
+	for _, region := range regions {
+		if !containsCopyRegion(imageConfig.AlicloudImageCopyRegions, region) {
+			imageConfig.AlicloudImageCopyRegions = append(imageConfig.AlicloudImageCopyRegions,
+				packerecs.AlicloudImageCopyRegion{Region: region, Name: account.Name})
+		}
+	}
+	return imageConfig
+}
+
+func containsCopyRegion(copyRegions []packerecs.AlicloudImageCopyRegion, region string) bool {
+	for _, copyRegion := range copyRegions {
+		if copyRegion.Region == region {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package alicloudpromote
+
+import (
+	"reflect"
+	"testing"
+
+	packerecs "github.com/hashicorp/packer-plugin-alicloud/builder/ecs"
+)
+
+func testPostProcessorConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"access_key":          "foo",
+		"secret_key":          "bar",
+		"region":              "cn-beijing",
+		"tags":                map[string]string{"Stage": "prod"},
+		"image_share_account": []string{"111111"},
+		"image_copy_region": []map[string]interface{}{
+			{"region": "cn-hangzhou"},
+		},
+		"image_copy_account": []map[string]interface{}{
+			{"account_id": "222222", "ram_role_arn": "acs:ram::222222:role/packer", "regions": []string{"cn-shanghai"}},
+		},
+	}
+}
+
+func TestPostProcessorConfigure(t *testing.T) {
+	p := &PostProcessor{}
+	if err := p.Configure(testPostProcessorConfig()); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if p.config.CopyAccounts[0].RamSessionName != defaultRamSessionName {
+		t.Fatalf("bad: expected default session name %s, actual %s", defaultRamSessionName, p.config.CopyAccounts[0].RamSessionName)
+	}
+
+	// 镜像须共享给复制它的账号
+	imageConfig := p.imageConfig()
+	if !reflect.DeepEqual(imageConfig.AlicloudImageShareAccounts, []string{"111111", "222222"}) {
+		t.Fatalf("bad: the images should be shared with the copy accounts, actual %v", imageConfig.AlicloudImageShareAccounts)
+	}
+	if !reflect.DeepEqual(p.config.ShareAccounts, []string{"111111"}) {
+		t.Fatalf("bad: image_share_account should not change, actual %v", p.config.ShareAccounts)
+	}
+
+	accountConfig := p.accountImageConfig(&p.config.CopyAccounts[0])
+	if !reflect.DeepEqual(accountConfig.AlicloudImageCopyRegions, []packerecs.AlicloudImageCopyRegion{{Region: "cn-shanghai"}}) {
+		t.Fatalf("bad: the image should be copied to the regions of the account, actual %v", accountConfig.AlicloudImageCopyRegions)
+	}
+	if accountConfig.AlicloudRegion != "cn-beijing" {
+		t.Fatalf("bad: the image should be copied from its region, actual %s", accountConfig.AlicloudRegion)
+	}
+}
+
+func TestPostProcessorConfigure_defaultAccountRegion(t *testing.T) {
+	config := testPostProcessorConfig()
+	config["image_copy_account"] = []map[string]interface{}{
+		{"account_id": "222222", "ram_role_arn": "acs:ram::222222:role/packer"},
+	}
+
+	p := &PostProcessor{}
+	if err := p.Configure(config); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	accountConfig := p.accountImageConfig(&p.config.CopyAccounts[0])
+	if !reflect.DeepEqual(accountConfig.AlicloudImageCopyRegions, []packerecs.AlicloudImageCopyRegion{{Region: "cn-beijing"}}) {
+		t.Fatalf("bad: the image should be copied to its own region by default, actual %v", accountConfig.AlicloudImageCopyRegions)
+	}
+}
+
+func TestPostProcessorConfigure_Invalid(t *testing.T) {
+	for name, override := range map[string]map[string]interface{}{
+		"negative concurrency": {"image_copy_concurrency": -1},
+		"duplicated region": {"image_copy_region": []map[string]interface{}{
+			{"region": "cn-hangzhou"}, {"region": "cn-hangzhou"},
+		}},
+		"no account id": {"image_copy_account": []map[string]interface{}{
+			{"ram_role_arn": "acs:ram::222222:role/packer"},
+		}},
+		"no role": {"image_copy_account": []map[string]interface{}{
+			{"account_id": "222222"},
+		}},
+		"duplicated account": {"image_copy_account": []map[string]interface{}{
+			{"account_id": "222222", "ram_role_arn": "acs:ram::222222:role/packer"},
+			{"account_id": "222222", "ram_role_arn": "acs:ram::222222:role/packer"},
+		}},
+		"names of several images": {
+			"image_ids":         []string{"m-1", "m-2"},
+			"image_copy_region": []map[string]interface{}{{"region": "cn-hangzhou", "name": "prod"}},
+		},
+	} {
+		config := testPostProcessorConfig()
+		for key, value := range override {
+			config[key] = value
+		}
+
+		p := &PostProcessor{}
+		if err := p.Configure(config); err == nil {
+			t.Fatalf("%s should have error", name)
+		}
+	}
+}
+
+func TestArtifactImages(t *testing.T) {
+	p := &PostProcessor{}
+	if err := p.Configure(testPostProcessorConfig()); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	imageIds, err := p.artifactImages(&packerecs.Artifact{
+		AlicloudImages: map[string]string{"cn-beijing": "m-bj", "cn-hangzhou": "m-hz"},
+		BuilderIdValue: packerecs.BuilderId,
+	})
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if !reflect.DeepEqual(imageIds, []string{"m-bj"}) {
+		t.Fatalf("bad: expected the image of the region, actual %v", imageIds)
+	}
+
+	if _, err := p.artifactImages(&packerecs.Artifact{
+		AlicloudImages: map[string]string{"cn-hangzhou": "m-hz"},
+		BuilderIdValue: packerecs.BuilderId,
+	}); err == nil {
+		t.Fatalf("should have error: the artifact has no image in the region")
+	}
+	if _, err := p.artifactImages(&packerecs.Artifact{
+		AlicloudImages: map[string]string{"cn-beijing": "m-bj"},
+		BuilderIdValue: "packer.file",
+	}); err == nil {
+		t.Fatalf("should have error: unknown artifact")
+	}
+}
+
+func TestArtifact(t *testing.T) {
+	a := &Artifact{}
+	a.addImages("", map[string]string{"cn-hangzhou": "m-hz", "cn-beijing": "m-bj"})
+	a.addImages("222222", map[string]string{"cn-beijing": "m-copy"})
+
+	if a.Id() != "cn-beijing:m-bj,cn-hangzhou:m-hz" {
+		t.Fatalf("bad: the id should only list the images of the account, actual %s", a.Id())
+	}
+	expected := "Alicloud images were promoted:\n\ncn-beijing: m-bj\ncn-hangzhou: m-hz\n222222/cn-beijing: m-copy"
+	if a.String() != expected {
+		t.Fatalf("bad: expected %q, actual %q", expected, a.String())
+	}
+}
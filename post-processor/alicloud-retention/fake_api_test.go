@@ -0,0 +1,209 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package alicloudretention
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	packerecs "github.com/hashicorp/packer-plugin-alicloud/builder/ecs"
+)
+
+const fakeAPIRegion = "cn-beijing"
+
+// fakeAlicloudAPI is an in-process fake of the ECS image endpoints used by
+// the post-processor. It pages DescribeImages as the real API does.
+type fakeAlicloudAPI struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	actions   []string
+	images    map[string]*ecs.Image
+	shares    map[string][]string
+	snapshots map[string]bool
+}
+
+// newFakeAlicloudAPI starts a fake API server holding the given images of
+// fakeAPIRegion. The server is closed when the test ends.
+func newFakeAlicloudAPI(t *testing.T, images ...ecs.Image) *fakeAlicloudAPI {
+	f := &fakeAlicloudAPI{
+		images:    map[string]*ecs.Image{},
+		shares:    map[string][]string{},
+		snapshots: map[string]bool{},
+	}
+	for i := range images {
+		image := images[i]
+		f.images[image.ImageId] = &image
+		for _, diskDevice := range image.DiskDeviceMappings.DiskDeviceMapping {
+			f.snapshots[diskDevice.SnapshotId] = true
+		}
+	}
+
+	f.Server = httptest.NewServer(f)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// Client returns an ECS client sending its requests to the fake API.
+func (f *fakeAlicloudAPI) Client(t *testing.T) *packerecs.ClientWrapper {
+	client, err := ecs.NewClientWithAccessKey(fakeAPIRegion, "access_key", "secret_key")
+	if err != nil {
+		t.Fatalf("Error creating ecs client: %s", err)
+	}
+	client.Domain = f.Listener.Addr().String()
+	return &packerecs.ClientWrapper{ECSClient: client}
+}
+
+// Share shares an image with the given accounts.
+func (f *fakeAlicloudAPI) Share(imageId string, accounts ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.shares[imageId] = append(f.shares[imageId], accounts...)
+}
+
+// Called reports how many times the given action was called.
+func (f *fakeAlicloudAPI) Called(action string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for _, a := range f.actions {
+		if a == action {
+			count++
+		}
+	}
+	return count
+}
+
+// Actions returns the actions called so far, in order.
+func (f *fakeAlicloudAPI) Actions() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.actions...)
+}
+
+// Image returns the image with the given ID, if it was not deleted.
+func (f *fakeAlicloudAPI) Image(imageId string) (ecs.Image, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	image, ok := f.images[imageId]
+	if !ok {
+		return ecs.Image{}, false
+	}
+	return *image, true
+}
+
+// Snapshot reports whether the snapshot still exists.
+func (f *fakeAlicloudAPI) Snapshot(snapshotId string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.snapshots[snapshotId]
+}
+
+func (f *fakeAlicloudAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	action := r.Form.Get("Action")
+	f.actions = append(f.actions, action)
+
+	response, err := f.handle(action, r.Form)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"Code":      "InvalidParameter",
+			"Message":   err.Error(),
+			"RequestId": "request",
+		})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (f *fakeAlicloudAPI) handle(action string, form url.Values) (interface{}, error) {
+	switch action {
+	case "DescribeImages":
+		return f.describeImages(form)
+	case "DescribeImageSharePermission":
+		response := &ecs.DescribeImageSharePermissionResponse{RequestId: "request", ImageId: form.Get("ImageId")}
+		for _, account := range f.shares[form.Get("ImageId")] {
+			response.Accounts.Account = append(response.Accounts.Account, ecs.Account{AliyunId: account})
+		}
+		return response, nil
+	case "ModifyImageSharePermission":
+		for i := 1; form.Get(fmt.Sprintf("RemoveAccount.%d", i)) != ""; i++ {
+			account := form.Get(fmt.Sprintf("RemoveAccount.%d", i))
+			var accounts []string
+			for _, shared := range f.shares[form.Get("ImageId")] {
+				if shared != account {
+					accounts = append(accounts, shared)
+				}
+			}
+			f.shares[form.Get("ImageId")] = accounts
+		}
+		return &ecs.ModifyImageSharePermissionResponse{RequestId: "request"}, nil
+	case "ModifyImageAttribute":
+		image, ok := f.images[form.Get("ImageId")]
+		if !ok {
+			return nil, fmt.Errorf("image %s not found", form.Get("ImageId"))
+		}
+		image.Status = form.Get("Status")
+		return &ecs.ModifyImageAttributeResponse{RequestId: "request"}, nil
+	case "DeleteImage":
+		imageId := form.Get("ImageId")
+		if _, ok := f.images[imageId]; !ok {
+			return nil, fmt.Errorf("image %s not found", imageId)
+		}
+		if len(f.shares[imageId]) > 0 && form.Get("Force") != "true" {
+			return nil, fmt.Errorf("image %s is shared", imageId)
+		}
+		delete(f.images, imageId)
+		return &ecs.DeleteImageResponse{RequestId: "request"}, nil
+	case "DeleteSnapshot":
+		delete(f.snapshots, form.Get("SnapshotId"))
+		return &ecs.DeleteSnapshotResponse{RequestId: "request"}, nil
+	}
+	return nil, fmt.Errorf("unsupported action %s", action)
+}
+
+func (f *fakeAlicloudAPI) describeImages(form url.Values) (interface{}, error) {
+	var matched []ecs.Image
+	for _, image := range f.images {
+		if !packerecs.ContainsInArray(strings.Split(form.Get("Status"), ","), image.Status) ||
+			(form.Get("ImageFamily") != "" && form.Get("ImageFamily") != image.ImageFamily) {
+			continue
+		}
+		matched = append(matched, *image)
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ImageId < matched[j].ImageId })
+
+	pageNumber, _ := strconv.Atoi(form.Get("PageNumber"))
+	pageSize, _ := strconv.Atoi(form.Get("PageSize"))
+	start := min((pageNumber-1)*pageSize, len(matched))
+	end := min(start+pageSize, len(matched))
+
+	response := &ecs.DescribeImagesResponse{
+		RequestId:  "request",
+		RegionId:   form.Get("RegionId"),
+		TotalCount: len(matched),
+		PageNumber: pageNumber,
+		PageSize:   pageSize,
+	}
+	response.Images.Image = matched[start:end]
+	return response, nil
+}
@@ -0,0 +1,316 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+//go:generate packer-sdc struct-markdown
+
+package alicloudretention
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	packerecs "github.com/hashicorp/packer-plugin-alicloud/builder/ecs"
+	alicloudimport "github.com/hashicorp/packer-plugin-alicloud/post-processor/alicloud-import"
+	alicloudpromote "github.com/hashicorp/packer-plugin-alicloud/post-processor/alicloud-promote"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+)
+
+const (
+	BuilderId = "packer.post-processor.alicloud-retention"
+
+	ActionDeprecate = "deprecate"
+	ActionDelete    = "delete"
+
+	describeImagesPageSize = 100
+)
+
+// Configuration of this post processor
+type Config struct {
+	common.PackerConfig            `mapstructure:",squash"`
+	packerecs.AlicloudAccessConfig `mapstructure:",squash"`
+
+	// The number of the newest images kept in each region of the artifact.
+	// The images of the artifact itself are always kept and count towards
+	// this number. It must be at least 1.
+	KeepLatest int `mapstructure:"keep_latest" required:"true"`
+	// Selects the images whose name starts with this prefix.
+	ImageNamePrefix string `mapstructure:"image_name_prefix" required:"false"`
+	// Selects the images of this image family.
+	ImageFamily string `mapstructure:"image_family" required:"false"`
+	// Selects the images carrying these key/value pair tags.
+	Tags map[string]string `mapstructure:"tags" required:"false"`
+	// Same as [`tags`](#tags) but defined as a singular repeatable block
+	// containing a `key` and a `value` field. In HCL2 mode the
+	// [`dynamic_block`](/packer/docs/templates/hcl_templates/expressions#dynamic-blocks)
+	// will allow you to create those programatically.
+	Tag config.KeyValues `mapstructure:"tag" required:"false"`
+	// What is done with the older images: `deprecate` marks them as
+	// deprecated so that no new instance can be created from them, `delete`
+	// deletes them. The default value is `deprecate`.
+	Action string `mapstructure:"action" required:"false"`
+	// Whether the snapshots of the deleted images are deleted too. The
+	// default value is false.
+	DeleteSnapshots bool `mapstructure:"delete_snapshots" required:"false"`
+	// Whether the images shared with other accounts are retired too. The
+	// sharing of a deleted image is revoked first. By default the shared
+	// images are kept.
+	IncludeShared bool `mapstructure:"include_shared" required:"false"`
+	// Only reports the images which would be retired, without changing
+	// anything. The default value is false.
+	DryRun bool `mapstructure:"dry_run" required:"false"`
+
+	ctx interpolate.Context
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         BuilderId,
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	errs := new(packersdk.MultiError)
+	errs = packersdk.MultiErrorAppend(errs, p.config.AlicloudAccessConfig.Prepare(&p.config.ctx)...)
+	errs = packersdk.MultiErrorAppend(errs, p.config.Tag.CopyOn(&p.config.Tags)...)
+
+	if p.config.KeepLatest < 1 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("keep_latest must be at least 1"))
+	}
+
+	if p.config.ImageNamePrefix == "" && p.config.ImageFamily == "" && len(p.config.Tags) == 0 {
+		errs = packersdk.MultiErrorAppend(errs,
+			fmt.Errorf("At least one of image_name_prefix, image_family or tags must be specified"))
+	}
+
+	if p.config.Action == "" {
+		p.config.Action = ActionDeprecate
+	}
+	if p.config.Action != ActionDeprecate && p.config.Action != ActionDelete {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("action must be %s or %s", ActionDeprecate, ActionDelete))
+	}
+
+	if p.config.DeleteSnapshots && p.config.Action != ActionDelete {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("delete_snapshots can only be specified with action %s", ActionDelete))
+	}
+
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+
+	packersdk.LogSecretFilter.Set(p.config.AlicloudAccessKey, p.config.AlicloudSecretKey)
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, artifact packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
+	if !packerecs.ContainsInArray([]string{packerecs.BuilderId, alicloudimport.BuilderId, alicloudpromote.BuilderId}, artifact.BuilderId()) {
+		return nil, false, false, fmt.Errorf("Unknown artifact type: %s\nCan only retire images of the alicloud-ecs builder or the alicloud-import and alicloud-promote post-processors", artifact.BuilderId())
+	}
+
+	// The artifact may come through RPC, so its images are read from its ID
+	// formatted as region:image-id,region:image-id.
+	artifactImages := make(map[string][]string)
+	for _, part := range strings.Split(artifact.Id(), ",") {
+		regionId, imageId, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, false, false, fmt.Errorf("Unexpected image %q in artifact %s", part, artifact.Id())
+		}
+		artifactImages[regionId] = append(artifactImages[regionId], imageId)
+	}
+
+	client, err := p.config.Client()
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Failed to connect alicloud ecs %s", err)
+	}
+
+	regionIds := make([]string, 0, len(artifactImages))
+	for regionId := range artifactImages {
+		regionIds = append(regionIds, regionId)
+	}
+	sort.Strings(regionIds)
+
+	errs := new(packersdk.MultiError)
+	for _, regionId := range regionIds {
+		if err := ctx.Err(); err != nil {
+			return nil, false, false, err
+		}
+
+		images, err := p.describeImages(client, regionId)
+		if err != nil {
+			return nil, false, false, fmt.Errorf("Error querying images in %s: %s", regionId, err)
+		}
+
+		_, expired := expiredImages(images, p.config.KeepLatest, artifactImages[regionId])
+		ui.Say(fmt.Sprintf("Found %d images in %s, %d of them beyond the newest %d",
+			len(images), regionId, len(expired), p.config.KeepLatest))
+
+		for i := range expired {
+			if err := p.retireImage(ui, client, regionId, &expired[i]); err != nil {
+				errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("%s (%s): %s", expired[i].ImageId, regionId, err))
+			}
+		}
+	}
+
+	if len(errs.Errors) > 0 {
+		return nil, false, false, errs
+	}
+
+	// The images of the artifact are kept whatever keep_input_artifact says.
+	return artifact, true, true, nil
+}
+
+// describeImages lists the customized images of the region matching the
+// selectors.
+func (p *PostProcessor) describeImages(client *packerecs.ClientWrapper, regionId string) ([]ecs.Image, error) {
+	var tags []ecs.DescribeImagesTag
+	for key, value := range p.config.Tags {
+		tags = append(tags, ecs.DescribeImagesTag{Key: key, Value: value})
+	}
+
+	// Deprecated images only need to be queried to be deleted.
+	status := packerecs.ImageStatusAvailable
+	if p.config.Action == ActionDelete {
+		status = fmt.Sprintf("%s,%s", packerecs.ImageStatusAvailable, packerecs.ImageStatusDeprecated)
+	}
+
+	var images []ecs.Image
+	total := 0
+	for pageNumber := 1; ; pageNumber++ {
+		request := ecs.CreateDescribeImagesRequest()
+		request.RegionId = regionId
+		request.ImageOwnerAlias = packerecs.ImageOwnerSelf
+		request.ImageFamily = p.config.ImageFamily
+		request.Status = status
+		request.PageNumber = requests.NewInteger(pageNumber)
+		request.PageSize = requests.NewInteger(describeImagesPageSize)
+		if len(tags) > 0 {
+			request.Tag = &tags
+		}
+
+		response, err := client.DescribeImages(request)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, image := range response.Images.Image {
+			if strings.HasPrefix(image.ImageName, p.config.ImageNamePrefix) {
+				images = append(images, image)
+			}
+		}
+		total += len(response.Images.Image)
+		if len(response.Images.Image) < describeImagesPageSize || total >= response.TotalCount {
+			break
+		}
+	}
+
+	return images, nil
+}
+
+// expiredImages splits the images into the newest keep ones, always including
+// the protected images, and the older ones.
+func expiredImages(images []ecs.Image, keep int, protected []string) ([]ecs.Image, []ecs.Image) {
+	sorted := make([]ecs.Image, len(images))
+	copy(sorted, images)
+	// CreationTime is formatted as ISO 8601 in UTC, so it sorts lexically.
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreationTime > sorted[j].CreationTime
+	})
+
+	var kept, expired []ecs.Image
+	for _, image := range sorted {
+		if packerecs.ContainsInArray(protected, image.ImageId) {
+			kept = append(kept, image)
+		}
+	}
+	for _, image := range sorted {
+		if packerecs.ContainsInArray(protected, image.ImageId) {
+			continue
+		}
+		if len(kept) < keep {
+			kept = append(kept, image)
+		} else {
+			expired = append(expired, image)
+		}
+	}
+
+	return kept, expired
+}
+
+// retireImage deprecates or deletes an image, keeping it when it is shared
+// and include_shared is not set.
+func (p *PostProcessor) retireImage(ui packersdk.Ui, client *packerecs.ClientWrapper, regionId string, image *ecs.Image) error {
+	describeImageShareRequest := ecs.CreateDescribeImageSharePermissionRequest()
+	describeImageShareRequest.RegionId = regionId
+	describeImageShareRequest.ImageId = image.ImageId
+	imageShareResponse, err := client.DescribeImageSharePermission(describeImageShareRequest)
+	if err != nil {
+		return fmt.Errorf("Failed to describe image share permission: %s", err)
+	}
+
+	var accounts []string
+	for _, account := range imageShareResponse.Accounts.Account {
+		accounts = append(accounts, account.AliyunId)
+	}
+	shared := len(accounts) > 0 || len(imageShareResponse.ShareGroups.ShareGroup) > 0
+	if shared && !p.config.IncludeShared {
+		ui.Message(fmt.Sprintf("Keeping shared image %s (%s)", image.ImageId, image.ImageName))
+		return nil
+	}
+
+	prefix := ""
+	if p.config.DryRun {
+		prefix = "[dry run] "
+	}
+
+	if p.config.Action == ActionDeprecate {
+		ui.Message(fmt.Sprintf("%sDeprecating image %s (%s) created at %s", prefix, image.ImageId, image.ImageName, image.CreationTime))
+		if p.config.DryRun {
+			return nil
+		}
+
+		modifyImageAttributeRequest := ecs.CreateModifyImageAttributeRequest()
+		modifyImageAttributeRequest.RegionId = regionId
+		modifyImageAttributeRequest.ImageId = image.ImageId
+		modifyImageAttributeRequest.Status = packerecs.ImageStatusDeprecated
+		if _, err := client.ModifyImageAttribute(modifyImageAttributeRequest); err != nil {
+			return fmt.Errorf("Failed to deprecate image: %s", err)
+		}
+		return nil
+	}
+
+	ui.Message(fmt.Sprintf("%sDeleting image %s (%s) created at %s", prefix, image.ImageId, image.ImageName, image.CreationTime))
+	if p.config.DryRun {
+		return nil
+	}
+
+	if len(accounts) > 0 {
+		log.Printf("Revoking the sharing of image %s with %v", image.ImageId, accounts)
+		modifyImageShareRequest := ecs.CreateModifyImageSharePermissionRequest()
+		modifyImageShareRequest.RegionId = regionId
+		modifyImageShareRequest.ImageId = image.ImageId
+		modifyImageShareRequest.RemoveAccount = &accounts
+		if _, err := client.ModifyImageSharePermission(modifyImageShareRequest); err != nil {
+			return fmt.Errorf("Failed to revoke image share permission: %s", err)
+		}
+	}
+
+	return client.DeleteImageAndSnapshots(regionId, image, p.config.DeleteSnapshots)
+}
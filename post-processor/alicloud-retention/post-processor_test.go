@@ -0,0 +1,245 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package alicloudretention
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+	packerecs "github.com/hashicorp/packer-plugin-alicloud/builder/ecs"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func testPostProcessorConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"access_key":   "foo",
+		"secret_key":   "bar",
+		"region":       "cn-beijing",
+		"keep_latest":  3,
+		"image_family": "nightly",
+	}
+}
+
+func TestPostProcessorConfigure(t *testing.T) {
+	p := &PostProcessor{}
+	if err := p.Configure(testPostProcessorConfig()); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if p.config.Action != ActionDeprecate {
+		t.Fatalf("bad: expected default action %s, actual %s", ActionDeprecate, p.config.Action)
+	}
+}
+
+func TestPostProcessorConfigure_Invalid(t *testing.T) {
+	for name, override := range map[string]map[string]interface{}{
+		"no keep_latest":             {"keep_latest": 0},
+		"no selector":                {"image_family": ""},
+		"bad action":                 {"action": "archive"},
+		"delete_snapshots deprecate": {"delete_snapshots": true},
+	} {
+		config := testPostProcessorConfig()
+		for key, value := range override {
+			config[key] = value
+		}
+
+		p := &PostProcessor{}
+		if err := p.Configure(config); err == nil {
+			t.Fatalf("%s should have error", name)
+		}
+	}
+}
+
+func TestExpiredImages(t *testing.T) {
+	images := []ecs.Image{
+		{ImageId: "m-1", CreationTime: "2024-01-01T00:00:00Z"},
+		{ImageId: "m-4", CreationTime: "2024-01-04T00:00:00Z"},
+		{ImageId: "m-2", CreationTime: "2024-01-02T00:00:00Z"},
+		{ImageId: "m-3", CreationTime: "2024-01-03T00:00:00Z"},
+	}
+
+	kept, expired := expiredImages(images, 2, nil)
+	if len(kept) != 2 || kept[0].ImageId != "m-4" || kept[1].ImageId != "m-3" {
+		t.Fatalf("bad: the newest images should be kept, actual %v", kept)
+	}
+	if len(expired) != 2 || expired[0].ImageId != "m-2" || expired[1].ImageId != "m-1" {
+		t.Fatalf("bad: the older images should expire, actual %v", expired)
+	}
+
+	// 制品中的镜像总是保留，即使它不是最新的
+	kept, expired = expiredImages(images, 2, []string{"m-1"})
+	if len(kept) != 2 || kept[0].ImageId != "m-1" || kept[1].ImageId != "m-4" {
+		t.Fatalf("bad: the artifact image should be kept, actual %v", kept)
+	}
+	if len(expired) != 2 || expired[0].ImageId != "m-3" || expired[1].ImageId != "m-2" {
+		t.Fatalf("bad: actual %v", expired)
+	}
+}
+
+func testImage(imageId string, snapshotIds ...string) ecs.Image {
+	image := ecs.Image{
+		ImageId:      imageId,
+		ImageName:    "nightly-" + imageId,
+		ImageFamily:  "nightly",
+		Status:       packerecs.ImageStatusAvailable,
+		CreationTime: "2024-01-01T00:00:00Z",
+	}
+	for _, snapshotId := range snapshotIds {
+		image.DiskDeviceMappings.DiskDeviceMapping = append(image.DiskDeviceMappings.DiskDeviceMapping,
+			ecs.DiskDeviceMapping{SnapshotId: snapshotId})
+	}
+	return image
+}
+
+func testPostProcessor(t *testing.T, override map[string]interface{}) *PostProcessor {
+	config := testPostProcessorConfig()
+	for key, value := range override {
+		config[key] = value
+	}
+
+	p := &PostProcessor{}
+	if err := p.Configure(config); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	return p
+}
+
+func TestDescribeImages_Paginated(t *testing.T) {
+	var images []ecs.Image
+	for i := 0; i < 2*describeImagesPageSize+10; i++ {
+		images = append(images, testImage(fmt.Sprintf("m-%03d", i)))
+	}
+	other := testImage("m-other")
+	other.ImageName = "weekly-m-other"
+	images = append(images, other)
+	api := newFakeAlicloudAPI(t, images...)
+
+	p := testPostProcessor(t, map[string]interface{}{"image_name_prefix": "nightly-"})
+	described, err := p.describeImages(api.Client(t), fakeAPIRegion)
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	if len(described) != 2*describeImagesPageSize+10 {
+		t.Fatalf("bad: expected the images of all the pages, actual %d", len(described))
+	}
+	for _, image := range described {
+		if image.ImageId == other.ImageId {
+			t.Fatalf("bad: the image %s doesn't match the prefix", image.ImageName)
+		}
+	}
+	if calls := api.Called("DescribeImages"); calls != 3 {
+		t.Fatalf("bad: expected 3 pages, actual %d", calls)
+	}
+}
+
+func TestRetireImage_Deprecate(t *testing.T) {
+	image := testImage("m-1", "s-1")
+	api := newFakeAlicloudAPI(t, image)
+	p := testPostProcessor(t, nil)
+
+	if err := p.retireImage(packersdk.TestUi(t), api.Client(t), fakeAPIRegion, &image); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	deprecated, ok := api.Image(image.ImageId)
+	if !ok || deprecated.Status != packerecs.ImageStatusDeprecated {
+		t.Fatalf("bad: the image should have been deprecated, actual %v", deprecated)
+	}
+	if !api.Snapshot("s-1") {
+		t.Fatal("the snapshot of a deprecated image should have been kept")
+	}
+}
+
+func TestRetireImage_Delete(t *testing.T) {
+	image := testImage("m-1", "s-1", "s-2")
+	api := newFakeAlicloudAPI(t, image)
+	p := testPostProcessor(t, map[string]interface{}{
+		"action":           ActionDelete,
+		"delete_snapshots": true,
+	})
+
+	if err := p.retireImage(packersdk.TestUi(t), api.Client(t), fakeAPIRegion, &image); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+
+	if _, ok := api.Image(image.ImageId); ok {
+		t.Fatal("the image should have been deleted")
+	}
+	if api.Snapshot("s-1") || api.Snapshot("s-2") {
+		t.Fatal("the snapshots of the image should have been deleted")
+	}
+}
+
+func TestRetireImage_Shared(t *testing.T) {
+	image := testImage("m-1", "s-1")
+	api := newFakeAlicloudAPI(t, image)
+	api.Share(image.ImageId, "123456")
+	p := testPostProcessor(t, map[string]interface{}{"action": ActionDelete})
+
+	// 默认保留共享的镜像
+	if err := p.retireImage(packersdk.TestUi(t), api.Client(t), fakeAPIRegion, &image); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if _, ok := api.Image(image.ImageId); !ok {
+		t.Fatal("the shared image should have been kept")
+	}
+	if actions := api.Actions(); !reflect.DeepEqual(actions, []string{"DescribeImageSharePermission"}) {
+		t.Fatalf("bad: the shared image should only be described, actions: %v", actions)
+	}
+
+	// With include_shared, the sharing is revoked before the image is deleted.
+	p = testPostProcessor(t, map[string]interface{}{
+		"action":         ActionDelete,
+		"include_shared": true,
+	})
+	if err := p.retireImage(packersdk.TestUi(t), api.Client(t), fakeAPIRegion, &image); err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if _, ok := api.Image(image.ImageId); ok {
+		t.Fatal("the shared image should have been deleted")
+	}
+	expected := []string{
+		"DescribeImageSharePermission",
+		"DescribeImageSharePermission",
+		"ModifyImageSharePermission",
+		"DeleteImage",
+	}
+	if actions := api.Actions(); !reflect.DeepEqual(actions, expected) {
+		t.Fatalf("bad: expected actions %v, actual %v", expected, actions)
+	}
+	if !api.Snapshot("s-1") {
+		t.Fatal("the snapshot should have been kept without delete_snapshots")
+	}
+}
+
+func TestRetireImage_DryRun(t *testing.T) {
+	for _, action := range []string{ActionDeprecate, ActionDelete} {
+		image := testImage("m-1", "s-1")
+		api := newFakeAlicloudAPI(t, image)
+		api.Share(image.ImageId, "123456")
+		override := map[string]interface{}{
+			"action":         action,
+			"include_shared": true,
+			"dry_run":        true,
+		}
+		if action == ActionDelete {
+			override["delete_snapshots"] = true
+		}
+		p := testPostProcessor(t, override)
+
+		if err := p.retireImage(packersdk.TestUi(t), api.Client(t), fakeAPIRegion, &image); err != nil {
+			t.Fatalf("should not have error: %s", err)
+		}
+
+		// Only the sharing of the image is read.
+		if actions := api.Actions(); !reflect.DeepEqual(actions, []string{"DescribeImageSharePermission"}) {
+			t.Fatalf("bad: dry run to %s should not change anything, actions: %v", action, actions)
+		}
+		if retired, ok := api.Image(image.ImageId); !ok || retired.Status != packerecs.ImageStatusAvailable {
+			t.Fatalf("bad: dry run to %s should have kept the image, actual %v", action, retired)
+		}
+	}
+}